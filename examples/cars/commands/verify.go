@@ -37,19 +37,13 @@ func VerifyEvidence(demoDir, userID, txID string, lg *logger.SugarLogger) (out s
 		return "", errors.Wrap(err, "error creating data transaction")
 	}
 
-	txProof, err := ledger.GetTransactionProof(txRcpt.Header.BaseHeader.Number, int(txRcpt.TxIndex))
+	report, err := ledger.VerifyTransaction(txEnv, txRcpt, nil)
 	if err != nil {
-		return "", errors.Wrap(err, "error getting transaction proof")
+		return "", errors.Wrap(err, "error verifying transaction evidence")
 	}
+	ok := report.Verified()
 
-	lg.Infof("Transaction proof from BCDB server: %+v", txProof)
-
-	ok, err := txProof.Verify(txRcpt, txEnv)
-	if err != nil {
-		return "", errors.Wrap(err, "error verifying transaction evidence against the proof")
-	}
-
-	lg.Infof("Verified evidence for txID: %s, result: %t", txID, ok)
+	lg.Infof("Verified evidence for txID: %s, result: %t, report: %+v", txID, ok, report)
 
 	return fmt.Sprintf("VerifyEvidence: txID: %s, result: %t", txID, ok), nil
 }
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/golang/protobuf v1.5.2
 	github.com/hyperledger-labs/orion-server v0.1.1-0.20211013183033-9b938c1c8d89
+	github.com/klauspost/compress v1.13.6
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.7.0
@@ -0,0 +1,98 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"sort"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// UserAccessCount the number of times a user accessed a key
+type UserAccessCount struct {
+	UserID string `json:"user_id"`
+	Count  uint32 `json:"count"`
+}
+
+// KeyAccessSummary summarizes the accesses to a key, for data access reviews
+type KeyAccessSummary struct {
+	DBName string `json:"db_name"`
+	Key    string `json:"key"`
+	// Readers and Writers of the key, ordered by descending count and then by user ID
+	Readers []*UserAccessCount `json:"readers"`
+	Writers []*UserAccessCount `json:"writers"`
+	// ReadCount and WriteCount total number of reads and writes of the key
+	ReadCount  uint64 `json:"read_count"`
+	WriteCount uint64 `json:"write_count"`
+	// LastWriteVersion the version of the most recent write of the key, nil if the key was never written.
+	// The reads of the key are not versioned, so they are not taken into account
+	LastWriteVersion *types.Version `json:"last_write_version,omitempty"`
+}
+
+func (p *provenance) GetReadersWithCounts(dbName, key string) ([]*UserAccessCount, error) {
+	readBy, err := p.readBy(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedAccessCounts(readBy), nil
+}
+
+func (p *provenance) GetWritersWithCounts(dbName, key string) ([]*UserAccessCount, error) {
+	writtenBy, err := p.writtenBy(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedAccessCounts(writtenBy), nil
+}
+
+func (p *provenance) GetKeyAccessSummary(dbName, key string) (*KeyAccessSummary, error) {
+	return keyAccessSummary(p, dbName, key)
+}
+
+func keyAccessSummary(p Provenance, dbName, key string) (*KeyAccessSummary, error) {
+	readers, err := p.GetReadersWithCounts(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get readers of key '%s' in database '%s'", key, dbName)
+	}
+	writers, err := p.GetWritersWithCounts(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get writers of key '%s' in database '%s'", key, dbName)
+	}
+	values, err := p.GetHistoricalData(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get history of key '%s' in database '%s'", key, dbName)
+	}
+
+	summary := &KeyAccessSummary{
+		DBName:  dbName,
+		Key:     key,
+		Readers: readers,
+		Writers: writers,
+	}
+	for _, r := range readers {
+		summary.ReadCount += uint64(r.Count)
+	}
+	for _, w := range writers {
+		summary.WriteCount += uint64(w.Count)
+	}
+	if len(values) > 0 {
+		sortValuesByVersion(values)
+		summary.LastWriteVersion = values[len(values)-1].GetMetadata().GetVersion()
+	}
+	return summary, nil
+}
+
+func sortedAccessCounts(counts map[string]uint32) []*UserAccessCount {
+	var accesses []*UserAccessCount
+	for userID, count := range counts {
+		accesses = append(accesses, &UserAccessCount{UserID: userID, Count: count})
+	}
+	sort.Slice(accesses, func(i, j int) bool {
+		if accesses[i].Count != accesses[j].Count {
+			return accesses[i].Count > accesses[j].Count
+		}
+		return accesses[i].UserID < accesses[j].UserID
+	})
+	return accesses
+}
@@ -0,0 +1,96 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// accessProvenance serves the accesses to a single key
+type accessProvenance struct {
+	*historyProvenance
+	readBy    map[string]uint32
+	writtenBy map[string]uint32
+}
+
+func (p *accessProvenance) GetReadersWithCounts(dbName, key string) ([]*UserAccessCount, error) {
+	return sortedAccessCounts(p.readBy), nil
+}
+
+func (p *accessProvenance) GetWritersWithCounts(dbName, key string) ([]*UserAccessCount, error) {
+	return sortedAccessCounts(p.writtenBy), nil
+}
+
+func TestSortedAccessCounts(t *testing.T) {
+	require.Empty(t, sortedAccessCounts(nil))
+	require.Equal(t, []*UserAccessCount{
+		{UserID: "eve", Count: 5},
+		{UserID: "alice", Count: 2},
+		{UserID: "bob", Count: 2},
+		{UserID: "carol", Count: 1},
+	}, sortedAccessCounts(map[string]uint32{"bob": 2, "carol": 1, "eve": 5, "alice": 2}))
+}
+
+func TestKeyAccessSummary(t *testing.T) {
+	p := &accessProvenance{
+		historyProvenance: &historyProvenance{},
+		readBy:            map[string]uint32{"bob": 2, "carol": 3},
+		writtenBy:         map[string]uint32{"alice": 2},
+	}
+	p.write("b", 7, 2)
+	p.write("a", 3, 0)
+
+	summary, err := keyAccessSummary(p, "bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, &KeyAccessSummary{
+		DBName:           "bdb",
+		Key:              "key1",
+		Readers:          []*UserAccessCount{{UserID: "carol", Count: 3}, {UserID: "bob", Count: 2}},
+		Writers:          []*UserAccessCount{{UserID: "alice", Count: 2}},
+		ReadCount:        5,
+		WriteCount:       2,
+		LastWriteVersion: &types.Version{BlockNum: 7, TxNum: 2},
+	}, summary)
+
+	p = &accessProvenance{historyProvenance: &historyProvenance{}}
+	summary, err = keyAccessSummary(p, "bdb", "key2")
+	require.NoError(t, err)
+	require.Nil(t, summary.LastWriteVersion)
+	require.Empty(t, summary.Readers)
+	require.Equal(t, uint64(0), summary.WriteCount)
+}
+
+func TestGetKeyAccessSummary(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	receipt := putKeySync(t, "bdb", "key1", "value2", "alice", aliceSession)
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	_, _, err = tx.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("bdb", "key2", []byte("value"), nil))
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+	writers, err := p.GetWritersWithCounts("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []*UserAccessCount{{UserID: "alice", Count: 2}}, writers)
+
+	summary, err := p.GetKeyAccessSummary("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []*UserAccessCount{{UserID: "alice", Count: 1}}, summary.Readers)
+	require.Equal(t, uint64(1), summary.ReadCount)
+	require.Equal(t, uint64(2), summary.WriteCount)
+	require.Equal(t, receipt.GetHeader().GetBaseHeader().GetNumber(), summary.LastWriteVersion.GetBlockNum())
+}
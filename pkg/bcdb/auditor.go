@@ -0,0 +1,357 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+)
+
+// DefaultAuditInterval default interval between audit rounds
+const DefaultAuditInterval = time.Minute
+
+// AuditFindingKind kind of an audit finding
+type AuditFindingKind string
+
+const (
+	// AuditBrokenChain a block is not linked to its predecessor, or the ledger path between blocks is broken
+	AuditBrokenChain AuditFindingKind = "broken-chain"
+	// AuditLedgerFork a block already audited has changed, i.e. the ledger was rewritten
+	AuditLedgerFork AuditFindingKind = "ledger-fork"
+	// AuditTxProofFailure the proof of a watched tx does not lead to the tx merkle tree root of its block
+	AuditTxProofFailure AuditFindingKind = "tx-proof-failure"
+	// AuditReceiptMismatch the header of a watched receipt differs from the header served by the ledger
+	AuditReceiptMismatch AuditFindingKind = "receipt-mismatch"
+	// AuditStateProofFailure a watched state proof no longer holds
+	AuditStateProofFailure AuditFindingKind = "state-proof-failure"
+	// AuditUnavailable the ledger could not be queried, the affected checks were skipped
+	AuditUnavailable AuditFindingKind = "unavailable"
+)
+
+// AuditFinding a single problem found by the auditor
+type AuditFinding struct {
+	Kind     AuditFindingKind
+	BlockNum uint64
+	// TxID the tx the finding refers to, if any
+	TxID    string
+	Message string
+	Time    time.Time
+}
+
+func (f *AuditFinding) String() string {
+	return fmt.Sprintf("%s at block %d: %s", f.Kind, f.BlockNum, f.Message)
+}
+
+// AuditReport summary of a single audit round
+type AuditReport struct {
+	Started  time.Time
+	Finished time.Time
+	// FirstBlock and LastBlock the range of new blocks walked in the round, zero if there were no new blocks
+	FirstBlock          uint64
+	LastBlock           uint64
+	ReceiptsVerified    int
+	StateProofsVerified int
+	Findings            []*AuditFinding
+}
+
+// AuditorConfig configuration of a ledger auditor
+type AuditorConfig struct {
+	// Interval between audit rounds, DefaultAuditInterval if zero
+	Interval time.Duration
+	// OnFinding if not nil, is called for every finding
+	OnFinding func(finding *AuditFinding)
+	// OnReport if not nil, is called at the end of every audit round
+	OnReport func(report *AuditReport)
+	// Anchor if not nil, a trusted block header, e.g. from a verified receipt or the last header audited by a
+	// previous auditor. The first round walks the blocks after the anchor, and verifies the ledger path from it.
+	Anchor *types.BlockHeader
+	// StartBlock if Anchor is nil, the first block walked by the first round, which is trusted as the anchor of
+	// the following blocks. If both are zero the first round walks the whole ledger from the genesis block.
+	StartBlock uint64
+}
+
+// Auditor monitors a ledger for tampering. Every audit round walks the blocks committed since the previous
+// round, checks that each block is linked to its predecessor and that a verified ledger path leads from the
+// last audited block to the new tip. It also re-verifies the watched receipts and tx proofs, starting from
+// the watched tx itself, and the watched state proofs, so a retroactive change of the ledger is detected.
+// The ledger does not serve tx envelopes, so the txs of the new blocks are not verified. To audit several
+// replicas, create an auditor with the ledger of a session to each replica.
+type Auditor interface {
+	// WatchTransaction adds a committed tx, whose receipt and proof are re-verified in every round
+	WatchTransaction(tx proto.Message, receipt *types.TxReceipt)
+	// WatchStateProof adds a state proof, re-verified in every round
+	WatchStateProof(proof *StateProof)
+	// Audit runs a single audit round
+	Audit() *AuditReport
+	// Start runs audit rounds in the background, every configured interval
+	Start()
+	// Stop stops the background audit rounds and waits for the current round to finish
+	Stop()
+}
+
+type auditedTx struct {
+	tx      proto.Message
+	receipt *types.TxReceipt
+}
+
+type auditor struct {
+	ledger Ledger
+	config AuditorConfig
+	// roundMutex serializes the audit rounds, and guards lastHeader
+	roundMutex sync.Mutex
+	lastHeader *types.BlockHeader
+	// mutex guards the watched txs and state proofs, and the background rounds, it is not held while the ledger is queried
+	mutex       sync.Mutex
+	txs         []*auditedTx
+	stateProofs []*StateProof
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// NewAuditor creates an auditor of ledger, a nil config selects the defaults
+func NewAuditor(ledger Ledger, config *AuditorConfig) Auditor {
+	if config == nil {
+		config = &AuditorConfig{}
+	}
+	a := &auditor{
+		ledger:     ledger,
+		config:     *config,
+		lastHeader: config.Anchor,
+	}
+	if a.config.Interval == 0 {
+		a.config.Interval = DefaultAuditInterval
+	}
+	return a
+}
+
+func (a *auditor) WatchTransaction(tx proto.Message, receipt *types.TxReceipt) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.txs = append(a.txs, &auditedTx{tx: tx, receipt: receipt})
+}
+
+func (a *auditor) WatchStateProof(proof *StateProof) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stateProofs = append(a.stateProofs, proof)
+}
+
+func (a *auditor) Start() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.stop != nil {
+		return
+	}
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(a.config.Interval)
+		defer ticker.Stop()
+		for {
+			a.Audit()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(a.stop, a.done)
+}
+
+func (a *auditor) Stop() {
+	a.mutex.Lock()
+	stop, done := a.stop, a.done
+	a.stop, a.done = nil, nil
+	a.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (a *auditor) Audit() *AuditReport {
+	a.roundMutex.Lock()
+	a.mutex.Lock()
+	txs := append([]*auditedTx{}, a.txs...)
+	stateProofs := append([]*StateProof{}, a.stateProofs...)
+	a.mutex.Unlock()
+
+	report := &AuditReport{
+		Started: time.Now(),
+	}
+	a.auditNewBlocks(report)
+	a.auditTxs(txs, report)
+	a.auditStateProofs(stateProofs, report)
+	report.Finished = time.Now()
+	a.roundMutex.Unlock()
+
+	if a.config.OnFinding != nil {
+		for _, f := range report.Findings {
+			a.config.OnFinding(f)
+		}
+	}
+	if a.config.OnReport != nil {
+		a.config.OnReport(report)
+	}
+	return report
+}
+
+func (a *auditor) auditNewBlocks(report *AuditReport) {
+	// the first round starts from the configured anchor or start block, later rounds from the last audited block
+	anchor := a.lastHeader
+	prev := a.lastHeader
+	next := uint64(1)
+	if prev != nil {
+		next = prev.GetBaseHeader().GetNumber() + 1
+	} else if a.config.StartBlock > 0 {
+		next = a.config.StartBlock
+	}
+	linked := true
+
+	var tip *types.BlockHeader
+	for ; ; next++ {
+		header, err := a.ledger.GetBlockHeader(next)
+		if err != nil && !isNotFound(err) {
+			addFinding(report, AuditUnavailable, next, "", "failed to get block header: %s", err)
+			break
+		}
+		if header == nil {
+			break
+		}
+		if report.FirstBlock == 0 {
+			report.FirstBlock = next
+		}
+		report.LastBlock = next
+		if anchor == nil {
+			anchor = header
+		}
+
+		if prev != nil && !a.linkedToPrevious(header, prev) {
+			addFinding(report, AuditBrokenChain, next, "", "block %d is not linked to block %d", next, next-1)
+			linked = false
+		}
+		prev = header
+		tip = header
+	}
+	if tip == nil {
+		return
+	}
+
+	anchorNum := anchor.GetBaseHeader().GetNumber()
+	tipNum := tip.GetBaseHeader().GetNumber()
+	if tipNum > anchorNum {
+		path, err := a.ledger.GetLedgerPath(anchorNum, tipNum)
+		if err != nil {
+			addFinding(report, AuditBrokenChain, tipNum, "", "failed to get a valid ledger path from block %d: %s", anchorNum, err)
+			return
+		}
+		tipHash, err := CalculateBlockHeaderHash(tip)
+		if err != nil {
+			addFinding(report, AuditBrokenChain, tipNum, "", "failed to calculate the hash of block %d: %s", tipNum, err)
+			return
+		}
+		anchorHash, err := CalculateBlockHeaderHash(anchor)
+		if err != nil {
+			addFinding(report, AuditBrokenChain, anchorNum, "", "failed to calculate the hash of block %d: %s", anchorNum, err)
+			return
+		}
+		fork, err := matchPathEnds(path, tipHash, anchorHash)
+		if err != nil {
+			addFinding(report, AuditBrokenChain, tipNum, "", "failed to match the ledger path from block %d: %s", anchorNum, err)
+			return
+		}
+		if fork != nil {
+			addFinding(report, AuditLedgerFork, fork.BlockNum, "", "%s", fork)
+			// the anchor stays, so the fork is reported again in the next rounds
+			return
+		}
+	}
+	// likewise, a broken chain is walked and reported again in the next rounds
+	if linked {
+		a.lastHeader = tip
+	}
+}
+
+func (a *auditor) linkedToPrevious(header, prev *types.BlockHeader) bool {
+	skipchainHashes := header.GetSkipchainHashes()
+	if len(skipchainHashes) == 0 {
+		return false
+	}
+	prevHash, err := CalculateBlockHeaderHash(prev)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(skipchainHashes[0], prevHash)
+}
+
+func (a *auditor) auditTxs(txs []*auditedTx, report *AuditReport) {
+	for _, t := range txs {
+		txID := txIDOf(t.tx)
+		blockNum := t.receipt.GetHeader().GetBaseHeader().GetNumber()
+		header, err := a.ledger.GetBlockHeader(blockNum)
+		if err != nil {
+			addFinding(report, AuditUnavailable, blockNum, txID, "failed to get block header: %s", err)
+			continue
+		}
+		report.ReceiptsVerified++
+		if !proto.Equal(header, t.receipt.GetHeader()) {
+			addFinding(report, AuditReceiptMismatch, blockNum, txID, "header of block %d differs from the header in the receipt of tx %s", blockNum, txID)
+			continue
+		}
+
+		proof, err := a.ledger.GetTransactionProof(blockNum, int(t.receipt.GetTxIndex()))
+		if err != nil {
+			addFinding(report, AuditUnavailable, blockNum, txID, "failed to get proof of tx %s: %s", txID, err)
+			continue
+		}
+		ok, err := proof.Verify(t.receipt, t.tx)
+		if err != nil || !ok {
+			addFinding(report, AuditTxProofFailure, blockNum, txID, "tx %s is not included in the tx merkle tree of block %d", txID, blockNum)
+		}
+	}
+}
+
+func (a *auditor) auditStateProofs(stateProofs []*StateProof, report *AuditReport) {
+	for _, p := range stateProofs {
+		blockNum := p.BlockNum()
+		header, err := a.ledger.GetBlockHeader(blockNum)
+		if err != nil {
+			addFinding(report, AuditUnavailable, blockNum, "", "failed to get block header: %s", err)
+			continue
+		}
+		trieProof, err := a.ledger.GetDataProof(blockNum, p.DBName, p.Key, p.Deleted)
+		if err != nil {
+			addFinding(report, AuditUnavailable, blockNum, "", "failed to get state proof of key '%s' in database '%s': %s", p.Key, p.DBName, err)
+			continue
+		}
+		report.StateProofsVerified++
+
+		current := *p
+		current.BlockHeader = header
+		current.Path = trieProof.GetPath()
+		if err = current.Verify(); err != nil {
+			addFinding(report, AuditStateProofFailure, blockNum, "", "%s", err)
+		} else if !proto.Equal(header, p.BlockHeader) {
+			addFinding(report, AuditStateProofFailure, blockNum, "", "header of block %d differs from the header in the state proof of key '%s' in database '%s'", blockNum, p.Key, p.DBName)
+		}
+	}
+}
+
+func addFinding(report *AuditReport, kind AuditFindingKind, blockNum uint64, txID, format string, args ...interface{}) {
+	report.Findings = append(report.Findings, &AuditFinding{
+		Kind:     kind,
+		BlockNum: blockNum,
+		TxID:     txID,
+		Message:  fmt.Sprintf(format, args...),
+		Time:     time.Now(),
+	})
+}
@@ -0,0 +1,274 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// auditLedger serves single tx blocks, and answers queries of blocks beyond the tip the same way the server does
+type auditLedger struct {
+	pathLedger
+}
+
+func (l *auditLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	if blockNum > uint64(len(l.headers)) {
+		return nil, blockNotFound(blockNum)
+	}
+	return l.pathLedger.GetBlockHeader(blockNum)
+}
+
+func (l *auditLedger) GetTransactionProof(blockNum uint64, txIndex int) (*TxProof, error) {
+	return NewTxProof([][]byte{l.headers[blockNum-1].GetTxMerkelTreeRootHash()}), nil
+}
+
+// blockNotFound returns the server's response to a query of a block beyond the ledger tip
+func blockNotFound(blockNum uint64) error {
+	return &ErrorServerResponse{
+		StatusCode: http.StatusNotFound,
+		Status:     "404 Not Found",
+		Message:    fmt.Sprintf("error while processing 'GET /ledger/block/%d' because block not found: %d", blockNum, blockNum),
+	}
+}
+
+// appendAuditHeaders extends headers up to block n with single tx blocks, whose tx hash is given by txHash
+func appendAuditHeaders(t *testing.T, headers []*types.BlockHeader, n int, txHash func(blockNum int) []byte) []*types.BlockHeader {
+	headers = append([]*types.BlockHeader{}, headers...)
+	for i := len(headers) + 1; i <= n; i++ {
+		header := &types.BlockHeader{
+			BaseHeader:           &types.BlockHeaderBase{Number: uint64(i)},
+			TxMerkelTreeRootHash: txHash(i),
+			ValidationInfo:       []*types.ValidationInfo{{Flag: types.Flag_VALID}},
+		}
+		for _, link := range skipListLinks(uint64(i)) {
+			hash, err := CalculateBlockHeaderHash(headers[link-1])
+			require.NoError(t, err)
+			header.SkipchainHashes = append(header.SkipchainHashes, hash)
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestAuditor(t *testing.T) {
+	tx := &types.DataTxEnvelope{
+		Payload: &types.DataTx{TxId: "tx1", MustSignUserIds: []string{"alice"}},
+	}
+	receipt, _ := singleTxReceipt(t, tx)
+	headers := appendAuditHeaders(t, nil, 20, func(blockNum int) []byte {
+		if blockNum == 3 {
+			return receipt.GetHeader().GetTxMerkelTreeRootHash()
+		}
+		return []byte{byte(blockNum)}
+	})
+	receipt.Header = headers[2]
+
+	ledger := &auditLedger{pathLedger: pathLedger{headers: headers[:10]}}
+	var findings []*AuditFinding
+	auditor := NewAuditor(ledger, &AuditorConfig{
+		OnFinding: func(finding *AuditFinding) {
+			findings = append(findings, finding)
+		},
+	})
+	auditor.WatchTransaction(tx, receipt)
+
+	report := auditor.Audit()
+	require.Equal(t, uint64(1), report.FirstBlock)
+	require.Equal(t, uint64(10), report.LastBlock)
+	require.Equal(t, 1, report.ReceiptsVerified)
+	require.Empty(t, report.Findings)
+
+	ledger.headers = headers
+	report = auditor.Audit()
+	require.Equal(t, uint64(11), report.FirstBlock)
+	require.Equal(t, uint64(20), report.LastBlock)
+	require.Empty(t, report.Findings)
+
+	// no new blocks
+	report = auditor.Audit()
+	require.Equal(t, uint64(0), report.FirstBlock)
+	require.Equal(t, 1, report.ReceiptsVerified)
+	require.Empty(t, report.Findings)
+	require.Empty(t, findings)
+}
+
+func TestAuditor_Tampering(t *testing.T) {
+	tx := &types.DataTxEnvelope{
+		Payload: &types.DataTx{TxId: "tx1", MustSignUserIds: []string{"alice"}},
+	}
+	receipt, _ := singleTxReceipt(t, tx)
+	txHash := receipt.GetHeader().GetTxMerkelTreeRootHash()
+	headers := appendAuditHeaders(t, nil, 10, func(blockNum int) []byte {
+		if blockNum == 3 {
+			return txHash
+		}
+		return []byte{byte(blockNum)}
+	})
+	receipt.Header = headers[2]
+
+	ledger := &auditLedger{pathLedger: pathLedger{headers: headers}}
+	auditor := NewAuditor(ledger, &AuditorConfig{})
+	auditor.WatchTransaction(tx, receipt)
+	require.Empty(t, auditor.Audit().Findings)
+
+	// the server rewrote its history from block 3 on
+	ledger.headers = appendAuditHeaders(t, headers[:2], 12, func(blockNum int) []byte {
+		return []byte("rewritten")
+	})
+
+	report := auditor.Audit()
+	require.Equal(t, uint64(11), report.FirstBlock)
+	require.Equal(t, uint64(12), report.LastBlock)
+	var kinds []AuditFindingKind
+	for _, f := range report.Findings {
+		kinds = append(kinds, f.Kind)
+	}
+	require.Equal(t, []AuditFindingKind{AuditBrokenChain, AuditLedgerFork, AuditReceiptMismatch}, kinds)
+	require.Equal(t, uint64(11), report.Findings[0].BlockNum)
+	require.Equal(t, "block 11 is not linked to block 10", report.Findings[0].Message)
+	require.Equal(t, uint64(10), report.Findings[1].BlockNum)
+	require.Equal(t, "tx1", report.Findings[2].TxID)
+	require.Equal(t, "receipt-mismatch at block 3: header of block 3 differs from the header in the receipt of tx tx1", report.Findings[2].String())
+
+	// the fork is reported until it is resolved
+	report = auditor.Audit()
+	require.Len(t, report.Findings, 3)
+}
+
+func TestAuditor_StartStop(t *testing.T) {
+	ledger := &auditLedger{pathLedger: pathLedger{headers: appendAuditHeaders(t, nil, 5, func(blockNum int) []byte {
+		return []byte{byte(blockNum)}
+	})}}
+	reports := make(chan *AuditReport, 10)
+	auditor := NewAuditor(ledger, &AuditorConfig{
+		Interval: 10 * time.Millisecond,
+		OnReport: func(report *AuditReport) {
+			select {
+			case reports <- report:
+			default:
+			}
+		},
+	})
+
+	auditor.Start()
+	report := <-reports
+	require.Equal(t, uint64(5), report.LastBlock)
+	report = <-reports
+	require.Equal(t, uint64(0), report.LastBlock)
+	auditor.Stop()
+	auditor.Stop()
+}
+
+func TestAuditor_BrokenChain(t *testing.T) {
+	headers := appendAuditHeaders(t, nil, 10, func(blockNum int) []byte {
+		return []byte{byte(blockNum)}
+	})
+	ledger := &auditLedger{pathLedger: pathLedger{headers: headers[:5]}}
+	auditor := NewAuditor(ledger, nil)
+	require.Empty(t, auditor.Audit().Findings)
+
+	// block 6 is not linked to block 5, so block 7 is not linked to the served block 6 either
+	tampered := proto.Clone(headers[5]).(*types.BlockHeader)
+	tampered.SkipchainHashes[0] = []byte("tampered")
+	ledger.headers = append(append(append([]*types.BlockHeader{}, headers[:5]...), tampered), headers[6:]...)
+
+	// the broken chain is reported until it is resolved
+	for i := 0; i < 2; i++ {
+		report := auditor.Audit()
+		require.Equal(t, uint64(6), report.FirstBlock)
+		require.Equal(t, uint64(10), report.LastBlock)
+		require.Len(t, report.Findings, 2)
+		require.Equal(t, "block 6 is not linked to block 5", report.Findings[0].Message)
+		require.Equal(t, "block 7 is not linked to block 6", report.Findings[1].Message)
+	}
+
+	ledger.headers = headers
+	report := auditor.Audit()
+	require.Equal(t, uint64(6), report.FirstBlock)
+	require.Empty(t, report.Findings)
+	require.Equal(t, uint64(0), auditor.Audit().FirstBlock)
+}
+
+func TestAuditor_Anchor(t *testing.T) {
+	headers := appendAuditHeaders(t, nil, 10, func(blockNum int) []byte {
+		return []byte{byte(blockNum)}
+	})
+	ledger := &auditLedger{pathLedger: pathLedger{headers: headers}}
+
+	report := NewAuditor(ledger, &AuditorConfig{Anchor: headers[6]}).Audit()
+	require.Equal(t, uint64(8), report.FirstBlock)
+	require.Equal(t, uint64(10), report.LastBlock)
+	require.Empty(t, report.Findings)
+
+	report = NewAuditor(ledger, &AuditorConfig{StartBlock: 4}).Audit()
+	require.Equal(t, uint64(4), report.FirstBlock)
+	require.Equal(t, uint64(10), report.LastBlock)
+	require.Empty(t, report.Findings)
+
+	// the ledger path from an anchor of another ledger does not match
+	otherHeaders := appendAuditHeaders(t, nil, 7, func(blockNum int) []byte {
+		return []byte("other")
+	})
+	report = NewAuditor(ledger, &AuditorConfig{Anchor: otherHeaders[6]}).Audit()
+	require.Len(t, report.Findings, 2)
+	require.Equal(t, AuditBrokenChain, report.Findings[0].Kind)
+	require.Equal(t, "block 8 is not linked to block 7", report.Findings[0].Message)
+	require.Equal(t, AuditLedgerFork, report.Findings[1].Kind)
+	require.Equal(t, uint64(7), report.Findings[1].BlockNum)
+}
+
+// blockingLedger blocks the queries of block headers until release is closed
+type blockingLedger struct {
+	auditLedger
+	queried chan struct{}
+	release chan struct{}
+}
+
+func (l *blockingLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	select {
+	case l.queried <- struct{}{}:
+	default:
+	}
+	<-l.release
+	return l.auditLedger.GetBlockHeader(blockNum)
+}
+
+func TestAuditor_WatchDuringRound(t *testing.T) {
+	ledger := &blockingLedger{
+		auditLedger: auditLedger{pathLedger: pathLedger{headers: appendAuditHeaders(t, nil, 3, func(blockNum int) []byte {
+			return []byte{byte(blockNum)}
+		})}},
+		queried: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	auditor := NewAuditor(ledger, nil)
+	reports := make(chan *AuditReport, 1)
+	go func() {
+		reports <- auditor.Audit()
+	}()
+	<-ledger.queried
+
+	// watching does not wait for the round, which queries the ledger
+	watched := make(chan struct{})
+	go func() {
+		auditor.WatchStateProof(&StateProof{})
+		close(watched)
+	}()
+	select {
+	case <-watched:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "watching waited for the audit round")
+	}
+
+	close(ledger.release)
+	report := <-reports
+	require.Equal(t, uint64(3), report.LastBlock)
+	require.Equal(t, 0, report.StateProofsVerified)
+}
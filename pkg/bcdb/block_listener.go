@@ -0,0 +1,276 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultBlockListenerPollInterval default interval between queries of the ledger tip, once all committed blocks were delivered
+const DefaultBlockListenerPollInterval = time.Second
+
+// BlockEvent notifies about a committed block
+type BlockEvent struct {
+	BlockNum uint64
+	Header   *types.BlockHeader
+	// ValidationInfo validation info of the block txs, by tx index
+	ValidationInfo []*types.ValidationInfo
+	// TxReceipts receipts of the block txs, by tx index
+	TxReceipts []*types.TxReceipt
+	// TxIDs IDs of the block txs, by tx index. The server does not serve the tx IDs of a block,
+	// so only the IDs of the txs tracked by the listener are set, the others are empty.
+	TxIDs []string
+}
+
+// BlockListenerConfig configuration of a block listener
+type BlockListenerConfig struct {
+	// StartBlock first block to deliver, 1 if zero. To resume a stopped listener use its NextBlock.
+	StartBlock uint64
+	// PollInterval between queries of the ledger tip, DefaultBlockListenerPollInterval if zero
+	PollInterval time.Duration
+	// BufferSize capacity of the events channel
+	BufferSize int
+	// OnBlock if not nil, is called for every block instead of delivering the event on the events channel.
+	// An error returned by OnBlock stops the listener, and the block is delivered again on resume.
+	OnBlock func(event *BlockEvent) error
+}
+
+// BlockListener follows the ledger tip and delivers an event for every committed block, in order.
+// Blocks are fetched only as fast as they are consumed: the listener waits while the events channel
+// is full, or while OnBlock runs.
+type BlockListener interface {
+	// Events returns the channel the block events are delivered on, it is closed when the listener stops
+	Events() <-chan *BlockEvent
+	// NextBlock returns the number of the next block to be delivered
+	NextBlock() uint64
+	// TrackTransaction adds a tx whose ID is set in the event of the block it is committed in. Until it is
+	// delivered, the receipt of the tx is queried for every new block. A tx committed in a block
+	// already delivered is not tracked.
+	TrackTransaction(txID string)
+	// Stop stops the listener and waits for it to exit
+	Stop()
+	// Wait waits for the listener to stop, and returns the reason it stopped: the error returned by OnBlock,
+	// or the context error; nil if it was stopped by Stop
+	Wait() error
+}
+
+// blockHeaderQuerier is implemented by the ledger of a session, it queries block headers without logging failures
+type blockHeaderQuerier interface {
+	queryBlockHeader(blockNum uint64) (*types.BlockHeader, error)
+}
+
+type blockListener struct {
+	ledger       Ledger
+	pollInterval time.Duration
+	onBlock      func(event *BlockEvent) error
+	events       chan *BlockEvent
+	nextBlock    uint64
+	stopOnce     sync.Once
+	stop         chan struct{}
+	done         chan struct{}
+	err          error
+	logger       *logger.SugarLogger
+	mutex        sync.Mutex
+	// tracked txs, along with their receipt once they are committed
+	tracked map[string]*types.TxReceipt
+}
+
+// BlockListener starts a block listener, it stops when ctx is done or when it is stopped. A nil config selects the defaults.
+func (d *dbSession) BlockListener(ctx context.Context, config *BlockListenerConfig) (BlockListener, error) {
+	l, err := d.Ledger()
+	if err != nil {
+		return nil, err
+	}
+	return newBlockListener(ctx, l, config, d.logger), nil
+}
+
+func newBlockListener(ctx context.Context, ledger Ledger, config *BlockListenerConfig, logger *logger.SugarLogger) *blockListener {
+	if config == nil {
+		config = &BlockListenerConfig{}
+	}
+	b := &blockListener{
+		ledger:       ledger,
+		pollInterval: config.PollInterval,
+		onBlock:      config.OnBlock,
+		events:       make(chan *BlockEvent, config.BufferSize),
+		nextBlock:    config.StartBlock,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		logger:       logger,
+		tracked:      map[string]*types.TxReceipt{},
+	}
+	if b.pollInterval == 0 {
+		b.pollInterval = DefaultBlockListenerPollInterval
+	}
+	if b.nextBlock == 0 {
+		b.nextBlock = 1
+	}
+
+	go b.run(ctx)
+	return b
+}
+
+func (b *blockListener) Events() <-chan *BlockEvent {
+	return b.events
+}
+
+func (b *blockListener) NextBlock() uint64 {
+	return atomic.LoadUint64(&b.nextBlock)
+}
+
+func (b *blockListener) TrackTransaction(txID string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.tracked[txID]; !ok {
+		b.tracked[txID] = nil
+	}
+}
+
+func (b *blockListener) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+}
+
+func (b *blockListener) Wait() error {
+	<-b.done
+	return b.err
+}
+
+// blockHeader queries the header of block blockNum, which is expected not to be committed yet when
+// the tip is polled, so the ledger does not log the server's response to a block not found
+func (b *blockListener) blockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	if q, ok := b.ledger.(blockHeaderQuerier); ok {
+		return q.queryBlockHeader(blockNum)
+	}
+	return b.ledger.GetBlockHeader(blockNum)
+}
+
+func (b *blockListener) run(ctx context.Context) {
+	defer close(b.done)
+	defer close(b.events)
+
+	poll := time.NewTimer(b.pollInterval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ctx.Done():
+			b.err = ctx.Err()
+			return
+		default:
+		}
+
+		blockNum := b.NextBlock()
+		header, err := b.blockHeader(blockNum)
+		if err != nil && !isNotFound(err) {
+			b.logger.Errorf("block listener failed to get block %d, due to %s", blockNum, err)
+		}
+
+		var txIDs []string
+		if header != nil {
+			if txIDs, err = b.trackedTxIDs(blockNum, len(header.GetValidationInfo())); err != nil {
+				b.logger.Errorf("block listener failed to get the receipts of the tracked txs, due to %s", err)
+				header = nil
+			}
+		}
+
+		if header == nil {
+			if !poll.Stop() {
+				select {
+				case <-poll.C:
+				default:
+				}
+			}
+			poll.Reset(b.pollInterval)
+			select {
+			case <-b.stop:
+				return
+			case <-ctx.Done():
+				b.err = ctx.Err()
+				return
+			case <-poll.C:
+				continue
+			}
+		}
+
+		event := &BlockEvent{
+			BlockNum:       blockNum,
+			Header:         header,
+			ValidationInfo: header.GetValidationInfo(),
+			TxIDs:          txIDs,
+		}
+		for txIndex := range header.GetValidationInfo() {
+			event.TxReceipts = append(event.TxReceipts, &types.TxReceipt{
+				Header:  header,
+				TxIndex: uint64(txIndex),
+			})
+		}
+		if b.onBlock != nil {
+			if err = b.onBlock(event); err != nil {
+				b.err = errors.WithMessagef(err, "block listener stopped at block %d", blockNum)
+				return
+			}
+		} else {
+			select {
+			case <-b.stop:
+				return
+			case <-ctx.Done():
+				b.err = ctx.Err()
+				return
+			case b.events <- event:
+			}
+		}
+		atomic.StoreUint64(&b.nextBlock, blockNum+1)
+	}
+}
+
+// trackedTxIDs returns the IDs of the txs in block blockNum, by tx index, set for the tracked txs only.
+// The txs committed in blockNum or before are no longer tracked, unless an error is returned.
+func (b *blockListener) trackedTxIDs(blockNum uint64, txCount int) ([]string, error) {
+	b.mutex.Lock()
+	tracked := make(map[string]*types.TxReceipt, len(b.tracked))
+	for txID, receipt := range b.tracked {
+		tracked[txID] = receipt
+	}
+	b.mutex.Unlock()
+
+	txIDs := make([]string, txCount)
+	committed := map[string]*types.TxReceipt{}
+	for txID, receipt := range tracked {
+		if receipt == nil {
+			var err error
+			if receipt, err = b.ledger.GetTransactionReceipt(txID); err != nil {
+				if isNotFound(err) {
+					continue
+				}
+				return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+			}
+		}
+		committed[txID] = receipt
+		if receipt.GetHeader().GetBaseHeader().GetNumber() == blockNum && receipt.GetTxIndex() < uint64(txCount) {
+			txIDs[receipt.GetTxIndex()] = txID
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for txID, receipt := range committed {
+		if receipt.GetHeader().GetBaseHeader().GetNumber() > blockNum {
+			b.tracked[txID] = receipt
+		} else {
+			delete(b.tracked, txID)
+		}
+	}
+	return txIDs, nil
+}
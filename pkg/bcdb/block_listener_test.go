@@ -0,0 +1,256 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// tipLedger is a ledger that grows while it is listened to
+type tipLedger struct {
+	auditLedger
+	mutex      sync.Mutex
+	receiptErr error
+}
+
+func (l *tipLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.auditLedger.GetBlockHeader(blockNum)
+}
+
+// GetTransactionReceipt serves the receipts of the txs named "tx<block number>", each the only tx in its block
+func (l *tipLedger) GetTransactionReceipt(txID string) (*types.TxReceipt, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.receiptErr != nil {
+		return nil, l.receiptErr
+	}
+	var blockNum uint64
+	if _, err := fmt.Sscanf(txID, "tx%d", &blockNum); err != nil || blockNum > uint64(len(l.headers)) {
+		return nil, &ErrorServerResponse{StatusCode: http.StatusNotFound, Status: "404 Not Found", Message: "txID not found: " + txID}
+	}
+	return &types.TxReceipt{Header: l.headers[blockNum-1]}, nil
+}
+
+func (l *tipLedger) failReceipts(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.receiptErr = err
+}
+
+func (l *tipLedger) commit(headers []*types.BlockHeader) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.headers = headers
+}
+
+func testTipLedger(t *testing.T, n int) (*tipLedger, []*types.BlockHeader) {
+	headers := appendAuditHeaders(t, nil, n, func(blockNum int) []byte {
+		return []byte{byte(blockNum)}
+	})
+	return &tipLedger{auditLedger: auditLedger{pathLedger: pathLedger{headers: headers}}}, headers
+}
+
+func TestBlockListener_Events(t *testing.T) {
+	ledger, headers := testTipLedger(t, 10)
+	ledger.commit(headers[:3])
+
+	listener := newBlockListener(context.Background(), ledger, &BlockListenerConfig{
+		PollInterval: 10 * time.Millisecond,
+	}, createTestLogger(t))
+
+	for i := 1; i <= 3; i++ {
+		event := <-listener.Events()
+		require.Equal(t, uint64(i), event.BlockNum)
+		require.Equal(t, headers[i-1], event.Header)
+		require.Equal(t, headers[i-1].GetValidationInfo(), event.ValidationInfo)
+		require.Equal(t, []*types.TxReceipt{{Header: headers[i-1]}}, event.TxReceipts)
+		require.Equal(t, []string{""}, event.TxIDs)
+	}
+
+	// new blocks are delivered as they are committed
+	ledger.commit(headers)
+	for i := 4; i <= 10; i++ {
+		require.Equal(t, uint64(i), (<-listener.Events()).BlockNum)
+	}
+	require.Equal(t, uint64(11), listener.NextBlock())
+
+	listener.Stop()
+	_, open := <-listener.Events()
+	require.False(t, open)
+	require.NoError(t, listener.Wait())
+}
+
+// quietTipLedger queries block headers without logging, the same way the ledger of a session does
+type quietTipLedger struct {
+	*tipLedger
+	t       *testing.T
+	queried int
+}
+
+func (l *quietTipLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	l.t.Errorf("block %d queried with the logging query", blockNum)
+	return l.tipLedger.GetBlockHeader(blockNum)
+}
+
+func (l *quietTipLedger) queryBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	l.queried++
+	return l.tipLedger.GetBlockHeader(blockNum)
+}
+
+func TestBlockListener_QuietTipPolling(t *testing.T) {
+	tip, headers := testTipLedger(t, 3)
+	ledger := &quietTipLedger{tipLedger: tip, t: t}
+	listener := newBlockListener(context.Background(), ledger, &BlockListenerConfig{
+		PollInterval: time.Millisecond,
+	}, createTestLogger(t))
+
+	for i := 1; i <= 3; i++ {
+		require.Equal(t, headers[i-1], (<-listener.Events()).Header)
+	}
+	// the tip is polled until a block is committed
+	require.Eventually(t, func() bool {
+		return listener.NextBlock() == 4
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	listener.Stop()
+	require.NoError(t, listener.Wait())
+	require.Greater(t, ledger.queried, 4)
+}
+
+func TestBlockListener_BackpressureAndResume(t *testing.T) {
+	ledger, _ := testTipLedger(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the unconsumed block is not skipped
+	listener := newBlockListener(ctx, ledger, &BlockListenerConfig{
+		StartBlock:   4,
+		PollInterval: 10 * time.Millisecond,
+		BufferSize:   2,
+	}, createTestLogger(t))
+	require.Equal(t, uint64(4), (<-listener.Events()).BlockNum)
+	require.Eventually(t, func() bool { return len(listener.Events()) == 2 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Len(t, listener.Events(), 2)
+
+	cancel()
+	require.Equal(t, context.Canceled, listener.Wait())
+	require.Equal(t, uint64(7), listener.NextBlock())
+
+	// resume with a callback, which stops the listener on error
+	var delivered []uint64
+	listener = newBlockListener(context.Background(), ledger, &BlockListenerConfig{
+		StartBlock:   7,
+		PollInterval: 10 * time.Millisecond,
+		OnBlock: func(event *BlockEvent) error {
+			if event.BlockNum == 9 {
+				return errors.New("projection failed")
+			}
+			delivered = append(delivered, event.BlockNum)
+			return nil
+		},
+	}, createTestLogger(t))
+	require.EqualError(t, listener.Wait(), "block listener stopped at block 9: projection failed")
+	require.Equal(t, []uint64{7, 8}, delivered)
+	require.Equal(t, uint64(9), listener.NextBlock())
+}
+
+func TestBlockListener_TrackTransaction(t *testing.T) {
+	ledger, headers := testTipLedger(t, 6)
+	ledger.commit(headers[:2])
+
+	listener := newBlockListener(context.Background(), ledger, nil, createTestLogger(t))
+	require.Equal(t, DefaultBlockListenerPollInterval, listener.pollInterval)
+	require.Equal(t, uint64(1), (<-listener.Events()).BlockNum)
+	listener.Stop()
+
+	listener = newBlockListener(context.Background(), ledger, &BlockListenerConfig{
+		StartBlock:   3,
+		PollInterval: 10 * time.Millisecond,
+	}, createTestLogger(t))
+	defer listener.Stop()
+	listener.TrackTransaction("tx1")
+	listener.TrackTransaction("tx4")
+	listener.TrackTransaction("tx5")
+
+	ledger.commit(headers[:3])
+	event := <-listener.Events()
+	require.Equal(t, uint64(3), event.BlockNum)
+	require.Equal(t, []string{""}, event.TxIDs)
+
+	// the receipts of the tracked txs can't be queried, so block 4 is delivered once they can
+	ledger.failReceipts(errors.New("connection refused"))
+	ledger.commit(headers[:4])
+	select {
+	case event = <-listener.Events():
+		require.FailNow(t, "block was delivered without the tracked tx IDs", "block %d", event.BlockNum)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ledger.failReceipts(nil)
+	event = <-listener.Events()
+	require.Equal(t, uint64(4), event.BlockNum)
+	require.Equal(t, []string{"tx4"}, event.TxIDs)
+
+	ledger.commit(headers)
+	event = <-listener.Events()
+	require.Equal(t, uint64(5), event.BlockNum)
+	require.Equal(t, []string{"tx5"}, event.TxIDs)
+	event = <-listener.Events()
+	require.Equal(t, uint64(6), event.BlockNum)
+	require.Equal(t, []string{""}, event.TxIDs)
+
+	// tx1 was committed before the listened blocks, the others were delivered
+	listener.mutex.Lock()
+	require.Empty(t, listener.tracked)
+	listener.mutex.Unlock()
+}
+
+func TestBlockListener_Session(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	l, err := aliceSession.Ledger()
+	require.NoError(t, err)
+	receipt := putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	blockNum := receipt.GetHeader().GetBaseHeader().GetNumber()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := aliceSession.BlockListener(ctx, &BlockListenerConfig{
+		StartBlock:   blockNum,
+		PollInterval: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	event := <-listener.Events()
+	require.Equal(t, blockNum, event.BlockNum)
+	require.Equal(t, types.Flag_VALID, event.ValidationInfo[receipt.GetTxIndex()].GetFlag())
+
+	receipt = putKeySync(t, "bdb", "key2", "value2", "alice", aliceSession)
+	event = <-listener.Events()
+	require.Equal(t, blockNum+1, event.BlockNum)
+	header, err := l.GetBlockHeader(blockNum + 1)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(header, event.Header))
+	require.True(t, proto.Equal(receipt.GetHeader(), event.Header))
+	require.Equal(t, receipt.GetTxIndex(), event.TxReceipts[receipt.GetTxIndex()].GetTxIndex())
+
+	listener.Stop()
+	require.NoError(t, listener.Wait())
+}
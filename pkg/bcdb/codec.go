@@ -0,0 +1,158 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContentTypeJSON content type of values encoded by JSONCodec
+	ContentTypeJSON = "application/json"
+	// ContentTypeProto content type of values encoded by ProtoCodec
+	ContentTypeProto = "application/x-protobuf"
+)
+
+// valueTagMagic prefix marks values carrying a tag, i.e. content type, ahead of the payload.
+// The tag layout is: magic | uvarint(len(tag)) | tag | payload
+var valueTagMagic = []byte{0x00, 'b', 'c', 'd', 'b', 0x01}
+
+// Codec encodes and decodes structured values stored in the database
+type Codec interface {
+	// ContentType returns the content type of the encoded values
+	ContentType() string
+	// Marshal encodes v to bytes
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ValueCodec transforms raw values on their way to and from the database,
+// see DataTxContext.SetValueCodec
+type ValueCodec interface {
+	// Encode transforms value before it is put to key, acl is the access control of the written value
+	Encode(dbName, key string, value []byte, acl *types.AccessControl) ([]byte, error)
+	// Decode restores value read from key, metadata is the metadata of the stored value.
+	// Decode can also be applied to values returned by the Provenance API.
+	Decode(dbName, key string, value []byte, metadata *types.Metadata) ([]byte, error)
+}
+
+var (
+	// JSONCodec encodes values with encoding/json
+	JSONCodec Codec = &jsonCodec{}
+	// ProtoCodec encodes proto.Message values with the protobuf binary encoding
+	ProtoCodec Codec = &protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (c *jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (c *protoCodec) ContentType() string {
+	return ContentTypeProto
+}
+
+func (c *protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("value of type %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (c *protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("value of type %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// NewTaggedCodec wraps codec to prefix each encoded value with the codec's content type,
+// so readers can detect the encoding using ContentTypeOf. Untagged values are still decoded
+// by the wrapped codec.
+func NewTaggedCodec(codec Codec) Codec {
+	return &taggedCodec{
+		codec: codec,
+	}
+}
+
+type taggedCodec struct {
+	codec Codec
+}
+
+func (c *taggedCodec) ContentType() string {
+	return c.codec.ContentType()
+}
+
+func (c *taggedCodec) Marshal(v interface{}) ([]byte, error) {
+	payload, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return tagValue(c.codec.ContentType(), payload), nil
+}
+
+func (c *taggedCodec) Unmarshal(data []byte, v interface{}) error {
+	return decodeWithCodec(c.codec, data, v)
+}
+
+// decodeWithCodec decodes value into v, a content type tag, if any, must match the codec content type
+func decodeWithCodec(codec Codec, value []byte, v interface{}) error {
+	if contentType, payload, tagged := untagValue(value); tagged {
+		if contentType != codec.ContentType() {
+			return errors.Errorf("value content type is %s, expected %s", contentType, codec.ContentType())
+		}
+		value = payload
+	}
+	return codec.Unmarshal(value, v)
+}
+
+// ContentTypeOf returns the content type of a value encoded by a tagged codec,
+// returns false if value does not carry a content type tag
+func ContentTypeOf(value []byte) (string, bool) {
+	contentType, _, tagged := untagValue(value)
+	return contentType, tagged
+}
+
+func tagValue(tag string, payload []byte) []byte {
+	tagLen := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tagLen, uint64(len(tag)))
+
+	res := make([]byte, 0, len(valueTagMagic)+n+len(tag)+len(payload))
+	res = append(res, valueTagMagic...)
+	res = append(res, tagLen[:n]...)
+	res = append(res, tag...)
+	return append(res, payload...)
+}
+
+func untagValue(value []byte) (string, []byte, bool) {
+	if !bytes.HasPrefix(value, valueTagMagic) {
+		return "", value, false
+	}
+	rest := value[len(valueTagMagic):]
+	tagLen, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < tagLen {
+		return "", value, false
+	}
+	rest = rest[n:]
+	return string(rest[:tagLen]), rest[tagLen:], true
+}
@@ -0,0 +1,153 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type testRecord struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestCodec_MarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name        string
+		codec       Codec
+		value       interface{}
+		decoded     interface{}
+		contentType string
+		tagged      bool
+	}{
+		{
+			name:        "json",
+			codec:       JSONCodec,
+			value:       &testRecord{Name: "car", Count: 3},
+			decoded:     &testRecord{},
+			contentType: ContentTypeJSON,
+		},
+		{
+			name:        "proto",
+			codec:       ProtoCodec,
+			value:       &types.Version{BlockNum: 5, TxNum: 2},
+			decoded:     &types.Version{},
+			contentType: ContentTypeProto,
+		},
+		{
+			name:        "tagged json",
+			codec:       NewTaggedCodec(JSONCodec),
+			value:       &testRecord{Name: "car", Count: 3},
+			decoded:     &testRecord{},
+			contentType: ContentTypeJSON,
+			tagged:      true,
+		},
+		{
+			name:        "tagged proto",
+			codec:       NewTaggedCodec(ProtoCodec),
+			value:       &types.Version{BlockNum: 5, TxNum: 2},
+			decoded:     &types.Version{},
+			contentType: ContentTypeProto,
+			tagged:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.contentType, tt.codec.ContentType())
+
+			data, err := tt.codec.Marshal(tt.value)
+			require.NoError(t, err)
+			contentType, tagged := ContentTypeOf(data)
+			require.Equal(t, tt.tagged, tagged)
+			if tt.tagged {
+				require.Equal(t, tt.contentType, contentType)
+			}
+
+			err = tt.codec.Unmarshal(data, tt.decoded)
+			require.NoError(t, err)
+			if m, ok := tt.value.(proto.Message); ok {
+				require.True(t, proto.Equal(m, tt.decoded.(proto.Message)))
+			} else {
+				require.Equal(t, tt.value, tt.decoded)
+			}
+		})
+	}
+}
+
+func TestCodec_Errors(t *testing.T) {
+	_, err := ProtoCodec.Marshal(&testRecord{})
+	require.EqualError(t, err, "value of type *bcdb.testRecord is not a proto.Message")
+
+	err = ProtoCodec.Unmarshal([]byte{}, &testRecord{})
+	require.EqualError(t, err, "value of type *bcdb.testRecord is not a proto.Message")
+
+	data, err := NewTaggedCodec(JSONCodec).Marshal(&testRecord{Name: "car"})
+	require.NoError(t, err)
+	err = NewTaggedCodec(ProtoCodec).Unmarshal(data, &types.Version{})
+	require.EqualError(t, err, "value content type is application/json, expected application/x-protobuf")
+
+	_, tagged := ContentTypeOf([]byte("plain value"))
+	require.False(t, tagged)
+	_, tagged = ContentTypeOf(append([]byte{0x00, 'b', 'c', 'd', 'b', 0x01}, 0x10, 'a'))
+	require.False(t, tagged)
+}
+
+func TestDataContext_PutAndGetWithCodec(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	tx1, err := adminSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx1.PutJSON("bdb", "json", &testRecord{Name: "car", Count: 1}, nil))
+	require.NoError(t, tx1.PutProto("bdb", "proto", &types.Version{BlockNum: 7, TxNum: 1}, nil))
+	require.NoError(t, tx1.PutWithCodec("bdb", "tagged", &testRecord{Name: "bike", Count: 2}, nil, NewTaggedCodec(JSONCodec)))
+	_, _, err = tx1.Commit(true)
+	require.NoError(t, err)
+
+	tx2, err := adminSession.DataTx()
+	require.NoError(t, err)
+
+	record := &testRecord{}
+	meta, err := tx2.GetJSON("bdb", "json", record)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	require.Equal(t, &testRecord{Name: "car", Count: 1}, record)
+
+	version := &types.Version{}
+	meta, err = tx2.GetProto("bdb", "proto", version)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	require.True(t, proto.Equal(&types.Version{BlockNum: 7, TxNum: 1}, version))
+
+	// tagged values are detected by readers and decoded by the plain codec
+	value, _, err := tx2.Get("bdb", "tagged")
+	require.NoError(t, err)
+	contentType, tagged := ContentTypeOf(value)
+	require.True(t, tagged)
+	require.Equal(t, ContentTypeJSON, contentType)
+	record = &testRecord{}
+	_, err = tx2.GetJSON("bdb", "tagged", record)
+	require.NoError(t, err)
+	require.Equal(t, &testRecord{Name: "bike", Count: 2}, record)
+
+	_, err = tx2.GetProto("bdb", "tagged", version)
+	require.EqualError(t, err, "failed to decode value of key 'tagged' in database 'bdb' as application/x-protobuf: value content type is application/json, expected application/x-protobuf")
+
+	_, err = tx2.GetJSON("bdb", "proto", record)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decode value of key 'proto' in database 'bdb' as application/json")
+
+	meta, err = tx2.GetJSON("bdb", "missing", record)
+	require.NoError(t, err)
+	require.Nil(t, meta)
+}
@@ -0,0 +1,273 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// CompressionAlgorithm algorithm used by the compression value codec
+type CompressionAlgorithm string
+
+const (
+	CompressionGzip CompressionAlgorithm = "gzip"
+	CompressionZstd CompressionAlgorithm = "zstd"
+
+	// ContentTypeGzip content type tag of values compressed with gzip
+	ContentTypeGzip = "application/gzip"
+	// ContentTypeZstd content type tag of values compressed with zstd
+	ContentTypeZstd = "application/zstd"
+
+	// MaxDecompressedSize the maximal size of a decompressed value, larger values are rejected by Decode
+	// so a crafted value cannot exhaust the client memory
+	MaxDecompressedSize = 64 << 20
+)
+
+// ErrDecompressedSizeExceeded is returned by Decode for values that decompress beyond MaxDecompressedSize
+var ErrDecompressedSizeExceeded = errors.New("decompressed size exceeds the maximal size")
+
+// ErrCodecClosed is returned by a compression value codec used after it was closed
+var ErrCodecClosed = errors.New("codec closed")
+
+// CompressionValueCodec compresses values above a size threshold, and tags them
+// so Get decompresses them automatically
+type CompressionValueCodec interface {
+	ValueCodec
+	// Metrics returns the statistics of the values encoded and decoded by the codec
+	Metrics() CompressionMetrics
+	// Close releases the resources of the codec, Encode and Decode return ErrCodecClosed afterwards
+	Close()
+}
+
+// CompressionMetrics statistics of a compression value codec
+type CompressionMetrics struct {
+	// Compressed number of values stored compressed
+	Compressed uint64
+	// Skipped number of values stored as is, because they are below the
+	// threshold or do not get smaller when compressed
+	Skipped uint64
+	// Decompressed number of values decompressed
+	Decompressed uint64
+	// UncompressedBytes total size of the values stored compressed, before compression
+	UncompressedBytes uint64
+	// CompressedBytes total size of the values stored compressed, after compression
+	CompressedBytes uint64
+}
+
+// Ratio returns the achieved compression ratio, i.e. UncompressedBytes / CompressedBytes,
+// or 1 if no value was compressed
+func (m CompressionMetrics) Ratio() float64 {
+	if m.CompressedBytes == 0 {
+		return 1
+	}
+	return float64(m.UncompressedBytes) / float64(m.CompressedBytes)
+}
+
+type compressionCodec struct {
+	algorithm   CompressionAlgorithm
+	contentType string
+	threshold   int
+	maxSize     int
+	// closeMutex is held for reading while the zstd coders are used, and for writing by Close
+	closeMutex  sync.RWMutex
+	closed      bool
+	zstdEncoder *zstd.Encoder
+	// zstdDecoder is created on the first zstd value decoded
+	zstdDecoder *zstd.Decoder
+	mutex       sync.Mutex
+	metrics     CompressionMetrics
+}
+
+// NewCompressionValueCodec creates a value codec that compresses values larger than
+// threshold bytes with the given algorithm. Decode decompresses values compressed with
+// any of the supported algorithms, up to MaxDecompressedSize, and returns other values as is.
+// The codec should be closed when it is no longer used.
+func NewCompressionValueCodec(algorithm CompressionAlgorithm, threshold int) (CompressionValueCodec, error) {
+	c := &compressionCodec{
+		algorithm: algorithm,
+		threshold: threshold,
+		maxSize:   MaxDecompressedSize,
+	}
+	switch algorithm {
+	case CompressionGzip:
+		c.contentType = ContentTypeGzip
+	case CompressionZstd:
+		c.contentType = ContentTypeZstd
+		var err error
+		if c.zstdEncoder, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1)); err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd encoder")
+		}
+	default:
+		return nil, errors.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+	return c, nil
+}
+
+// Close releases the zstd encoder and decoder of the codec, Encode and Decode return ErrCodecClosed afterwards
+func (c *compressionCodec) Close() {
+	c.closeMutex.Lock()
+	defer c.closeMutex.Unlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	if c.zstdEncoder != nil {
+		c.zstdEncoder.Close()
+		c.zstdEncoder = nil
+	}
+	if c.zstdDecoder != nil {
+		c.zstdDecoder.Close()
+		c.zstdDecoder = nil
+	}
+}
+
+// Encode compresses value, if it is larger than the threshold and gets smaller when compressed
+func (c *compressionCodec) Encode(_, _ string, value []byte, _ *types.AccessControl) ([]byte, error) {
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+	if c.closed {
+		return nil, ErrCodecClosed
+	}
+
+	if len(value) <= c.threshold {
+		c.updateMetrics(func(m *CompressionMetrics) { m.Skipped++ })
+		return value, nil
+	}
+
+	var compressed []byte
+	switch c.algorithm {
+	case CompressionGzip:
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(value); err != nil {
+			return nil, errors.Wrap(err, "failed to compress value")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "failed to compress value")
+		}
+		compressed = buf.Bytes()
+	case CompressionZstd:
+		compressed = c.zstdEncoder.EncodeAll(value, nil)
+	}
+
+	tagged := tagValue(c.contentType, compressed)
+	if len(tagged) >= len(value) {
+		c.updateMetrics(func(m *CompressionMetrics) { m.Skipped++ })
+		return value, nil
+	}
+
+	c.updateMetrics(func(m *CompressionMetrics) {
+		m.Compressed++
+		m.UncompressedBytes += uint64(len(value))
+		m.CompressedBytes += uint64(len(tagged))
+	})
+	return tagged, nil
+}
+
+// Decode decompresses value, if it was compressed
+func (c *compressionCodec) Decode(_, _ string, value []byte, _ *types.Metadata) ([]byte, error) {
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+	if c.closed {
+		return nil, ErrCodecClosed
+	}
+
+	contentType, payload, tagged := untagValue(value)
+	if !tagged {
+		return value, nil
+	}
+
+	var err error
+	switch contentType {
+	case ContentTypeGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(payload)); err == nil {
+			// one byte more than the limit tells values that are too large
+			value, err = ioutil.ReadAll(io.LimitReader(r, int64(c.maxSize)+1))
+		}
+	case ContentTypeZstd:
+		var decoder *zstd.Decoder
+		if decoder, err = c.decoder(); err == nil {
+			// the decoder rejects frames whose content or window is larger than the limit
+			value, err = decoder.DecodeAll(payload, nil)
+			if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+				err = ErrDecompressedSizeExceeded
+			}
+		}
+	default:
+		return value, nil
+	}
+	if err == nil && len(value) > c.maxSize {
+		err = ErrDecompressedSizeExceeded
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s value", contentType)
+	}
+
+	c.updateMetrics(func(m *CompressionMetrics) { m.Decompressed++ })
+	return value, nil
+}
+
+func (c *compressionCodec) decoder() (*zstd.Decoder, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.zstdDecoder == nil {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(c.maxSize)))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd decoder")
+		}
+		c.zstdDecoder = decoder
+	}
+	return c.zstdDecoder, nil
+}
+
+// Metrics returns the statistics of the values encoded and decoded by the codec
+func (c *compressionCodec) Metrics() CompressionMetrics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.metrics
+}
+
+func (c *compressionCodec) updateMetrics(update func(m *CompressionMetrics)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	update(&c.metrics)
+}
+
+// ChainValueCodecs combines several value codecs into one. Values are encoded by the codecs in the
+// given order, and decoded in the reverse order, e.g. ChainValueCodecs(compression, encryption)
+// compresses values before they are encrypted.
+func ChainValueCodecs(codecs ...ValueCodec) ValueCodec {
+	return valueCodecChain(codecs)
+}
+
+type valueCodecChain []ValueCodec
+
+func (c valueCodecChain) Encode(dbName, key string, value []byte, acl *types.AccessControl) ([]byte, error) {
+	var err error
+	for _, codec := range c {
+		if value, err = codec.Encode(dbName, key, value, acl); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func (c valueCodecChain) Decode(dbName, key string, value []byte, metadata *types.Metadata) ([]byte, error) {
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if value, err = c[i].Decode(dbName, key, value, metadata); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
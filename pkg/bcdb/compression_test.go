@@ -0,0 +1,249 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionCodec_EncodeDecode(t *testing.T) {
+	largeValue := bytes.Repeat([]byte("orion value "), 100)
+	randomValue := make([]byte, 1000)
+	_, err := rand.Read(randomValue)
+	require.NoError(t, err)
+
+	tests := []struct {
+		algorithm   CompressionAlgorithm
+		contentType string
+	}{
+		{
+			algorithm:   CompressionGzip,
+			contentType: ContentTypeGzip,
+		},
+		{
+			algorithm:   CompressionZstd,
+			contentType: ContentTypeZstd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			codec, err := NewCompressionValueCodec(tt.algorithm, 64)
+			require.NoError(t, err)
+			defer codec.Close()
+
+			encoded, err := codec.Encode("bdb", "key1", largeValue, nil)
+			require.NoError(t, err)
+			require.True(t, len(encoded) < len(largeValue))
+			contentType, tagged := ContentTypeOf(encoded)
+			require.True(t, tagged)
+			require.Equal(t, tt.contentType, contentType)
+
+			decoded, err := codec.Decode("bdb", "key1", encoded, nil)
+			require.NoError(t, err)
+			require.Equal(t, largeValue, decoded)
+
+			// below threshold
+			encoded, err = codec.Encode("bdb", "key2", []byte("small value"), nil)
+			require.NoError(t, err)
+			require.Equal(t, []byte("small value"), encoded)
+
+			// not compressible
+			encoded, err = codec.Encode("bdb", "key3", randomValue, nil)
+			require.NoError(t, err)
+			require.Equal(t, randomValue, encoded)
+
+			decoded, err = codec.Decode("bdb", "key3", encoded, nil)
+			require.NoError(t, err)
+			require.Equal(t, randomValue, decoded)
+
+			metrics := codec.Metrics()
+			require.Equal(t, uint64(1), metrics.Compressed)
+			require.Equal(t, uint64(2), metrics.Skipped)
+			require.Equal(t, uint64(1), metrics.Decompressed)
+			require.Equal(t, uint64(len(largeValue)), metrics.UncompressedBytes)
+			require.True(t, metrics.Ratio() > 1)
+		})
+	}
+
+	// values compressed by one algorithm are decompressed by a codec of another
+	gzipCodec, err := NewCompressionValueCodec(CompressionGzip, 0)
+	require.NoError(t, err)
+	defer gzipCodec.Close()
+	zstdCodec, err := NewCompressionValueCodec(CompressionZstd, 0)
+	require.NoError(t, err)
+	defer zstdCodec.Close()
+	encoded, err := gzipCodec.Encode("bdb", "key1", largeValue, nil)
+	require.NoError(t, err)
+	decoded, err := zstdCodec.Decode("bdb", "key1", encoded, nil)
+	require.NoError(t, err)
+	require.Equal(t, largeValue, decoded)
+
+	_, err = zstdCodec.Decode("bdb", "key1", tagValue(ContentTypeGzip, []byte("corrupted")), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decompress application/gzip value")
+
+	_, err = NewCompressionValueCodec("lz4", 0)
+	require.EqualError(t, err, "unsupported compression algorithm: lz4")
+	require.Equal(t, float64(1), CompressionMetrics{}.Ratio())
+}
+
+func TestCompressionCodec_Resources(t *testing.T) {
+	largeValue := bytes.Repeat([]byte("orion value "), 100)
+
+	// a gzip codec creates a zstd decoder only to decode zstd values
+	codec, err := NewCompressionValueCodec(CompressionGzip, 0)
+	require.NoError(t, err)
+	gzipCodec := codec.(*compressionCodec)
+	require.Nil(t, gzipCodec.zstdEncoder)
+	encoded, err := gzipCodec.Encode("bdb", "key1", largeValue, nil)
+	require.NoError(t, err)
+	_, err = gzipCodec.Decode("bdb", "key1", encoded, nil)
+	require.NoError(t, err)
+	require.Nil(t, gzipCodec.zstdDecoder)
+
+	codec, err = NewCompressionValueCodec(CompressionZstd, 0)
+	require.NoError(t, err)
+	zstdCodec := codec.(*compressionCodec)
+	zstdEncoded, err := zstdCodec.Encode("bdb", "key1", largeValue, nil)
+	require.NoError(t, err)
+	decoded, err := gzipCodec.Decode("bdb", "key1", zstdEncoded, nil)
+	require.NoError(t, err)
+	require.Equal(t, largeValue, decoded)
+	require.NotNil(t, gzipCodec.zstdDecoder)
+
+	gzipCodec.Close()
+	zstdCodec.Close()
+	require.Nil(t, gzipCodec.zstdDecoder)
+	require.Nil(t, zstdCodec.zstdEncoder)
+
+	// a closed codec is not used anymore
+	_, err = zstdCodec.Encode("bdb", "key1", largeValue, nil)
+	require.Equal(t, ErrCodecClosed, err)
+	_, err = gzipCodec.Decode("bdb", "key1", zstdEncoded, nil)
+	require.Equal(t, ErrCodecClosed, err)
+	require.Nil(t, gzipCodec.zstdDecoder)
+
+	// values decompressed beyond the limit are rejected
+	codec, err = NewCompressionValueCodec(CompressionGzip, 0)
+	require.NoError(t, err)
+	defer codec.Close()
+	limited := codec.(*compressionCodec)
+	limited.maxSize = len(largeValue) - 1
+	_, err = limited.Decode("bdb", "key1", encoded, nil)
+	require.EqualError(t, err, "failed to decompress application/gzip value: decompressed size exceeds the maximal size")
+	require.True(t, errors.Is(err, ErrDecompressedSizeExceeded))
+	_, err = limited.Decode("bdb", "key1", zstdEncoded, nil)
+	require.EqualError(t, err, "failed to decompress application/zstd value: decompressed size exceeds the maximal size")
+	require.True(t, errors.Is(err, ErrDecompressedSizeExceeded))
+
+	limited.maxSize = len(largeValue)
+	decoded, err = limited.Decode("bdb", "key1", encoded, nil)
+	require.NoError(t, err)
+	require.Equal(t, largeValue, decoded)
+}
+
+func TestCompressionCodec_CloseWhileEncoding(t *testing.T) {
+	codec, err := NewCompressionValueCodec(CompressionZstd, 0)
+	require.NoError(t, err)
+	largeValue := bytes.Repeat([]byte("orion value "), 100)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := codec.Encode("bdb", "key1", largeValue, nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	codec.Close()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Equal(t, ErrCodecClosed, err)
+	}
+
+	_, err = codec.Encode("bdb", "key1", largeValue, nil)
+	require.Equal(t, ErrCodecClosed, err)
+}
+
+func TestChainValueCodecs(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	encryption := newTestEncryptionCodec(t, "alice", privateKey, nil)
+	compression, err := NewCompressionValueCodec(CompressionZstd, 0)
+	require.NoError(t, err)
+	defer compression.Close()
+	codec := ChainValueCodecs(compression, encryption)
+
+	largeValue := bytes.Repeat([]byte("orion value "), 100)
+	encoded, err := codec.Encode("bdb", "key1", largeValue, &types.AccessControl{ReadWriteUsers: map[string]bool{"alice": true}})
+	require.NoError(t, err)
+	contentType, _ := ContentTypeOf(encoded)
+	require.Equal(t, ContentTypeEncrypted, contentType)
+	require.Equal(t, uint64(1), compression.Metrics().Compressed)
+
+	decoded, err := codec.Decode("bdb", "key1", encoded, nil)
+	require.NoError(t, err)
+	require.Equal(t, largeValue, decoded)
+}
+
+func TestDataContext_PutAndGetCompressed(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	codec, err := NewCompressionValueCodec(CompressionGzip, 1024)
+	require.NoError(t, err)
+	defer codec.Close()
+	largeValue := bytes.Repeat([]byte("orion value "), 1000)
+
+	tx, err := adminSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(codec)
+	require.NoError(t, tx.Put("bdb", "large", largeValue, nil))
+	require.NoError(t, tx.Put("bdb", "small", []byte("small value"), nil))
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+
+	tx, err = adminSession.DataTx()
+	require.NoError(t, err)
+	rawValue, _, err := tx.Get("bdb", "large")
+	require.NoError(t, err)
+	require.True(t, len(rawValue) < len(largeValue))
+
+	tx, err = adminSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(codec)
+	value, _, err := tx.Get("bdb", "large")
+	require.NoError(t, err)
+	require.Equal(t, largeValue, value)
+	value, _, err = tx.Get("bdb", "small")
+	require.NoError(t, err)
+	require.Equal(t, []byte("small value"), value)
+
+	metrics := codec.Metrics()
+	require.Equal(t, uint64(1), metrics.Compressed)
+	require.Equal(t, uint64(1), metrics.Skipped)
+	require.Equal(t, uint64(1), metrics.Decompressed)
+	require.True(t, metrics.Ratio() > 10)
+}
@@ -19,8 +19,33 @@ type DataTxContext interface {
 	Get(dbName, key string) ([]byte, *types.Metadata, error)
 	// Delete value for key
 	Delete(dbName, key string) error
+	// PutWithCodec encodes v with codec and puts it as the new value of key
+	PutWithCodec(dbName, key string, v interface{}, acl *types.AccessControl, codec Codec) error
+	// GetWithCodec gets existing key value and decodes it with codec into v.
+	// If the key does not exist, v is left untouched and nil metadata is returned
+	GetWithCodec(dbName, key string, v interface{}, codec Codec) (*types.Metadata, error)
+	// PutJSON encodes v to JSON and puts it as the new value of key
+	PutJSON(dbName, key string, v interface{}, acl *types.AccessControl) error
+	// GetJSON gets existing key value and decodes it from JSON into v
+	GetJSON(dbName, key string, v interface{}) (*types.Metadata, error)
+	// PutProto encodes protobuf message m and puts it as the new value of key
+	PutProto(dbName, key string, m proto.Message, acl *types.AccessControl) error
+	// GetProto gets existing key value and decodes it into protobuf message m
+	GetProto(dbName, key string, m proto.Message) (*types.Metadata, error)
 	// AssertRead insert a key-version to the transaction assert map
 	AssertRead(dbName string, key string, version *types.Version) error
+	// SetValueCodec sets a codec that transforms values put to and get from
+	// the database within the transaction, e.g. to compress or encrypt values. Nil codec
+	// stores values as is.
+	SetValueCodec(codec ValueCodec)
+	// PutIfVersion puts new value to key only if the committed version of the key
+	// is still the given version. If the key was changed meanwhile, Commit returns
+	// an error that matches ErrVersionMismatch
+	PutIfVersion(dbName, key string, value []byte, acl *types.AccessControl, version *types.Version) error
+	// PutIfAbsent puts new value to key only if the key does not exist
+	PutIfAbsent(dbName, key string, value []byte, acl *types.AccessControl) error
+	// DeleteIfVersion deletes the key only if its committed version is still the given version
+	DeleteIfVersion(dbName, key string, version *types.Version) error
 	// AddMustSignUser adds userID to the multi-sign data transaction's
 	// MustSignUserIDs set. All users in the MustSignUserIDs set must co-sign
 	// the transaction for it to be valid. Note that, in addition, when a
@@ -45,6 +70,7 @@ type dataTxContext struct {
 	*commonTxContext
 	operations map[string]*dbOperations
 	txUsers    map[string]bool
+	valueCodec ValueCodec
 }
 
 func (d *dataTxContext) Commit(sync bool) (string, *types.TxReceipt, error) {
@@ -67,6 +93,14 @@ func (d *dataTxContext) Put(dbName, key string, value []byte, acl *types.AccessC
 		d.operations[dbName] = ops
 	}
 
+	if d.valueCodec != nil {
+		var err error
+		if value, err = d.valueCodec.Encode(dbName, key, value, acl); err != nil {
+			d.logger.Errorf("failed to encode value of key %s in database %s, due to %s", key, dbName, err)
+			return errors.Wrapf(err, "failed to encode value of key '%s' in database '%s'", key, dbName)
+		}
+	}
+
 	_, deleteExist := ops.dataDeletes[key]
 	if deleteExist {
 		delete(ops.dataDeletes, key)
@@ -94,7 +128,7 @@ func (d *dataTxContext) Get(dbName, key string) ([]byte, *types.Metadata, error)
 			return nil, nil, errors.Errorf("can not execute Get and AssertRead for the same key '" + key + "' in the same transaction")
 		}
 		if storedValue, ok := ops.dataReads[key]; ok {
-			return storedValue.GetValue(), storedValue.GetMetadata(), nil
+			return d.decodeValue(dbName, key, storedValue)
 		}
 	}
 
@@ -119,7 +153,20 @@ func (d *dataTxContext) Get(dbName, key string) ([]byte, *types.Metadata, error)
 
 	res := resEnv.GetResponse()
 	ops.dataReads[key] = res
-	return res.GetValue(), res.GetMetadata(), nil
+	return d.decodeValue(dbName, key, res)
+}
+
+func (d *dataTxContext) decodeValue(dbName, key string, res *types.GetDataResponse) ([]byte, *types.Metadata, error) {
+	if d.valueCodec == nil || res.GetValue() == nil {
+		return res.GetValue(), res.GetMetadata(), nil
+	}
+
+	value, err := d.valueCodec.Decode(dbName, key, res.GetValue(), res.GetMetadata())
+	if err != nil {
+		d.logger.Errorf("failed to decode value of key %s in database %s, due to %s", key, dbName, err)
+		return nil, nil, errors.Wrapf(err, "failed to decode value of key '%s' in database '%s'", key, dbName)
+	}
+	return value, res.GetMetadata(), nil
 }
 
 // Delete value for key
@@ -144,6 +191,57 @@ func (d *dataTxContext) Delete(dbName, key string) error {
 	return nil
 }
 
+// PutWithCodec encodes v with codec and puts it as the new value of key
+func (d *dataTxContext) PutWithCodec(dbName, key string, v interface{}, acl *types.AccessControl, codec Codec) error {
+	if d.txSpent {
+		return ErrTxSpent
+	}
+
+	value, err := codec.Marshal(v)
+	if err != nil {
+		d.logger.Errorf("failed to encode value of key %s in database %s as %s, due to %s", key, dbName, codec.ContentType(), err)
+		return errors.Wrapf(err, "failed to encode value of key '%s' in database '%s' as %s", key, dbName, codec.ContentType())
+	}
+	return d.Put(dbName, key, value, acl)
+}
+
+// GetWithCodec gets existing key value and decodes it with codec into v
+func (d *dataTxContext) GetWithCodec(dbName, key string, v interface{}, codec Codec) (*types.Metadata, error) {
+	value, metadata, err := d.Get(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return metadata, nil
+	}
+
+	if err = decodeWithCodec(codec, value, v); err != nil {
+		d.logger.Errorf("failed to decode value of key %s in database %s as %s, due to %s", key, dbName, codec.ContentType(), err)
+		return nil, errors.Wrapf(err, "failed to decode value of key '%s' in database '%s' as %s", key, dbName, codec.ContentType())
+	}
+	return metadata, nil
+}
+
+// PutJSON encodes v to JSON and puts it as the new value of key
+func (d *dataTxContext) PutJSON(dbName, key string, v interface{}, acl *types.AccessControl) error {
+	return d.PutWithCodec(dbName, key, v, acl, JSONCodec)
+}
+
+// GetJSON gets existing key value and decodes it from JSON into v
+func (d *dataTxContext) GetJSON(dbName, key string, v interface{}) (*types.Metadata, error) {
+	return d.GetWithCodec(dbName, key, v, JSONCodec)
+}
+
+// PutProto encodes protobuf message m and puts it as the new value of key
+func (d *dataTxContext) PutProto(dbName, key string, m proto.Message, acl *types.AccessControl) error {
+	return d.PutWithCodec(dbName, key, m, acl, ProtoCodec)
+}
+
+// GetProto gets existing key value and decodes it into protobuf message m
+func (d *dataTxContext) GetProto(dbName, key string, m proto.Message) (*types.Metadata, error) {
+	return d.GetWithCodec(dbName, key, m, ProtoCodec)
+}
+
 // AssertRead insert a key-version to the transaction assert map
 func (d *dataTxContext) AssertRead(dbName string, key string, version *types.Version) error {
 	if d.txSpent {
@@ -172,6 +270,57 @@ func (d *dataTxContext) AssertRead(dbName string, key string, version *types.Ver
 	return nil
 }
 
+// PutIfVersion puts new value to key only if the committed version of the key is still the given version
+func (d *dataTxContext) PutIfVersion(dbName, key string, value []byte, acl *types.AccessControl, version *types.Version) error {
+	if err := d.assertVersion(dbName, key, version); err != nil {
+		return err
+	}
+	return d.Put(dbName, key, value, acl)
+}
+
+// PutIfAbsent puts new value to key only if the key does not exist, i.e. its version is nil
+func (d *dataTxContext) PutIfAbsent(dbName, key string, value []byte, acl *types.AccessControl) error {
+	return d.PutIfVersion(dbName, key, value, acl, nil)
+}
+
+// DeleteIfVersion deletes the key only if its committed version is still the given version
+func (d *dataTxContext) DeleteIfVersion(dbName, key string, version *types.Version) error {
+	if err := d.assertVersion(dbName, key, version); err != nil {
+		return err
+	}
+	return d.Delete(dbName, key)
+}
+
+// assertVersion adds the key-version to the transaction read set, unless the key version is
+// already known to the transaction, in which case the versions are compared locally
+func (d *dataTxContext) assertVersion(dbName, key string, version *types.Version) error {
+	if d.txSpent {
+		return ErrTxSpent
+	}
+
+	if ops, ok := d.operations[dbName]; ok {
+		if storedValue, ok := ops.dataReads[key]; ok {
+			if !proto.Equal(storedValue.GetMetadata().GetVersion(), version) {
+				return errors.WithMessagef(ErrVersionMismatch, "key '%s' in database '%s' was read at version %s", key, dbName, storedValue.GetMetadata().GetVersion())
+			}
+			return nil
+		}
+		if currentVersion, ok := ops.dataAsserts[key]; ok {
+			if !proto.Equal(currentVersion, version) {
+				return errors.WithMessagef(ErrVersionMismatch, "key '%s' in database '%s' is already asserted at version %s", key, dbName, currentVersion)
+			}
+			return nil
+		}
+	}
+
+	return d.AssertRead(dbName, key, version)
+}
+
+// SetValueCodec sets a codec that transforms values put to and get from the database within the transaction
+func (d *dataTxContext) SetValueCodec(codec ValueCodec) {
+	d.valueCodec = codec
+}
+
 func (d *dataTxContext) AddMustSignUser(userID string) {
 	d.txUsers[userID] = true
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/hyperledger-labs/orion-server/pkg/server"
 	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
 	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -521,6 +522,149 @@ func TestDataContext_GetAndAssertReadForTheSameKeyInTx(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestDataContext_PutIfVersion(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	putKeySync(t, "bdb", "key1", "value1", "admin", adminSession)
+
+	tx1, err := adminSession.DataTx()
+	require.NoError(t, err)
+	_, metaData, err := tx1.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.NotNil(t, metaData)
+	version := metaData.GetVersion()
+	require.NoError(t, tx1.Abort())
+
+	tx2, err := adminSession.DataTx()
+	require.NoError(t, err)
+	err = tx2.PutIfVersion("bdb", "key1", []byte("value2"), nil, version)
+	require.NoError(t, err)
+	_, _, err = tx2.Commit(true)
+	require.NoError(t, err)
+	validateValue(t, "key1", "value2", adminSession)
+
+	// key1 was updated by tx2, version is stale
+	tx3, err := adminSession.DataTx()
+	require.NoError(t, err)
+	err = tx3.PutIfVersion("bdb", "key1", []byte("value3"), nil, version)
+	require.NoError(t, err)
+	txID, receipt, err := tx3.Commit(true)
+	require.Error(t, err)
+	require.NotNil(t, receipt)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+	require.Equal(t, "transaction txID = "+txID+" is not valid, flag: INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE,"+
+		" reason: mvcc conflict has occurred as the committed state for the key [key1] in database [bdb] changed", err.Error())
+	validateValue(t, "key1", "value2", adminSession)
+
+	// version known locally from Get
+	tx4, err := adminSession.DataTx()
+	require.NoError(t, err)
+	_, _, err = tx4.Get("bdb", "key1")
+	require.NoError(t, err)
+	err = tx4.PutIfVersion("bdb", "key1", []byte("value4"), nil, version)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+	require.Contains(t, err.Error(), "key 'key1' in database 'bdb' was read at version")
+}
+
+func TestDataContext_PutIfAbsent(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	tx1, err := adminSession.DataTx()
+	require.NoError(t, err)
+	err = tx1.PutIfAbsent("bdb", "key1", []byte("value1"), nil)
+	require.NoError(t, err)
+	_, _, err = tx1.Commit(true)
+	require.NoError(t, err)
+	validateValue(t, "key1", "value1", adminSession)
+
+	tx2, err := adminSession.DataTx()
+	require.NoError(t, err)
+	err = tx2.PutIfAbsent("bdb", "key1", []byte("value2"), nil)
+	require.NoError(t, err)
+	_, receipt, err := tx2.Commit(true)
+	require.Error(t, err)
+	require.NotNil(t, receipt)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+	validateValue(t, "key1", "value1", adminSession)
+}
+
+func TestDataContext_DeleteIfVersion(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	receipt := putKeySync(t, "bdb", "key1", "value1", "admin", adminSession)
+	version := &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	}
+	putKeySync(t, "bdb", "key1", "value2", "admin", adminSession)
+
+	tx1, err := adminSession.DataTx()
+	require.NoError(t, err)
+	err = tx1.DeleteIfVersion("bdb", "key1", version)
+	require.NoError(t, err)
+	_, _, err = tx1.Commit(true)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+	validateValue(t, "key1", "value2", adminSession)
+
+	tx2, err := adminSession.DataTx()
+	require.NoError(t, err)
+	_, metaData, err := tx2.Get("bdb", "key1")
+	require.NoError(t, err)
+	err = tx2.DeleteIfVersion("bdb", "key1", metaData.GetVersion())
+	require.NoError(t, err)
+	_, _, err = tx2.Commit(true)
+	require.NoError(t, err)
+
+	tx3, err := adminSession.DataTx()
+	require.NoError(t, err)
+	val, _, err := tx3.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.Nil(t, val)
+}
+
+func TestDataContext_CompareAndSwap(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	_, receipt, err := adminSession.CompareAndSwap("bdb", "key1", nil, []byte("value1"), nil)
+	require.NoError(t, err)
+	require.NotNil(t, receipt)
+	validateValue(t, "key1", "value1", adminSession)
+	version := &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	}
+
+	_, receipt, err = adminSession.CompareAndSwap("bdb", "key1", nil, []byte("value2"), nil)
+	require.Error(t, err)
+	require.NotNil(t, receipt)
+	require.True(t, errors.Is(err, ErrVersionMismatch))
+	require.Contains(t, err.Error(), "compare and swap of key 'key1' in database 'bdb'")
+
+	_, _, err = adminSession.CompareAndSwap("bdb", "key1", version, []byte("value3"), nil)
+	require.NoError(t, err)
+	validateValue(t, "key1", "value3", adminSession)
+}
+
 func TestDataContext_ConstructEnvelopeForMultiSign(t *testing.T) {
 	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
 	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
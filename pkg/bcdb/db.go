@@ -3,6 +3,7 @@
 package bcdb
 
 import (
+	"context"
 	"encoding/pem"
 	"io/ioutil"
 	"net/url"
@@ -33,6 +34,21 @@ type DBSession interface {
 	ConfigTx() (ConfigTxContext, error)
 	Provenance() (Provenance, error)
 	Ledger() (Ledger, error)
+	// BlockListener starts a listener that delivers an event for every committed block, from
+	// config.StartBlock on. The listener stops when ctx is done or when it is stopped.
+	BlockListener(ctx context.Context, config *BlockListenerConfig) (BlockListener, error)
+	// Watch delivers every new value of key committed after fromVersion, as well as its deletion,
+	// until ctx is done. A nil config means the key is polled every DefaultWatchPollInterval.
+	Watch(ctx context.Context, dbName, key string, fromVersion *types.Version, config *WatchConfig) (<-chan *KeyChange, error)
+	// CompareAndSwap replaces the value of a single key, only if the committed version
+	// of the key is still the expected version, nil expected version means the key must
+	// not exist. The transaction is committed synchronously, and ErrVersionMismatch is
+	// returned if the key was changed.
+	CompareAndSwap(dbName, key string, expected *types.Version, value []byte, acl *types.AccessControl) (string, *types.TxReceipt, error)
+	// RestoreVersion writes the value and ACL the key had at version back to the key, in a new
+	// transaction that asserts the current version of the key. The transaction is committed
+	// synchronously, and ErrVersionMismatch is returned if the key was changed meanwhile.
+	RestoreVersion(dbName, key string, version *types.Version) (string, *types.TxReceipt, error)
 }
 
 var ErrTxSpent = errors.New("transaction committed or aborted")
@@ -52,6 +68,9 @@ type TxContext interface {
 	CommittedTxEnvelope() (proto.Message, error)
 }
 
+// the Ledger and Provenance mocks refer to bcdb types, so they are kept out of package mocks, which the bcdb tests import
+//go:generate mockery --dir . --name Ledger --case underscore --output mocks/bcdbmocks --outpkg bcdbmocks
+
 type Ledger interface {
 	// GetBlockHeader returns block header from ledger
 	GetBlockHeader(blockNum uint64) (*types.BlockHeader, error)
@@ -65,8 +84,24 @@ type Ledger interface {
 	// GetDataProof returns proof of existence of value associated with key in block Merkle-Patricia Trie
 	// Proof itself is a path from node that contains value to root node in MPTrie
 	GetDataProof(blockNum uint64, dbName, key string, isDeleted bool) (*state.Proof, error)
+	// VerifyTransaction verifies that tx, committed as described by receipt, is part of the ledger: the tx is
+	// included in the tx merkle tree of the receipt's block header, and the header is connected by a verified
+	// ledger path to anchor, a trusted block header. If anchor is nil the genesis block header is used.
+	// Verification failures are described by the returned report, errors are returned only if the
+	// verification could not be carried out.
+	VerifyTransaction(tx proto.Message, receipt *types.TxReceipt, anchor *types.BlockHeader) (*TxVerificationReport, error)
+	// ProveValue fetches and verifies the proof that key held value in the state of block blockNum
+	ProveValue(dbName, key string, value []byte, blockNum uint64) (*StateProof, error)
+	// ProveDeleted fetches and verifies the proof that key was deleted in the state of block blockNum,
+	// the deleted value is looked up in the key's history
+	ProveDeleted(dbName, key string, blockNum uint64) (*StateProof, error)
+	// CollectEvidence collects an evidence bundle of tx, committed as described by receipt, including
+	// the proofs of keys at the block of tx. The bundle is verified offline by VerifyBundle.
+	CollectEvidence(tx proto.Message, receipt *types.TxReceipt, keys []*EvidenceKey) (*EvidenceBundle, error)
 }
 
+//go:generate mockery --dir . --name Provenance --case underscore --output mocks/bcdbmocks --outpkg bcdbmocks
+
 type Provenance interface {
 	// GetHistoricalData return all historical values for specific dn and key
 	// Value returned with its associated metadata, including block number, tx index, etc
@@ -85,8 +120,52 @@ type Provenance interface {
 	GetReaders(dbName, key string) ([]string, error)
 	// GetWriters returns all users who wrote value associated with the key
 	GetWriters(dbName, key string) ([]string, error)
+	// GetReadersWithCounts returns the users who read the key and the number of their reads,
+	// ordered by descending count and then by user ID
+	GetReadersWithCounts(dbName, key string) ([]*UserAccessCount, error)
+	// GetWritersWithCounts returns the users who wrote the key and the number of their writes,
+	// ordered by descending count and then by user ID
+	GetWritersWithCounts(dbName, key string) ([]*UserAccessCount, error)
+	// GetKeyAccessSummary combines the readers, writers and most recent version of the key
+	GetKeyAccessSummary(dbName, key string) (*KeyAccessSummary, error)
 	// GetTxIDsSubmittedByUser IDs of all tx submitted by user
 	GetTxIDsSubmittedByUser(userID string) ([]string, error)
+	// GetDeletedValues returns the values of key that were deleted, along with the versions they were written at
+	GetDeletedValues(dbName, key string) ([]*types.ValueWithMetadata, error)
+	// GetAsOfBlock returns the most recent value of key written at or before block blockNum, nil if the key
+	// was not written up to the block or was deleted at or before the block
+	GetAsOfBlock(dbName, key string, blockNum uint64) (*types.ValueWithMetadata, error)
+	// GetBeforeTx returns the most recent value of key written before tx txID, nil if there is none or it
+	// was deleted before the block of the tx
+	GetBeforeTx(dbName, key, txID string) (*types.ValueWithMetadata, error)
+	// GetBeforeVersion is GetBeforeTx of the tx at the block number and tx index of version, e.g. taken
+	// from the receipt of the tx
+	GetBeforeVersion(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error)
+	// SnapshotAt returns a read-only view of the database state as of block blockNum, which must be committed
+	SnapshotAt(blockNum uint64) (Snapshot, error)
+	// IterateHistoricalData returns an iterator over the historical values of key, filtered by block range
+	IterateHistoricalData(dbName, key string, opts *ProvenanceQueryOptions) (HistoricalDataIterator, error)
+	// IterateDataWrittenByUser returns an iterator over the user writes, filtered by database and block range
+	IterateDataWrittenByUser(userID string, opts *ProvenanceQueryOptions) (KVIterator, error)
+	// IterateDataReadByUser returns an iterator over the user reads, filtered by database and block range
+	IterateDataReadByUser(userID string, opts *ProvenanceQueryOptions) (KVIterator, error)
+	// IterateTxIDsSubmittedByUser returns an iterator over the IDs of the txs submitted by user, filtered by block range
+	IterateTxIDsSubmittedByUser(userID string, opts *ProvenanceQueryOptions) (TxIDIterator, error)
+	// Diff compares the values and ACLs of key at versions from and to. JSON values are compared
+	// structurally, any other values byte by byte.
+	Diff(dbName, key string, from, to *types.Version) (*KeyDiff, error)
+	// VerifyHistoricalData checks every historical value of key against the state proof of the block in
+	// its version, the returned report flags the values the ledger does not back. A value overwritten by a
+	// later tx of the same block is not part of the state of any block, so it is checked against the tx that
+	// wrote it, whose envelope is looked up by envelopes by the value's version, e.g. in envelopes kept
+	// after commit. If envelopes is nil or has no envelope of the tx the value is reported as unverified.
+	VerifyHistoricalData(dbName, key string, envelopes func(version *types.Version) (*types.DataTxEnvelope, error)) (*HistoryVerificationReport, error)
+	// GetTxDataChanges returns the values the committed data tx of env read, at the versions recorded in its
+	// read set, along with the values it wrote or deleted and the values of those keys before the tx
+	GetTxDataChanges(env *types.DataTxEnvelope) (*TxDataChanges, error)
+	// GetTxDataChangesByID is GetTxDataChanges of tx txID. The SDK cannot fetch tx envelopes from the
+	// server, so the envelope is looked up by envelopes, e.g. in envelopes kept after commit.
+	GetTxDataChangesByID(txID string, envelopes func(txID string) (*types.DataTxEnvelope, error)) (*TxDataChanges, error)
 }
 
 //go:generate mockery --dir . --name Signer --case underscore --output mocks/
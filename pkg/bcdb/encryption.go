@@ -0,0 +1,354 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/pkg/crypto"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ContentTypeEncrypted content type tag of values encrypted by the encryption value codec
+	ContentTypeEncrypted = "application/vnd.orion.encrypted+json"
+
+	// DefaultPublicKeyCacheTTL how long the public key of a user fetched via GetUser is cached by the
+	// encryption value codec, before it is fetched again to pick up certificate rotations
+	DefaultPublicKeyCacheTTL = 10 * time.Minute
+
+	encryptionAlgorithm = "AES-256-GCM/ECIES-SHA256"
+	dataKeySize         = 32
+)
+
+// EncryptionValueCodec encrypts values on the client side, see NewEncryptionValueCodec
+type EncryptionValueCodec interface {
+	ValueCodec
+	// AddRecipient pins the DER encoded certificate of a user, the public key of the certificate is used to
+	// encrypt values for the user instead of fetching it via GetUser, until it is invalidated
+	AddRecipient(userID string, certificate []byte) error
+	// InvalidatePublicKeys drops the cached and pinned public keys of the given users, or of all users if none
+	// is given, so they are fetched again on the next Encode, e.g. after a certificate rotation
+	InvalidatePublicKeys(userIDs ...string)
+}
+
+// encryptedValue is the envelope stored in the database instead of the plaintext value. The value
+// is encrypted with a random data key, and the data key is wrapped for each user in the read ACL
+type encryptedValue struct {
+	Algorithm  string                 `json:"alg"`
+	Nonce      []byte                 `json:"nonce"`
+	Ciphertext []byte                 `json:"ciphertext"`
+	Keys       map[string]*wrappedKey `json:"keys"`
+}
+
+type wrappedKey struct {
+	EphemeralPublicKey []byte `json:"epk"`
+	Nonce              []byte `json:"nonce"`
+	Key                []byte `json:"key"`
+}
+
+type encryptionCodec struct {
+	userID     string
+	privateKey *ecdsa.PrivateKey
+	session    DBSession
+	ttl        time.Duration
+	now        func() time.Time
+	mutex      sync.Mutex
+	publicKeys map[string]*cachedPublicKey
+}
+
+type cachedPublicKey struct {
+	key *ecdsa.PublicKey
+	// expires zero for pinned keys, which do not expire
+	expires time.Time
+}
+
+// NewEncryptionValueCodec creates a value codec that encrypts values on the client side. Each value is
+// encrypted with its own data key, and the data key is wrapped for every user in the read and read-write
+// ACL of the key, and for the writing user, using the public key of the user's certificate, fetched via
+// GetUser. Values are decrypted by Get using the private key of the user, given in userConfig.
+// The server returns a user only to admins and to the users in the user's ACL; the certificates of
+// other readers must be pinned by AddRecipient. Fetched public keys are cached for
+// DefaultPublicKeyCacheTTL. Values put with a nil ACL are rejected, as their readers are unknown.
+// Note that the ledger, provenance and proofs keep working over the stored ciphertext, and a user added
+// to the ACL later can decrypt only the values written after the change.
+func NewEncryptionValueCodec(session DBSession, userConfig *config.UserConfig) (EncryptionValueCodec, error) {
+	keyBytes, err := ioutil.ReadFile(userConfig.PrivateKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read user's private key")
+	}
+	keyLoader := crypto.KeyLoader{}
+	key, err := keyLoader.Load(keyBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load user's private key")
+	}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("user's private key of type %T is not supported", key)
+	}
+
+	return &encryptionCodec{
+		userID:     userConfig.UserID,
+		privateKey: privateKey,
+		session:    session,
+		ttl:        DefaultPublicKeyCacheTTL,
+		now:        time.Now,
+		publicKeys: map[string]*cachedPublicKey{},
+	}, nil
+}
+
+// AddRecipient pins the certificate of a user, whose public key is used to encrypt values for the user
+func (e *encryptionCodec) AddRecipient(userID string, certificate []byte) error {
+	publicKey, err := certificatePublicKey(userID, certificate)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.publicKeys[userID] = &cachedPublicKey{key: publicKey}
+	return nil
+}
+
+// InvalidatePublicKeys drops the public keys of the given users, or of all users
+func (e *encryptionCodec) InvalidatePublicKeys(userIDs ...string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if len(userIDs) == 0 {
+		e.publicKeys = map[string]*cachedPublicKey{}
+		return
+	}
+	for _, userID := range userIDs {
+		delete(e.publicKeys, userID)
+	}
+}
+
+// Encode encrypts value and wraps its data key for the readers of the key
+func (e *encryptionCodec) Encode(dbName, key string, value []byte, acl *types.AccessControl) ([]byte, error) {
+	if acl == nil {
+		return nil, errors.Errorf("value of key '%s' in database '%s' has no ACL, the readers to encrypt the value for are unknown", key, dbName)
+	}
+	readers := map[string]bool{
+		e.userID: true,
+	}
+	// users set to false in the ACL are not readers
+	for userID, ok := range acl.GetReadUsers() {
+		if ok {
+			readers[userID] = true
+		}
+	}
+	for userID, ok := range acl.GetReadWriteUsers() {
+		if ok {
+			readers[userID] = true
+		}
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	aad, err := state.ConstructCompositeKey(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := sealAESGCM(dataKey, value, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	encValue := &encryptedValue{
+		Algorithm:  encryptionAlgorithm,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+		Keys:       map[string]*wrappedKey{},
+	}
+	for userID := range readers {
+		publicKey, err := e.publicKey(userID)
+		if err != nil {
+			return nil, err
+		}
+		encValue.Keys[userID], err = wrapDataKey(publicKey, dataKey, aad)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to wrap data key for user %s", userID)
+		}
+	}
+
+	encValueBytes, err := json.Marshal(encValue)
+	if err != nil {
+		return nil, err
+	}
+	return tagValue(ContentTypeEncrypted, encValueBytes), nil
+}
+
+// Decode decrypts value, if the user is one of its readers. Values that are not encrypted are returned as is
+func (e *encryptionCodec) Decode(dbName, key string, value []byte, _ *types.Metadata) ([]byte, error) {
+	contentType, payload, tagged := untagValue(value)
+	if !tagged || contentType != ContentTypeEncrypted {
+		return value, nil
+	}
+
+	encValue := &encryptedValue{}
+	if err := json.Unmarshal(payload, encValue); err != nil {
+		return nil, errors.Wrap(err, "failed to parse encrypted value")
+	}
+	if encValue.Algorithm != encryptionAlgorithm {
+		return nil, errors.Errorf("unsupported encryption algorithm %s", encValue.Algorithm)
+	}
+	wKey, ok := encValue.Keys[e.userID]
+	if !ok {
+		return nil, errors.Errorf("user %s is not authorised to decrypt the value, no data key is wrapped for the user", e.userID)
+	}
+
+	aad, err := state.ConstructCompositeKey(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := unwrapDataKey(e.privateKey, wKey, aad)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to unwrap data key of user %s", e.userID)
+	}
+	value, err = openAESGCM(dataKey, encValue.Nonce, encValue.Ciphertext, aad)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt value")
+	}
+	return value, nil
+}
+
+func (e *encryptionCodec) publicKey(userID string) (*ecdsa.PublicKey, error) {
+	if userID == e.userID {
+		return &e.privateKey.PublicKey, nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if cached, ok := e.publicKeys[userID]; ok {
+		if cached.expires.IsZero() || e.now().Before(cached.expires) {
+			return cached.key, nil
+		}
+		delete(e.publicKeys, userID)
+	}
+
+	tx, err := e.session.UsersTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Abort()
+	user, err := tx.GetUser(userID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to fetch user %s, the writer must be an admin or in the ACL of the user, "+
+			"otherwise the certificate of the user must be added by AddRecipient", userID)
+	}
+	if user == nil {
+		return nil, errors.Errorf("user %s does not exist", userID)
+	}
+	publicKey, err := certificatePublicKey(userID, user.GetCertificate())
+	if err != nil {
+		return nil, err
+	}
+
+	e.publicKeys[userID] = &cachedPublicKey{
+		key:     publicKey,
+		expires: e.now().Add(e.ttl),
+	}
+	return publicKey, nil
+}
+
+func certificatePublicKey(userID string, certificate []byte) (*ecdsa.PublicKey, error) {
+	cert, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse certificate of user %s", userID)
+	}
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("public key of type %T of user %s is not supported", cert.PublicKey, userID)
+	}
+	return publicKey, nil
+}
+
+// wrapDataKey encrypts dataKey to publicKey using an ephemeral ECDH key agreement
+func wrapDataKey(publicKey *ecdsa.PublicKey, dataKey, aad []byte) (*wrappedKey, error) {
+	ephemeral, err := ecdsa.GenerateKey(publicKey.Curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPublicKey := elliptic.Marshal(publicKey.Curve, ephemeral.PublicKey.X, ephemeral.PublicKey.Y)
+	kek := deriveKeyEncryptionKey(publicKey.Curve, publicKey, ephemeral.D.Bytes(), ephemeralPublicKey)
+
+	nonce, key, err := sealAESGCM(kek, dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedKey{
+		EphemeralPublicKey: ephemeralPublicKey,
+		Nonce:              nonce,
+		Key:                key,
+	}, nil
+}
+
+func unwrapDataKey(privateKey *ecdsa.PrivateKey, wKey *wrappedKey, aad []byte) ([]byte, error) {
+	x, y := elliptic.Unmarshal(privateKey.Curve, wKey.EphemeralPublicKey)
+	if x == nil {
+		return nil, errors.New("invalid ephemeral public key")
+	}
+	ephemeralPublicKey := &ecdsa.PublicKey{Curve: privateKey.Curve, X: x, Y: y}
+	kek := deriveKeyEncryptionKey(privateKey.Curve, ephemeralPublicKey, privateKey.D.Bytes(), wKey.EphemeralPublicKey)
+	return openAESGCM(kek, wKey.Nonce, wKey.Key, aad)
+}
+
+func deriveKeyEncryptionKey(curve elliptic.Curve, publicKey *ecdsa.PublicKey, scalar, ephemeralPublicKey []byte) []byte {
+	sharedX, _ := curve.ScalarMult(publicKey.X, publicKey.Y, scalar)
+	secret := make([]byte, (curve.Params().BitSize+7)/8)
+	sharedX.FillBytes(secret)
+
+	h := sha256.New()
+	h.Write(secret)
+	h.Write(ephemeralPublicKey)
+	return h.Sum(nil)
+}
+
+func sealAESGCM(key, plaintext, aad []byte) ([]byte, []byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func openAESGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,267 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"testing"
+	"time"
+
+	sdkconfig "github.com/hyperledger-labs/orion-sdk-go/pkg/config"
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEncryptionCodec(t *testing.T, userID string, privateKey *ecdsa.PrivateKey, publicKeys map[string]*ecdsa.PublicKey) *encryptionCodec {
+	keys := map[string]*cachedPublicKey{}
+	for u, k := range publicKeys {
+		keys[u] = &cachedPublicKey{key: k}
+	}
+	return &encryptionCodec{
+		userID:     userID,
+		privateKey: privateKey,
+		ttl:        DefaultPublicKeyCacheTTL,
+		now:        time.Now,
+		publicKeys: keys,
+	}
+}
+
+// usersSession serves the certificates of users, and counts the GetUser queries
+type usersSession struct {
+	DBSession
+	certs   map[string][]byte
+	queries int
+}
+
+func (s *usersSession) UsersTx() (UsersTxContext, error) {
+	return &usersTx{session: s}, nil
+}
+
+type usersTx struct {
+	UsersTxContext
+	session *usersSession
+}
+
+func (tx *usersTx) GetUser(userID string) (*types.User, error) {
+	tx.session.queries++
+	cert, ok := tx.session.certs[userID]
+	if !ok {
+		return nil, errors.Errorf("error handling request, server returned: status: 403 Forbidden, message: %s has no permission to read info of user %s", "alice", userID)
+	}
+	return &types.User{Id: userID, Certificate: cert}, nil
+}
+
+func (tx *usersTx) Abort() error {
+	return nil
+}
+
+func testCertificate(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestEncryptionCodec_EncodeDecode(t *testing.T) {
+	aliceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	bobKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	charlieKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	alice := newTestEncryptionCodec(t, "alice", aliceKey, map[string]*ecdsa.PublicKey{"bob": &bobKey.PublicKey})
+	bob := newTestEncryptionCodec(t, "bob", bobKey, nil)
+	charlie := newTestEncryptionCodec(t, "charlie", charlieKey, nil)
+
+	// charlie is set to false, so no data key is wrapped for charlie, whose public key alice does not even know
+	acl := &types.AccessControl{
+		ReadUsers:      map[string]bool{"bob": true, "charlie": false},
+		ReadWriteUsers: map[string]bool{"charlie": false},
+	}
+	encValue, err := alice.Encode("bdb", "key1", []byte("secret"), acl)
+	require.NoError(t, err)
+	require.NotContains(t, string(encValue), "secret")
+	contentType, tagged := ContentTypeOf(encValue)
+	require.True(t, tagged)
+	require.Equal(t, ContentTypeEncrypted, contentType)
+
+	for _, reader := range []*encryptionCodec{alice, bob} {
+		value, err := reader.Decode("bdb", "key1", encValue, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("secret"), value)
+	}
+
+	_, err = charlie.Decode("bdb", "key1", encValue, nil)
+	require.EqualError(t, err, "user charlie is not authorised to decrypt the value, no data key is wrapped for the user")
+
+	// ciphertext is bound to the database and key it was written to
+	_, err = bob.Decode("bdb", "key2", encValue, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to unwrap data key of user bob")
+
+	// plain values are returned as is
+	value, err := bob.Decode("bdb", "key1", []byte("plain"), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("plain"), value)
+
+	// the writer is always able to decrypt
+	_, err = charlie.Encode("bdb", "key1", []byte("secret"), &types.AccessControl{ReadWriteUsers: map[string]bool{"charlie": true}})
+	require.NoError(t, err)
+}
+
+func TestEncryptionCodec_PublicKeys(t *testing.T) {
+	aliceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	bobKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rotatedBobKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	charlieKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	session := &usersSession{certs: map[string][]byte{"bob": testCertificate(t, bobKey)}}
+	now := time.Now()
+	alice := newTestEncryptionCodec(t, "alice", aliceKey, nil)
+	alice.session = session
+	alice.now = func() time.Time { return now }
+	bob := newTestEncryptionCodec(t, "bob", bobKey, nil)
+	rotatedBob := newTestEncryptionCodec(t, "bob", rotatedBobKey, nil)
+	acl := &types.AccessControl{ReadUsers: map[string]bool{"bob": true}}
+
+	encodeAndDecode := func(reader *encryptionCodec) error {
+		encValue, err := alice.Encode("bdb", "key1", []byte("secret"), acl)
+		require.NoError(t, err)
+		_, err = reader.Decode("bdb", "key1", encValue, nil)
+		return err
+	}
+
+	// the public key is fetched once, until it expires
+	require.NoError(t, encodeAndDecode(bob))
+	require.NoError(t, encodeAndDecode(bob))
+	require.Equal(t, 1, session.queries)
+
+	session.certs["bob"] = testCertificate(t, rotatedBobKey)
+	require.Error(t, encodeAndDecode(rotatedBob))
+	now = now.Add(DefaultPublicKeyCacheTTL)
+	require.NoError(t, encodeAndDecode(rotatedBob))
+	require.Equal(t, 2, session.queries)
+
+	// invalidated keys are fetched again
+	session.certs["bob"] = testCertificate(t, bobKey)
+	alice.InvalidatePublicKeys("bob")
+	require.NoError(t, encodeAndDecode(bob))
+	require.Equal(t, 3, session.queries)
+
+	// users the writer cannot fetch are pinned, and pinned keys do not expire
+	acl = &types.AccessControl{ReadUsers: map[string]bool{"charlie": true}}
+	_, err = alice.Encode("bdb", "key1", []byte("secret"), acl)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to fetch user charlie, the writer must be an admin or in the ACL of the user")
+	require.NoError(t, alice.AddRecipient("charlie", testCertificate(t, charlieKey)))
+	now = now.Add(2 * DefaultPublicKeyCacheTTL)
+	require.NoError(t, encodeAndDecode(newTestEncryptionCodec(t, "charlie", charlieKey, nil)))
+	require.Equal(t, 4, session.queries)
+
+	err = alice.AddRecipient("charlie", []byte("not a certificate"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to parse certificate of user charlie")
+
+	_, err = alice.Encode("bdb", "key1", []byte("secret"), nil)
+	require.EqualError(t, err, "value of key 'key1' in database 'bdb' has no ACL, the readers to encrypt the value for are unknown")
+}
+
+func TestDataContext_PutAndGetEncrypted(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "bob", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	bcdb, adminSession, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCertTemDir, "alice")
+	pemUserCert, err := ioutil.ReadFile(path.Join(clientCertTemDir, "bob.pem"))
+	require.NoError(t, err)
+	addUser(t, "bob", adminSession, pemUserCert, map[string]types.Privilege_Access{"bdb": 1})
+	bobSession := openUserSession(t, bcdb, "bob", clientCertTemDir)
+
+	aliceCodec, err := NewEncryptionValueCodec(aliceSession, &sdkconfig.UserConfig{
+		UserID:         "alice",
+		CertPath:       path.Join(clientCertTemDir, "alice.pem"),
+		PrivateKeyPath: path.Join(clientCertTemDir, "alice.key"),
+	})
+	require.NoError(t, err)
+	bobCodec, err := NewEncryptionValueCodec(bobSession, &sdkconfig.UserConfig{
+		UserID:         "bob",
+		CertPath:       path.Join(clientCertTemDir, "bob.pem"),
+		PrivateKeyPath: path.Join(clientCertTemDir, "bob.key"),
+	})
+	require.NoError(t, err)
+
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(aliceCodec)
+	err = tx.Put("bdb", "key1", []byte("secret"), &types.AccessControl{
+		ReadUsers:      map[string]bool{"bob": true},
+		ReadWriteUsers: map[string]bool{"alice": true},
+	})
+	require.NoError(t, err)
+	err = tx.Put("bdb", "key2", []byte("alice only"), &types.AccessControl{
+		ReadUsers:      map[string]bool{"bob": true},
+		ReadWriteUsers: map[string]bool{"alice": true},
+	})
+	require.NoError(t, err)
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+
+	// raw value is the ciphertext
+	tx, err = bobSession.DataTx()
+	require.NoError(t, err)
+	rawValue, _, err := tx.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.NotContains(t, string(rawValue), "secret")
+
+	tx, err = bobSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(bobCodec)
+	value, meta, err := tx.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	require.Equal(t, []byte("secret"), value)
+
+	tx, err = aliceSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(aliceCodec)
+	value, _, err = tx.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), value)
+
+	// provenance returns the ciphertext, which can be decoded by the codec
+	p, err := bobSession.Provenance()
+	require.NoError(t, err)
+	history, err := p.GetHistoricalData("bdb", "key1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	value, err = bobCodec.Decode("bdb", "key1", history[0].GetValue(), history[0].GetMetadata())
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret"), value)
+
+	// encrypting for a user that does not exist fails
+	tx, err = aliceSession.DataTx()
+	require.NoError(t, err)
+	tx.SetValueCodec(aliceCodec)
+	err = tx.Put("bdb", "key3", []byte("secret"), &types.AccessControl{
+		ReadUsers: map[string]bool{"charlie": true},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to encode value of key 'key3' in database 'bdb'")
+}
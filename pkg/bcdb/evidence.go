@@ -0,0 +1,247 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"crypto/x509"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/constants"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EvidenceBundleVersion version of the evidence bundle format
+	EvidenceBundleVersion = 1
+
+	TxTypeData   = "data"
+	TxTypeUser   = "user"
+	TxTypeDB     = "db"
+	TxTypeConfig = "config"
+)
+
+// EvidenceKey selects a key whose state at the block of the transaction is proven by an evidence bundle
+type EvidenceKey struct {
+	DBName string
+	Key    string
+	// Value the value of the key, or the deleted value if Deleted is true, in which case it may be left empty
+	Value   []byte
+	Deleted bool
+}
+
+// EvidenceBundle holds everything needed to prove that a transaction is part of the ledger, without a server
+// connection. It can be serialized as JSON, and verified offline by VerifyBundle.
+type EvidenceBundle struct {
+	Version int `json:"version"`
+	// TxType one of TxTypeData, TxTypeUser, TxTypeDB and TxTypeConfig
+	TxType string `json:"tx_type"`
+	// TxEnvelope protobuf serialized tx envelope
+	TxEnvelope []byte           `json:"tx_envelope"`
+	Receipt    *types.TxReceipt `json:"receipt"`
+	// SignedReceipt the receipt as returned by a node, along with the node's signature
+	SignedReceipt *types.TxReceiptResponseEnvelope `json:"signed_receipt"`
+	// TxProof intermediate hashes from the tx to the block tx merkle tree root
+	TxProof [][]byte `json:"tx_proof"`
+	// StateProofs proofs of the selected keys at the block of the tx
+	StateProofs []*StateProof `json:"state_proofs,omitempty"`
+	// LedgerPath headers of the ledger path from the block of the tx down to the genesis block
+	LedgerPath []*types.BlockHeader `json:"ledger_path"`
+	// NodeCertificates DER encoded certificates of the cluster nodes, by node ID
+	NodeCertificates map[string][]byte `json:"node_certificates"`
+}
+
+// Envelope returns the parsed tx envelope
+func (b *EvidenceBundle) Envelope() (proto.Message, error) {
+	var env proto.Message
+	switch b.TxType {
+	case TxTypeData:
+		env = &types.DataTxEnvelope{}
+	case TxTypeUser:
+		env = &types.UserAdministrationTxEnvelope{}
+	case TxTypeDB:
+		env = &types.DBAdministrationTxEnvelope{}
+	case TxTypeConfig:
+		env = &types.ConfigTxEnvelope{}
+	default:
+		return nil, errors.Errorf("unknown tx type '%s'", b.TxType)
+	}
+	if err := proto.Unmarshal(b.TxEnvelope, env); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s tx envelope", b.TxType)
+	}
+	return env, nil
+}
+
+func (l *ledger) CollectEvidence(tx proto.Message, receipt *types.TxReceipt, keys []*EvidenceKey) (*EvidenceBundle, error) {
+	txID := txIDOf(tx)
+	bundle := &EvidenceBundle{
+		Version:          EvidenceBundleVersion,
+		TxType:           txTypeOf(tx),
+		Receipt:          receipt,
+		NodeCertificates: map[string][]byte{},
+	}
+	if bundle.TxType == "" {
+		return nil, errors.Errorf("tx of type %T is not supported", tx)
+	}
+	var err error
+	if bundle.TxEnvelope, err = proto.Marshal(tx); err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize envelope of tx %s", txID)
+	}
+
+	blockNum := receipt.GetHeader().GetBaseHeader().GetNumber()
+	txProof, err := l.GetTransactionProof(blockNum, int(receipt.GetTxIndex()))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get proof of tx %s", txID)
+	}
+	bundle.TxProof = txProof.GetIntermediateHashes()
+
+	bundle.SignedReceipt = &types.TxReceiptResponseEnvelope{}
+	if err = l.handleRequest(
+		constants.URLForGetTransactionReceipt(txID),
+		&types.GetTxReceiptQuery{
+			UserId: l.userID,
+			TxId:   txID,
+		}, bundle.SignedReceipt,
+	); err != nil {
+		return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+	}
+
+	for _, k := range keys {
+		var proof *StateProof
+		if k.Deleted {
+			proof, err = l.ProveDeleted(k.DBName, k.Key, blockNum)
+		} else {
+			proof, err = l.ProveValue(k.DBName, k.Key, k.Value, blockNum)
+		}
+		if err != nil {
+			return nil, err
+		}
+		bundle.StateProofs = append(bundle.StateProofs, proof)
+	}
+
+	if blockNum > 1 {
+		if bundle.LedgerPath, err = l.GetLedgerPath(1, blockNum); err != nil {
+			return nil, errors.WithMessagef(err, "failed to get ledger path from block %d to the genesis block", blockNum)
+		}
+	} else {
+		bundle.LedgerPath = []*types.BlockHeader{receipt.GetHeader()}
+	}
+
+	configResEnv := &types.GetConfigResponseEnvelope{}
+	if err = l.handleRequest(
+		constants.URLForGetConfig(),
+		&types.GetConfigQuery{
+			UserId: l.userID,
+		}, configResEnv,
+	); err != nil {
+		return nil, errors.WithMessage(err, "failed to get cluster config")
+	}
+	for _, node := range configResEnv.GetResponse().GetConfig().GetNodes() {
+		bundle.NodeCertificates[node.GetId()] = node.GetCertificate()
+	}
+	return bundle, nil
+}
+
+// VerifyBundle verifies an evidence bundle offline: the node signature over the receipt, the inclusion of the tx
+// in its block, the state proofs, and the ledger path from the block of the tx down to the genesis block. If
+// genesis is not nil, the path must end at this trusted genesis block header, otherwise the genesis header of the
+// bundle is trusted. Note that the node certificates should be validated against the cluster CA by the caller.
+// Returns an error describing the first check that failed.
+func VerifyBundle(bundle *EvidenceBundle, genesis *types.BlockHeader) error {
+	if bundle.Version != EvidenceBundleVersion {
+		return errors.Errorf("unsupported evidence bundle version %d", bundle.Version)
+	}
+	env, err := bundle.Envelope()
+	if err != nil {
+		return err
+	}
+	txID := txIDOf(env)
+	header := bundle.Receipt.GetHeader()
+	blockNum := header.GetBaseHeader().GetNumber()
+
+	if err = verifySignedReceipt(bundle); err != nil {
+		return err
+	}
+	if !proto.Equal(bundle.SignedReceipt.GetResponse().GetReceipt(), bundle.Receipt) {
+		return errors.Errorf("receipt of tx %s does not match the receipt signed by the node", txID)
+	}
+
+	ok, err := NewTxProof(bundle.TxProof).Verify(bundle.Receipt, env)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to verify proof of tx %s", txID)
+	}
+	if !ok {
+		return errors.Errorf("tx %s is not included in the tx merkle tree of block %d", txID, blockNum)
+	}
+
+	for _, p := range bundle.StateProofs {
+		if !proto.Equal(p.BlockHeader, header) {
+			return errors.Errorf("state proof of key '%s' in database '%s' is not of block %d", p.Key, p.DBName, blockNum)
+		}
+		if err = p.Verify(); err != nil {
+			return err
+		}
+	}
+
+	if err = VerifyLedgerPath(bundle.LedgerPath, 1, blockNum); err != nil {
+		return err
+	}
+	headerHash, err := CalculateBlockHeaderHash(header)
+	if err != nil {
+		return err
+	}
+	genesisHash, err := CalculateBlockHeaderHash(bundle.LedgerPath[len(bundle.LedgerPath)-1])
+	if err != nil {
+		return err
+	}
+	if genesis != nil {
+		if genesisHash, err = CalculateBlockHeaderHash(genesis); err != nil {
+			return err
+		}
+	}
+	fork, err := matchPathEnds(bundle.LedgerPath, headerHash, genesisHash)
+	if err != nil {
+		return err
+	}
+	if fork != nil {
+		return errors.Errorf("header of block %d on the ledger path does not match the trusted header", fork.BlockNum)
+	}
+	return nil
+}
+
+func verifySignedReceipt(bundle *EvidenceBundle) error {
+	nodeID := bundle.SignedReceipt.GetResponse().GetHeader().GetNodeId()
+	certBytes, ok := bundle.NodeCertificates[nodeID]
+	if !ok {
+		return errors.Errorf("there is no certificate for node %s, which signed the receipt", nodeID)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse certificate of node %s", nodeID)
+	}
+	respBytes, err := json.Marshal(bundle.SignedReceipt.GetResponse())
+	if err != nil {
+		return err
+	}
+	if err = cert.CheckSignature(cert.SignatureAlgorithm, respBytes, bundle.SignedReceipt.GetSignature()); err != nil {
+		return errors.Wrapf(err, "signature of node %s over the receipt is not valid", nodeID)
+	}
+	return nil
+}
+
+// txTypeOf returns the evidence bundle tx type of a tx envelope, or empty string if tx is not a tx envelope
+func txTypeOf(tx proto.Message) string {
+	switch tx.(type) {
+	case *types.DataTxEnvelope:
+		return TxTypeData
+	case *types.UserAdministrationTxEnvelope:
+		return TxTypeUser
+	case *types.DBAdministrationTxEnvelope:
+		return TxTypeDB
+	case *types.ConfigTxEnvelope:
+		return TxTypeConfig
+	default:
+		return ""
+	}
+}
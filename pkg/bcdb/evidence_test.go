@@ -0,0 +1,168 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// testEvidenceBundle creates a bundle of a data tx committed alone in block 4, signed by node1
+func testEvidenceBundle(t *testing.T) (*EvidenceBundle, []*types.BlockHeader) {
+	tx := &types.DataTxEnvelope{
+		Payload: &types.DataTx{
+			TxId:            "tx1",
+			MustSignUserIds: []string{"alice"},
+			DbOperations: []*types.DBOperation{{
+				DbName:     "bdb",
+				DataWrites: []*types.DataWrite{{Key: "key1", Value: []byte("value1")}},
+			}},
+		},
+	}
+	receipt, txProof := singleTxReceipt(t, tx)
+	stateProof := testStateProof(t, []byte("value1"), false)
+
+	headers := testLedgerHeaders(t, 3)
+	header := receipt.Header
+	header.BaseHeader.Number = 4
+	header.StateMerkelTreeRootHash = stateProof.BlockHeader.StateMerkelTreeRootHash
+	for _, link := range skipListLinks(4) {
+		hash, err := CalculateBlockHeaderHash(headers[link-1])
+		require.NoError(t, err)
+		header.SkipchainHashes = append(header.SkipchainHashes, hash)
+	}
+	headers = append(headers, header)
+	stateProof.BlockHeader = header
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privKey.PublicKey, privKey)
+	require.NoError(t, err)
+
+	signedReceipt := &types.TxReceiptResponseEnvelope{
+		Response: &types.TxReceiptResponse{
+			Header:  &types.ResponseHeader{NodeId: "node1"},
+			Receipt: receipt,
+		},
+	}
+	respBytes, err := json.Marshal(signedReceipt.Response)
+	require.NoError(t, err)
+	digest := sha256.Sum256(respBytes)
+	signedReceipt.Signature, err = ecdsa.SignASN1(rand.Reader, privKey, digest[:])
+	require.NoError(t, err)
+
+	envBytes, err := proto.Marshal(tx)
+	require.NoError(t, err)
+	return &EvidenceBundle{
+		Version:          EvidenceBundleVersion,
+		TxType:           TxTypeData,
+		TxEnvelope:       envBytes,
+		Receipt:          receipt,
+		SignedReceipt:    signedReceipt,
+		TxProof:          txProof.GetIntermediateHashes(),
+		StateProofs:      []*StateProof{stateProof},
+		LedgerPath:       []*types.BlockHeader{headers[3], headers[2], headers[0]},
+		NodeCertificates: map[string][]byte{"node1": certBytes},
+	}, headers
+}
+
+func TestVerifyBundle(t *testing.T) {
+	bundle, headers := testEvidenceBundle(t)
+	require.NoError(t, VerifyBundle(bundle, nil))
+	require.NoError(t, VerifyBundle(bundle, headers[0]))
+
+	bundleBytes, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	readBundle := &EvidenceBundle{}
+	require.NoError(t, json.Unmarshal(bundleBytes, readBundle))
+	require.NoError(t, VerifyBundle(readBundle, headers[0]))
+
+	env, err := readBundle.Envelope()
+	require.NoError(t, err)
+	require.Equal(t, "tx1", env.(*types.DataTxEnvelope).GetPayload().GetTxId())
+}
+
+func TestVerifyBundle_Failures(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(b *EvidenceBundle, headers []*types.BlockHeader) *types.BlockHeader
+		errMessage string
+	}{
+		{
+			name: "unknown node",
+			tamper: func(b *EvidenceBundle, _ []*types.BlockHeader) *types.BlockHeader {
+				b.NodeCertificates = map[string][]byte{"node2": b.NodeCertificates["node1"]}
+				return nil
+			},
+			errMessage: "there is no certificate for node node1, which signed the receipt",
+		},
+		{
+			name: "tampered receipt",
+			tamper: func(b *EvidenceBundle, _ []*types.BlockHeader) *types.BlockHeader {
+				b.Receipt = proto.Clone(b.Receipt).(*types.TxReceipt)
+				b.Receipt.TxIndex = 1
+				return nil
+			},
+			errMessage: "receipt of tx tx1 does not match the receipt signed by the node",
+		},
+		{
+			name: "tampered tx",
+			tamper: func(b *EvidenceBundle, _ []*types.BlockHeader) *types.BlockHeader {
+				env, _ := b.Envelope()
+				env.(*types.DataTxEnvelope).Payload.MustSignUserIds = []string{"bob"}
+				b.TxEnvelope, _ = proto.Marshal(env)
+				return nil
+			},
+			errMessage: "tx tx1 is not included in the tx merkle tree of block 4",
+		},
+		{
+			name: "tampered state proof",
+			tamper: func(b *EvidenceBundle, _ []*types.BlockHeader) *types.BlockHeader {
+				b.StateProofs[0].Value = []byte("value2")
+				return nil
+			},
+			errMessage: "value of key 'key1' in database 'bdb' is not part of the state at block 4",
+		},
+		{
+			name: "untrusted genesis",
+			tamper: func(b *EvidenceBundle, headers []*types.BlockHeader) *types.BlockHeader {
+				return headers[1]
+			},
+			errMessage: "header of block 1 on the ledger path does not match the trusted header",
+		},
+		{
+			name: "broken ledger path",
+			tamper: func(b *EvidenceBundle, headers []*types.BlockHeader) *types.BlockHeader {
+				b.LedgerPath = []*types.BlockHeader{headers[3], headers[1], headers[0]}
+				return nil
+			},
+			errMessage: "ledger path is broken between block 4 and block 2: block 4 does not link to block 2 in the skip list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, headers := testEvidenceBundle(t)
+			genesis := tt.tamper(bundle, headers)
+			require.EqualError(t, VerifyBundle(bundle, genesis), tt.errMessage)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// HistoryEntryStatus the outcome of checking a historical value of a key against the ledger
+type HistoryEntryStatus string
+
+const (
+	// HistoryEntryProven the value is proven to be part of the state of the block in its version
+	HistoryEntryProven HistoryEntryStatus = "proven"
+	// HistoryEntryOverwritten the value was overwritten by a later tx of the same block, so it is
+	// not part of the state of any block, and it is verified against the tx that wrote it: the tx
+	// envelope writes the value and is proven to be part of the block
+	HistoryEntryOverwritten HistoryEntryStatus = "overwritten"
+	// HistoryEntryDeleted the value is proven to be deleted in the state of the block in its version,
+	// i.e. a later tx of the same block deleted the key
+	HistoryEntryDeleted HistoryEntryStatus = "deleted"
+	// HistoryEntryUnbacked the ledger does not back the value
+	HistoryEntryUnbacked HistoryEntryStatus = "unbacked"
+	// HistoryEntryUnverified the value was overwritten by a later tx of the same block, and the
+	// envelope of the tx that wrote it is not available to verify it
+	HistoryEntryUnverified HistoryEntryStatus = "unverified"
+)
+
+// HistoryEntryVerification the outcome of checking a single historical value
+type HistoryEntryVerification struct {
+	Value  *types.ValueWithMetadata
+	Status HistoryEntryStatus
+	// Proof verified proof of the value, or of its deletion, nil unless Status is proven or deleted
+	Proof *StateProof
+	// TxProof verified proof of the tx that wrote the value, nil unless Status is overwritten
+	TxProof *TxProof
+	// Failure describes why the value is unbacked or unverified, empty otherwise
+	Failure string
+}
+
+// HistoryVerificationReport describes the checks carried out by Provenance.VerifyHistoricalData
+type HistoryVerificationReport struct {
+	DBName string
+	Key    string
+	// Entries the outcome for every historical value of the key, ordered by version
+	Entries []*HistoryEntryVerification
+}
+
+// Verified returns true if the ledger backs every historical value of the key
+func (r *HistoryVerificationReport) Verified() bool {
+	return len(r.Unbacked()) == 0 && len(r.Unverified()) == 0
+}
+
+// Unbacked returns the entries of the values the ledger does not back
+func (r *HistoryVerificationReport) Unbacked() []*HistoryEntryVerification {
+	return r.entries(HistoryEntryUnbacked)
+}
+
+// Unverified returns the entries of the overwritten values that could not be verified
+func (r *HistoryVerificationReport) Unverified() []*HistoryEntryVerification {
+	return r.entries(HistoryEntryUnverified)
+}
+
+func (r *HistoryVerificationReport) entries(status HistoryEntryStatus) []*HistoryEntryVerification {
+	var entries []*HistoryEntryVerification
+	for _, e := range r.Entries {
+		if e.Status == status {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (p *provenance) VerifyHistoricalData(dbName, key string, envelopes func(version *types.Version) (*types.DataTxEnvelope, error)) (*HistoryVerificationReport, error) {
+	return verifyHistory(p, &ledger{p.commonTxContext}, dbName, key, envelopes)
+}
+
+func verifyHistory(p Provenance, l Ledger, dbName, key string, envelopes func(version *types.Version) (*types.DataTxEnvelope, error)) (*HistoryVerificationReport, error) {
+	values, err := p.GetHistoricalData(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get history of key '%s' in database '%s'", key, dbName)
+	}
+	sortValuesByVersion(values)
+
+	report := &HistoryVerificationReport{
+		DBName: dbName,
+		Key:    key,
+	}
+	headers := map[uint64]*types.BlockHeader{}
+	for i, v := range values {
+		entry := &HistoryEntryVerification{Value: v}
+		report.Entries = append(report.Entries, entry)
+
+		blockNum := v.GetMetadata().GetVersion().GetBlockNum()
+		header, ok := headers[blockNum]
+		if !ok {
+			header, err = l.GetBlockHeader(blockNum)
+			if err != nil && !isNotFound(err) {
+				return nil, errors.WithMessagef(err, "failed to get header of block %d", blockNum)
+			}
+			headers[blockNum] = header
+		}
+		if header == nil {
+			entry.Status = HistoryEntryUnbacked
+			entry.Failure = fmt.Sprintf("block %d does not exist", blockNum)
+			continue
+		}
+
+		if i+1 < len(values) && values[i+1].GetMetadata().GetVersion().GetBlockNum() == blockNum {
+			if err = verifyOverwrittenValue(l, header, dbName, key, v, envelopes, entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		proof, err := proveHistoricalValue(l, header, dbName, key, v.GetValue(), false)
+		if err == nil {
+			entry.Status = HistoryEntryProven
+			entry.Proof = proof
+			continue
+		}
+		if proof, deletedErr := proveHistoricalValue(l, header, dbName, key, v.GetValue(), true); deletedErr == nil {
+			entry.Status = HistoryEntryDeleted
+			entry.Proof = proof
+			continue
+		}
+		entry.Status = HistoryEntryUnbacked
+		entry.Failure = err.Error()
+	}
+	return report, nil
+}
+
+// verifyOverwrittenValue verifies a value overwritten within its block against the tx that wrote it, as
+// the value is not part of the state of any block
+func verifyOverwrittenValue(l Ledger, header *types.BlockHeader, dbName, key string, v *types.ValueWithMetadata,
+	envelopes func(version *types.Version) (*types.DataTxEnvelope, error), entry *HistoryEntryVerification) error {
+	version := v.GetMetadata().GetVersion()
+	blockNum, txIndex := version.GetBlockNum(), version.GetTxNum()
+	var env *types.DataTxEnvelope
+	if envelopes != nil {
+		var err error
+		if env, err = envelopes(version); err != nil {
+			return errors.WithMessagef(err, "failed to get envelope of tx at block %d, index %d", blockNum, txIndex)
+		}
+	}
+	if env == nil {
+		entry.Status = HistoryEntryUnverified
+		entry.Failure = fmt.Sprintf("value was overwritten in block %d and the envelope of tx at index %d is not available", blockNum, txIndex)
+		return nil
+	}
+
+	txID := env.GetPayload().GetTxId()
+	if !writesValue(env, dbName, key, v.GetValue()) {
+		entry.Status = HistoryEntryUnbacked
+		entry.Failure = fmt.Sprintf("tx %s at block %d, index %d does not write the value", txID, blockNum, txIndex)
+		return nil
+	}
+	if txIndex >= uint64(len(header.GetValidationInfo())) {
+		entry.Status = HistoryEntryUnbacked
+		entry.Failure = fmt.Sprintf("tx index %d is out of range of block %d", txIndex, blockNum)
+		return nil
+	}
+	if flag := header.GetValidationInfo()[txIndex].GetFlag(); flag != types.Flag_VALID {
+		entry.Status = HistoryEntryUnbacked
+		entry.Failure = fmt.Sprintf("tx %s at block %d, index %d is invalid: %s", txID, blockNum, txIndex, flag)
+		return nil
+	}
+
+	txProof, err := l.GetTransactionProof(blockNum, int(txIndex))
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get proof of tx %s", txID)
+	}
+	included, err := txProof.Verify(&types.TxReceipt{Header: header, TxIndex: txIndex}, env)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to verify proof of tx %s", txID)
+	}
+	if !included {
+		entry.Status = HistoryEntryUnbacked
+		entry.Failure = fmt.Sprintf("tx %s is not included in the tx merkle tree of block %d", txID, blockNum)
+		return nil
+	}
+	entry.Status = HistoryEntryOverwritten
+	entry.TxProof = txProof
+	return nil
+}
+
+// writesValue tells if the write set of env holds value for key in database dbName
+func writesValue(env *types.DataTxEnvelope, dbName, key string, value []byte) bool {
+	for _, ops := range env.GetPayload().GetDbOperations() {
+		if ops.GetDbName() != dbName {
+			continue
+		}
+		for _, w := range ops.GetDataWrites() {
+			if w.GetKey() == key && bytes.Equal(w.GetValue(), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func proveHistoricalValue(l Ledger, header *types.BlockHeader, dbName, key string, value []byte, isDeleted bool) (*StateProof, error) {
+	blockNum := header.GetBaseHeader().GetNumber()
+	trieProof, err := l.GetDataProof(blockNum, dbName, key, isDeleted)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get state proof of key '%s' in database '%s' at block %d", key, dbName, blockNum)
+	}
+	proof := &StateProof{
+		DBName:      dbName,
+		Key:         key,
+		Value:       value,
+		Deleted:     isDeleted,
+		BlockHeader: header,
+		Path:        trieProof.GetPath(),
+	}
+	if err = proof.Verify(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
@@ -0,0 +1,226 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// trieLedger serves the state proofs of key1 in database bdb, states maps a block to the value of key1 in its state.
+// receipts and txProofs hold the tx at index 0 of a block, for the values overwritten within the block.
+type trieLedger struct {
+	Ledger
+	t        *testing.T
+	tip      uint64
+	states   map[uint64]*trieState
+	receipts map[uint64]*types.TxReceipt
+	txProofs map[uint64]*TxProof
+}
+
+type trieState struct {
+	value   string
+	deleted bool
+}
+
+func (l *trieLedger) trie(blockNum uint64) (valueNode, rootNode [][]byte, rootHash []byte) {
+	s := l.states[blockNum]
+	valueHash, err := CalculateValueHash("bdb", "key1", []byte(s.value))
+	require.NoError(l.t, err)
+	valueNode = [][]byte{[]byte("key path"), valueHash}
+	if s.deleted {
+		valueNode = append(valueNode, state.KeyDeleteMarkerBytes)
+	}
+	valueNodeHash, err := state.CalcHash(valueNode)
+	require.NoError(l.t, err)
+	rootNode = [][]byte{[]byte("sibling"), valueNodeHash}
+	rootHash, err = state.CalcHash(rootNode)
+	require.NoError(l.t, err)
+	return valueNode, rootNode, rootHash
+}
+
+func (l *trieLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	if blockNum > l.tip {
+		return nil, blockNotFound(blockNum)
+	}
+	header := &types.BlockHeader{BaseHeader: &types.BlockHeaderBase{Number: blockNum}}
+	if _, ok := l.states[blockNum]; ok {
+		_, _, header.StateMerkelTreeRootHash = l.trie(blockNum)
+	}
+	if receipt, ok := l.receipts[blockNum]; ok {
+		header.TxMerkelTreeRootHash = receipt.GetHeader().GetTxMerkelTreeRootHash()
+		header.ValidationInfo = receipt.GetHeader().GetValidationInfo()
+	}
+	return header, nil
+}
+
+func (l *trieLedger) GetTransactionProof(blockNum uint64, txIndex int) (*TxProof, error) {
+	proof, ok := l.txProofs[blockNum]
+	if !ok || txIndex != 0 {
+		return nil, errors.Errorf("no proof for tx %d of block %d found", txIndex, blockNum)
+	}
+	return proof, nil
+}
+
+func writeEnvelope(txID, value string) *types.DataTxEnvelope {
+	return &types.DataTxEnvelope{Payload: &types.DataTx{
+		TxId:            txID,
+		MustSignUserIds: []string{"alice"},
+		DbOperations: []*types.DBOperation{{
+			DbName:     "bdb",
+			DataWrites: []*types.DataWrite{{Key: "key1", Value: []byte(value)}},
+		}},
+	}}
+}
+
+func (l *trieLedger) GetDataProof(blockNum uint64, dbName, key string, isDeleted bool) (*state.Proof, error) {
+	s, ok := l.states[blockNum]
+	if !ok || s.deleted != isDeleted {
+		return nil, errors.Errorf("no proof for block %d, db %s, key %s, isDeleted %t found", blockNum, dbName, key, isDeleted)
+	}
+	valueNode, rootNode, _ := l.trie(blockNum)
+	return state.NewProof([]*types.MPTrieProofElement{{Hashes: valueNode}, {Hashes: rootNode}}), nil
+}
+
+func TestVerifyHistory(t *testing.T) {
+	p := &historyProvenance{}
+	p.write("a", 2, 0)
+	p.write("b", 3, 0)
+	p.write("c", 3, 1)
+	p.write("d", 4, 0)
+	p.write("e", 5, 0)
+	p.write("f", 9, 0)
+	// the tx at (3, 0) wrote b, which the tx at (3, 1) overwrote
+	tx := writeEnvelope("tx1", "b")
+	receipt, txProof := singleTxReceipt(t, tx)
+	l := &trieLedger{
+		t:   t,
+		tip: 6,
+		states: map[uint64]*trieState{
+			2: {value: "a"},
+			3: {value: "c"},
+			4: {value: "d", deleted: true},
+			5: {value: "x"},
+		},
+		receipts: map[uint64]*types.TxReceipt{3: receipt},
+		txProofs: map[uint64]*TxProof{3: txProof},
+	}
+	envelopes := func(version *types.Version) (*types.DataTxEnvelope, error) {
+		if version.GetBlockNum() == 3 && version.GetTxNum() == 0 {
+			return tx, nil
+		}
+		return nil, nil
+	}
+
+	report, err := verifyHistory(p, l, "bdb", "key1", envelopes)
+	require.NoError(t, err)
+	require.Equal(t, "bdb", report.DBName)
+	require.Equal(t, "key1", report.Key)
+	require.False(t, report.Verified())
+
+	var statuses []HistoryEntryStatus
+	for _, e := range report.Entries {
+		statuses = append(statuses, e.Status)
+	}
+	require.Equal(t, []HistoryEntryStatus{
+		HistoryEntryProven,
+		HistoryEntryOverwritten,
+		HistoryEntryProven,
+		HistoryEntryDeleted,
+		HistoryEntryUnbacked,
+		HistoryEntryUnbacked,
+	}, statuses)
+
+	require.Equal(t, []byte("a"), report.Entries[0].Proof.Value)
+	require.NoError(t, report.Entries[0].Proof.Verify())
+	require.Nil(t, report.Entries[1].Proof)
+	require.Equal(t, txProof, report.Entries[1].TxProof)
+	require.True(t, report.Entries[3].Proof.Deleted)
+
+	unbacked := report.Unbacked()
+	require.Len(t, unbacked, 2)
+	require.Equal(t, "e", string(unbacked[0].Value.GetValue()))
+	require.Equal(t, "value of key 'key1' in database 'bdb' is not part of the state at block 5", unbacked[0].Failure)
+	require.Nil(t, unbacked[0].Proof)
+	require.Equal(t, "block 9 does not exist", unbacked[1].Failure)
+	require.Empty(t, report.Unverified())
+
+	// all values are backed once the tampered ones are gone
+	p.values = p.values[2:]
+	report, err = verifyHistory(p, l, "bdb", "key1", envelopes)
+	require.NoError(t, err)
+	require.True(t, report.Verified())
+	require.Len(t, report.Entries, 4)
+
+	// without the envelope the overwritten value cannot be verified
+	report, err = verifyHistory(p, l, "bdb", "key1", nil)
+	require.NoError(t, err)
+	require.False(t, report.Verified())
+	require.Empty(t, report.Unbacked())
+	unverified := report.Unverified()
+	require.Len(t, unverified, 1)
+	require.Equal(t, "b", string(unverified[0].Value.GetValue()))
+	require.Equal(t, "value was overwritten in block 3 and the envelope of tx at index 0 is not available", unverified[0].Failure)
+	require.Nil(t, unverified[0].TxProof)
+
+	for _, tc := range []struct {
+		name    string
+		env     *types.DataTxEnvelope
+		failure string
+	}{
+		{
+			name:    "value not written by the tx",
+			env:     writeEnvelope("tx1", "c"),
+			failure: "tx tx1 at block 3, index 0 does not write the value",
+		},
+		{
+			name:    "tx not in the block",
+			env:     writeEnvelope("tx2", "b"),
+			failure: "tx tx2 is not included in the tx merkle tree of block 3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := verifyHistory(p, l, "bdb", "key1", func(version *types.Version) (*types.DataTxEnvelope, error) {
+				return tc.env, nil
+			})
+			require.NoError(t, err)
+			require.False(t, report.Verified())
+			unbacked := report.Unbacked()
+			require.Len(t, unbacked, 1)
+			require.Equal(t, "b", string(unbacked[0].Value.GetValue()))
+			require.Equal(t, tc.failure, unbacked[0].Failure)
+		})
+	}
+
+	_, err = verifyHistory(p, l, "bdb", "key1", func(version *types.Version) (*types.DataTxEnvelope, error) {
+		return nil, errors.New("envelope store is closed")
+	})
+	require.EqualError(t, err, "failed to get envelope of tx at block 3, index 0: envelope store is closed")
+}
+
+func TestVerifyHistoricalData(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	putKeySync(t, "bdb", "key1", "value2", "alice", aliceSession)
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+	report, err := p.VerifyHistoricalData("bdb", "key1", nil)
+	require.NoError(t, err)
+	require.True(t, report.Verified())
+	require.Len(t, report.Entries, 2)
+	for _, e := range report.Entries {
+		require.Equal(t, HistoryEntryProven, e.Status)
+		require.NoError(t, e.Proof.Verify())
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// JSONChangeOp the kind of change of a JSON value, named after the JSON patch operations
+type JSONChangeOp string
+
+const (
+	JSONAdd     JSONChangeOp = "add"
+	JSONRemove  JSONChangeOp = "remove"
+	JSONReplace JSONChangeOp = "replace"
+)
+
+// JSONChange a change of a single element of a JSON value
+type JSONChange struct {
+	Op JSONChangeOp `json:"op"`
+	// Path JSON pointer (RFC 6901) to the changed element, empty for the whole value
+	Path string `json:"path"`
+	// Old value of the element, nil for JSONAdd
+	Old json.RawMessage `json:"old,omitempty"`
+	// New value of the element, nil for JSONRemove
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// ByteChange the differing range of two values, after their common prefix and suffix are removed
+type ByteChange struct {
+	// Offset of the range, the length of the common prefix
+	Offset int    `json:"offset"`
+	Old    []byte `json:"old"`
+	New    []byte `json:"new"`
+}
+
+// ACLChange the users added to and removed from the access control of a key
+type ACLChange struct {
+	ReadUsersAdded        []string                       `json:"read_users_added,omitempty"`
+	ReadUsersRemoved      []string                       `json:"read_users_removed,omitempty"`
+	ReadWriteUsersAdded   []string                       `json:"read_write_users_added,omitempty"`
+	ReadWriteUsersRemoved []string                       `json:"read_write_users_removed,omitempty"`
+	OldSignPolicyForWrite types.AccessControlWritePolicy `json:"old_sign_policy_for_write"`
+	NewSignPolicyForWrite types.AccessControlWritePolicy `json:"new_sign_policy_for_write"`
+}
+
+// KeyDiff the differences between two versions of a key. When both values are JSON the differences are
+// structural, JSONChanges, otherwise they are a single ByteChange. A nil ACL means the ACL did not change.
+type KeyDiff struct {
+	DBName      string         `json:"db_name"`
+	Key         string         `json:"key"`
+	From        *types.Version `json:"from"`
+	To          *types.Version `json:"to"`
+	JSON        bool           `json:"json"`
+	JSONChanges []*JSONChange  `json:"json_changes,omitempty"`
+	ByteChange  *ByteChange    `json:"byte_change,omitempty"`
+	ACL         *ACLChange     `json:"acl,omitempty"`
+}
+
+// Equal returns true if the values and the ACLs of both versions are the same
+func (d *KeyDiff) Equal() bool {
+	return len(d.JSONChanges) == 0 && d.ByteChange == nil && d.ACL == nil
+}
+
+func (p *provenance) Diff(dbName, key string, from, to *types.Version) (*KeyDiff, error) {
+	return diffVersions(p, dbName, key, from, to)
+}
+
+func diffVersions(p Provenance, dbName, key string, from, to *types.Version) (*KeyDiff, error) {
+	fromValue, err := historicalValueAt(p, dbName, key, from)
+	if err != nil {
+		return nil, err
+	}
+	toValue, err := historicalValueAt(p, dbName, key, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &KeyDiff{
+		DBName: dbName,
+		Key:    key,
+		From:   from,
+		To:     to,
+		ACL:    diffACL(fromValue.GetMetadata().GetAccessControl(), toValue.GetMetadata().GetAccessControl()),
+	}
+
+	oldDoc, oldErr := decodeJSON(fromValue.GetValue())
+	newDoc, newErr := decodeJSON(toValue.GetValue())
+	if oldErr == nil && newErr == nil {
+		diff.JSON = true
+		diff.JSONChanges, err = diffJSON("", oldDoc, newDoc, nil)
+		if err != nil {
+			return nil, err
+		}
+		return diff, nil
+	}
+
+	diff.ByteChange = diffBytes(fromValue.GetValue(), toValue.GetValue())
+	return diff, nil
+}
+
+// decodeJSON decodes a value holding a single JSON document, numbers are decoded as json.Number, so
+// integers beyond the precision of float64 are compared exactly
+func decodeJSON(value []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("value holds data after the JSON document")
+	}
+	return doc, nil
+}
+
+func historicalValueAt(p Provenance, dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	value, err := p.GetHistoricalDataAt(dbName, key, version)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get key '%s' in database '%s' at version %s", key, dbName, version)
+	}
+	if value == nil {
+		return nil, errors.Errorf("key '%s' in database '%s' has no value at version %s", key, dbName, version)
+	}
+	return value, nil
+}
+
+// diffJSON appends the changes from oldDoc to newDoc, values decoded by decodeJSON, to changes.
+// Objects are compared by member and arrays by index, any other change replaces the element.
+func diffJSON(path string, oldDoc, newDoc interface{}, changes []*JSONChange) ([]*JSONChange, error) {
+	switch oldTyped := oldDoc.(type) {
+	case map[string]interface{}:
+		if newTyped, ok := newDoc.(map[string]interface{}); ok {
+			return diffJSONObjects(path, oldTyped, newTyped, changes)
+		}
+	case []interface{}:
+		if newTyped, ok := newDoc.([]interface{}); ok {
+			return diffJSONArrays(path, oldTyped, newTyped, changes)
+		}
+	}
+
+	if reflect.DeepEqual(oldDoc, newDoc) {
+		return changes, nil
+	}
+	change, err := newJSONChange(JSONReplace, path, oldDoc, newDoc)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, change), nil
+}
+
+func diffJSONObjects(path string, oldObj, newObj map[string]interface{}, changes []*JSONChange) ([]*JSONChange, error) {
+	names := make([]string, 0, len(oldObj)+len(newObj))
+	for name := range oldObj {
+		names = append(names, name)
+	}
+	for name := range newObj {
+		if _, ok := oldObj[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var err error
+	for _, name := range names {
+		memberPath := path + "/" + escapeJSONPointer(name)
+		oldMember, inOld := oldObj[name]
+		newMember, inNew := newObj[name]
+		switch {
+		case !inOld:
+			changes, err = appendJSONChange(changes, JSONAdd, memberPath, nil, newMember)
+		case !inNew:
+			changes, err = appendJSONChange(changes, JSONRemove, memberPath, oldMember, nil)
+		default:
+			changes, err = diffJSON(memberPath, oldMember, newMember, changes)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+func diffJSONArrays(path string, oldArr, newArr []interface{}, changes []*JSONChange) ([]*JSONChange, error) {
+	var err error
+	for i := 0; i < len(oldArr) || i < len(newArr); i++ {
+		elemPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(oldArr):
+			changes, err = appendJSONChange(changes, JSONAdd, elemPath, nil, newArr[i])
+		case i >= len(newArr):
+			changes, err = appendJSONChange(changes, JSONRemove, elemPath, oldArr[i], nil)
+		default:
+			changes, err = diffJSON(elemPath, oldArr[i], newArr[i], changes)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+func appendJSONChange(changes []*JSONChange, op JSONChangeOp, path string, oldDoc, newDoc interface{}) ([]*JSONChange, error) {
+	change, err := newJSONChange(op, path, oldDoc, newDoc)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, change), nil
+}
+
+func newJSONChange(op JSONChangeOp, path string, oldDoc, newDoc interface{}) (*JSONChange, error) {
+	change := &JSONChange{
+		Op:   op,
+		Path: path,
+	}
+	var err error
+	if op != JSONAdd {
+		if change.Old, err = json.Marshal(oldDoc); err != nil {
+			return nil, errors.Wrapf(err, "failed to encode the old value at '%s'", path)
+		}
+	}
+	if op != JSONRemove {
+		if change.New, err = json.Marshal(newDoc); err != nil {
+			return nil, errors.Wrapf(err, "failed to encode the new value at '%s'", path)
+		}
+	}
+	return change, nil
+}
+
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func diffBytes(oldValue, newValue []byte) *ByteChange {
+	if bytes.Equal(oldValue, newValue) {
+		return nil
+	}
+	prefix := 0
+	for prefix < len(oldValue) && prefix < len(newValue) && oldValue[prefix] == newValue[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldValue)-prefix && suffix < len(newValue)-prefix &&
+		oldValue[len(oldValue)-1-suffix] == newValue[len(newValue)-1-suffix] {
+		suffix++
+	}
+	return &ByteChange{
+		Offset: prefix,
+		Old:    oldValue[prefix : len(oldValue)-suffix],
+		New:    newValue[prefix : len(newValue)-suffix],
+	}
+}
+
+func diffACL(oldACL, newACL *types.AccessControl) *ACLChange {
+	change := &ACLChange{
+		OldSignPolicyForWrite: oldACL.GetSignPolicyForWrite(),
+		NewSignPolicyForWrite: newACL.GetSignPolicyForWrite(),
+	}
+	change.ReadUsersAdded, change.ReadUsersRemoved = diffUsers(oldACL.GetReadUsers(), newACL.GetReadUsers())
+	change.ReadWriteUsersAdded, change.ReadWriteUsersRemoved = diffUsers(oldACL.GetReadWriteUsers(), newACL.GetReadWriteUsers())
+
+	if len(change.ReadUsersAdded) == 0 && len(change.ReadUsersRemoved) == 0 &&
+		len(change.ReadWriteUsersAdded) == 0 && len(change.ReadWriteUsersRemoved) == 0 &&
+		change.OldSignPolicyForWrite == change.NewSignPolicyForWrite {
+		return nil
+	}
+	return change
+}
+
+func diffUsers(oldUsers, newUsers map[string]bool) (added, removed []string) {
+	for userID, ok := range newUsers {
+		if ok && !oldUsers[userID] {
+			added = append(added, userID)
+		}
+	}
+	for userID, ok := range oldUsers {
+		if ok && !newUsers[userID] {
+			removed = append(removed, userID)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// RestoreVersion writes the value and ACL key had at version back to key, only if the committed version
+// of the key did not change since it was read
+func (d *dbSession) RestoreVersion(dbName, key string, version *types.Version) (string, *types.TxReceipt, error) {
+	p, err := d.Provenance()
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := historicalValueAt(p, dbName, key, version)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tx, err := d.DataTx()
+	if err != nil {
+		return "", nil, err
+	}
+	_, current, err := tx.Get(dbName, key)
+	tx.Abort()
+	if err != nil {
+		return "", nil, errors.WithMessagef(err, "failed to get the current version of key '%s' in database '%s'", key, dbName)
+	}
+
+	txID, receipt, err := d.CompareAndSwap(dbName, key, current.GetVersion(), value.GetValue(), value.GetMetadata().GetAccessControl())
+	if err != nil {
+		return txID, receipt, errors.WithMessagef(err, "failed to restore key '%s' in database '%s' to version %s", key, dbName, version)
+	}
+	return txID, receipt, nil
+}
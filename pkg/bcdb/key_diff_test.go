@@ -0,0 +1,136 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffVersions(t *testing.T) {
+	p := &historyProvenance{}
+	p.write(`{"name":"car","owner":"alice","tags":["red","fast"],"a/b":1}`, 2, 0)
+	p.write(`{"name":"car","owner":"bob","tags":["red"],"specs":{"doors":4}}`, 3, 0)
+	p.write("plain value", 4, 0)
+	p.write("plain VALUE", 5, 0)
+	p.values[1].Metadata.AccessControl = &types.AccessControl{
+		ReadUsers:      map[string]bool{"alice": true},
+		ReadWriteUsers: map[string]bool{"alice": true},
+	}
+	p.values[0].Metadata.AccessControl = &types.AccessControl{
+		ReadUsers:          map[string]bool{"alice": true, "bob": true},
+		SignPolicyForWrite: types.AccessControl_ALL,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		diff, err := diffVersions(p, "bdb", "key1", historyValue("", 2, 0).Metadata.Version, historyValue("", 3, 0).Metadata.Version)
+		require.NoError(t, err)
+		require.True(t, diff.JSON)
+		require.Nil(t, diff.ByteChange)
+		require.Nil(t, diff.ACL)
+		require.Equal(t, []*JSONChange{
+			{Op: JSONRemove, Path: "/a~1b", Old: json.RawMessage(`1`)},
+			{Op: JSONReplace, Path: "/owner", Old: json.RawMessage(`"alice"`), New: json.RawMessage(`"bob"`)},
+			{Op: JSONAdd, Path: "/specs", New: json.RawMessage(`{"doors":4}`)},
+			{Op: JSONRemove, Path: "/tags/1", Old: json.RawMessage(`"fast"`)},
+		}, diff.JSONChanges)
+		require.False(t, diff.Equal())
+
+		diff, err = diffVersions(p, "bdb", "key1", diff.To, diff.To)
+		require.NoError(t, err)
+		require.True(t, diff.Equal())
+	})
+
+	t.Run("large integers", func(t *testing.T) {
+		p := &historyProvenance{}
+		p.write(`{"id":9007199254740993,"amount":1.50}`, 2, 0)
+		p.write(`{"id":9007199254740992,"amount":1.50}`, 3, 0)
+		diff, err := diffVersions(p, "bdb", "key1", historyValue("", 2, 0).Metadata.Version, historyValue("", 3, 0).Metadata.Version)
+		require.NoError(t, err)
+		require.True(t, diff.JSON)
+		require.Equal(t, []*JSONChange{
+			{Op: JSONReplace, Path: "/id", Old: json.RawMessage(`9007199254740993`), New: json.RawMessage(`9007199254740992`)},
+		}, diff.JSONChanges)
+
+		// a value holding more than a JSON document is compared as bytes
+		p.write(`{"id":1} {"id":2}`, 4, 0)
+		diff, err = diffVersions(p, "bdb", "key1", historyValue("", 3, 0).Metadata.Version, historyValue("", 4, 0).Metadata.Version)
+		require.NoError(t, err)
+		require.False(t, diff.JSON)
+	})
+
+	t.Run("bytes and acl", func(t *testing.T) {
+		diff, err := diffVersions(p, "bdb", "key1", historyValue("", 4, 0).Metadata.Version, historyValue("", 5, 0).Metadata.Version)
+		require.NoError(t, err)
+		require.False(t, diff.JSON)
+		require.Empty(t, diff.JSONChanges)
+		require.Equal(t, &ByteChange{Offset: 6, Old: []byte("value"), New: []byte("VALUE")}, diff.ByteChange)
+		require.Equal(t, &ACLChange{
+			ReadUsersAdded:        []string{"bob"},
+			ReadWriteUsersRemoved: []string{"alice"},
+			OldSignPolicyForWrite: types.AccessControl_ANY,
+			NewSignPolicyForWrite: types.AccessControl_ALL,
+		}, diff.ACL)
+
+		// a JSON value compared with a non JSON value
+		diff, err = diffVersions(p, "bdb", "key1", historyValue("", 3, 0).Metadata.Version, historyValue("", 4, 0).Metadata.Version)
+		require.NoError(t, err)
+		require.False(t, diff.JSON)
+		require.Equal(t, 0, diff.ByteChange.Offset)
+		require.Equal(t, []byte("plain value"), diff.ByteChange.New)
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		_, err := diffVersions(p, "bdb", "key1", historyValue("", 2, 0).Metadata.Version, historyValue("", 7, 0).Metadata.Version)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "key 'key1' in database 'bdb' has no value at version")
+	})
+}
+
+func TestDiffBytes(t *testing.T) {
+	require.Nil(t, diffBytes([]byte("abc"), []byte("abc")))
+	require.Equal(t, &ByteChange{Offset: 3, Old: []byte{}, New: []byte("d")}, diffBytes([]byte("abc"), []byte("abcd")))
+	require.Equal(t, &ByteChange{Offset: 2, Old: []byte("a"), New: []byte{}}, diffBytes([]byte("aaa"), []byte("aa")))
+	require.Equal(t, &ByteChange{Offset: 0, New: []byte("xy")}, diffBytes(nil, []byte("xy")))
+}
+
+func TestRestoreVersion(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	receipt := putKeySync(t, "bdb", "key1", `{"owner":"alice"}`, "alice", aliceSession)
+	version := &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	}
+	receipt = putKeySync(t, "bdb", "key1", `{"owner":"bob"}`, "alice", aliceSession)
+	current := &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	}
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+	diff, err := p.Diff("bdb", "key1", version, current)
+	require.NoError(t, err)
+	require.Equal(t, []*JSONChange{
+		{Op: JSONReplace, Path: "/owner", Old: json.RawMessage(`"alice"`), New: json.RawMessage(`"bob"`)},
+	}, diff.JSONChanges)
+
+	_, receipt, err = aliceSession.RestoreVersion("bdb", "key1", version)
+	require.NoError(t, err)
+	require.Equal(t, types.Flag_VALID, receipt.GetHeader().GetValidationInfo()[receipt.GetTxIndex()].GetFlag())
+	validateValue(t, "key1", `{"owner":"alice"}`, aliceSession)
+
+	_, _, err = aliceSession.RestoreVersion("bdb", "key1", &types.Version{BlockNum: 100})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrVersionMismatch))
+}
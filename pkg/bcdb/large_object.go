@@ -0,0 +1,332 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultLargeObjectChunkSize default size of a large object chunk
+	DefaultLargeObjectChunkSize = 64 * 1024
+	// DefaultLargeObjectChunksPerTx default number of chunks written by a single transaction
+	DefaultLargeObjectChunksPerTx = 4
+
+	largeObjectChunkKeySeparator = "~chunk~"
+)
+
+// LargeObjectStore stores values larger than the server's block size. A large object is split into
+// chunks, each stored under its own chunk key, and a manifest holding the chunk hashes is stored
+// under the object key. The chunks are written by one or more transactions, and the manifest is
+// written by the last one, so the object is visible to readers only when all its chunks are committed.
+// Each Put writes the chunks of a new upload of the object, under keys that differ from the chunk
+// keys of the replaced object and of any other upload, so the replaced object stays readable until
+// the new manifest is committed, and stays intact if the upload fails.
+type LargeObjectStore interface {
+	// Put reads the object from r and stores it under key, replacing the existing object, if any.
+	// The chunks of the replaced object are deleted after the new manifest is committed. If Put fails
+	// the object is left unchanged and the chunks committed by the upload are deleted, unless the
+	// commit of the manifest itself fails, as the manifest may still be committed.
+	Put(dbName, key string, r io.Reader, acl *types.AccessControl) (*LargeObjectManifest, error)
+	// Get reassembles the object stored under key into w, verifying the chunk hashes,
+	// returns nil manifest if the object does not exist. Get is not isolated from a concurrent
+	// Put or Delete of the object: if the object is replaced or deleted while it is read, Get
+	// fails with ErrLargeObjectChanged, after writing part of the object to w, and may be retried.
+	Get(dbName, key string, w io.Writer) (*LargeObjectManifest, error)
+	// Delete deletes the manifest and all the chunks of the object stored under key
+	Delete(dbName, key string) error
+}
+
+// LargeObjectManifest describes a large object, it is stored under the object key
+type LargeObjectManifest struct {
+	// Size of the object in bytes
+	Size uint64 `json:"size"`
+	// ChunkSize size of each chunk in bytes, except the last one
+	ChunkSize uint64 `json:"chunk_size"`
+	// ChunkHashes SHA256 hashes of the chunks, in order
+	ChunkHashes [][]byte `json:"chunk_hashes"`
+	// Hash SHA256 hash of the whole object
+	Hash []byte `json:"hash"`
+	// Generation incremented by each Put of the object, used to detect concurrent writers
+	Generation uint64 `json:"generation"`
+	// UploadID identifies the Put that wrote the object, part of the chunk keys
+	UploadID string `json:"upload_id"`
+}
+
+// ErrLargeObjectChanged is returned by Get if the object was replaced or deleted while it was read
+var ErrLargeObjectChanged = errors.New("large object was replaced or deleted while it was read")
+
+type largeObjectStore struct {
+	session     DBSession
+	chunkSize   int
+	chunksPerTx int
+}
+
+// NewLargeObjectStore creates a large object store, which splits objects to chunks of chunkSize bytes and
+// writes up to chunksPerTx chunks in each transaction. Zero values select the defaults. Note that the
+// size of a transaction, chunkSize * chunksPerTx plus encoding overhead, must not exceed the server's block size.
+func NewLargeObjectStore(session DBSession, chunkSize, chunksPerTx int) (LargeObjectStore, error) {
+	if chunkSize < 0 || chunksPerTx < 0 {
+		return nil, errors.Errorf("invalid chunk size %d or chunks per transaction %d", chunkSize, chunksPerTx)
+	}
+	if chunkSize == 0 {
+		chunkSize = DefaultLargeObjectChunkSize
+	}
+	if chunksPerTx == 0 {
+		chunksPerTx = DefaultLargeObjectChunksPerTx
+	}
+	return &largeObjectStore{
+		session:     session,
+		chunkSize:   chunkSize,
+		chunksPerTx: chunksPerTx,
+	}, nil
+}
+
+// LargeObjectChunkKey returns the key of chunk index of the given upload of the large object stored under key
+func LargeObjectChunkKey(key, uploadID string, index int) string {
+	return fmt.Sprintf("%s%s%s~%08d", key, largeObjectChunkKeySeparator, uploadID, index)
+}
+
+func (s *largeObjectStore) Put(dbName, key string, r io.Reader, acl *types.AccessControl) (*LargeObjectManifest, error) {
+	oldManifest, err := s.manifest(dbName, key)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &LargeObjectManifest{
+		ChunkSize:  uint64(s.chunkSize),
+		Generation: 1,
+	}
+	if oldManifest != nil {
+		manifest.Generation = oldManifest.Generation + 1
+	}
+	// the upload ID tells apart the chunks of concurrent writers of the same generation
+	nonce := make([]byte, 8)
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	manifest.UploadID = fmt.Sprintf("%d-%x", manifest.Generation, nonce)
+	objectHash := sha256.New()
+	buf := make([]byte, s.chunkSize)
+
+	var tx DataTxContext
+	chunksInTx := 0
+	// committed number of chunks committed by the upload, deleted if the upload fails
+	committed := 0
+	fail := func(err error) (*LargeObjectManifest, error) {
+		if tx != nil {
+			tx.Abort()
+		}
+		if committed == 0 {
+			return nil, err
+		}
+		if deleteErr := s.deleteChunks(dbName, key, manifest.UploadID, committed, nil); deleteErr != nil {
+			return nil, errors.WithMessagef(err, "failed to delete the chunks of the failed upload: %s", deleteErr)
+		}
+		return nil, err
+	}
+
+	for index := 0; ; index++ {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return fail(errors.Wrapf(readErr, "failed to read large object '%s' in database '%s'", key, dbName))
+		}
+		if n == 0 {
+			break
+		}
+
+		chunk := make([]byte, n)
+		copy(chunk, buf[:n])
+		chunkHash := sha256.Sum256(chunk)
+		objectHash.Write(chunk)
+		manifest.ChunkHashes = append(manifest.ChunkHashes, chunkHash[:])
+		manifest.Size += uint64(n)
+
+		if tx == nil {
+			if tx, err = s.session.DataTx(); err != nil {
+				return fail(err)
+			}
+		}
+		if err = tx.Put(dbName, LargeObjectChunkKey(key, manifest.UploadID, index), chunk, acl); err != nil {
+			return fail(err)
+		}
+		chunksInTx++
+
+		if readErr != nil {
+			break
+		}
+		if chunksInTx == s.chunksPerTx {
+			err = s.commit(tx, dbName, key)
+			tx = nil
+			if err != nil {
+				return fail(err)
+			}
+			committed += chunksInTx
+			chunksInTx = 0
+		}
+	}
+	manifest.Hash = objectHash.Sum(nil)
+
+	if tx == nil {
+		if tx, err = s.session.DataTx(); err != nil {
+			return fail(err)
+		}
+	}
+	// reading the manifest in the tx that replaces it fails the commit if a concurrent Put
+	// replaced the object meanwhile, as both would write the chunks of the same generation
+	currentManifest := &LargeObjectManifest{}
+	meta, err := tx.GetJSON(dbName, key, currentManifest)
+	if err != nil {
+		return fail(err)
+	}
+	if (meta == nil) != (oldManifest == nil) || (meta != nil && currentManifest.Generation != oldManifest.Generation) {
+		return fail(errors.Errorf("large object '%s' in database '%s' was changed by another writer", key, dbName))
+	}
+	if err = tx.PutJSON(dbName, key, manifest, acl); err != nil {
+		return fail(err)
+	}
+	if err = s.commit(tx, dbName, key); err != nil {
+		return nil, err
+	}
+
+	if oldManifest != nil {
+		if err = s.deleteChunks(dbName, key, oldManifest.UploadID, len(oldManifest.ChunkHashes), nil); err != nil {
+			return nil, errors.WithMessagef(err, "large object '%s' in database '%s' was replaced, but failed to delete the chunks of generation %d", key, dbName, oldManifest.Generation)
+		}
+	}
+	return manifest, nil
+}
+
+func (s *largeObjectStore) Get(dbName, key string, w io.Writer) (*LargeObjectManifest, error) {
+	tx, err := s.session.DataTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Abort()
+
+	manifest := &LargeObjectManifest{}
+	meta, err := tx.GetJSON(dbName, key, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	objectHash := sha256.New()
+	var size uint64
+	for index, expectedHash := range manifest.ChunkHashes {
+		chunkKey := LargeObjectChunkKey(key, manifest.UploadID, index)
+		chunk, _, err := tx.Get(dbName, chunkKey)
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			// the chunks of a replaced or deleted object are deleted after its manifest
+			current, err := s.manifest(dbName, key)
+			if err != nil {
+				return nil, err
+			}
+			if current == nil || current.UploadID != manifest.UploadID {
+				return nil, errors.WithMessagef(ErrLargeObjectChanged, "failed to get large object '%s' in database '%s'", key, dbName)
+			}
+			return nil, errors.Errorf("chunk %d of large object '%s' in database '%s' is missing", index, key, dbName)
+		}
+		chunkHash := sha256.Sum256(chunk)
+		if !bytes.Equal(chunkHash[:], expectedHash) {
+			return nil, errors.Errorf("hash of chunk %d of large object '%s' in database '%s' does not match the manifest", index, key, dbName)
+		}
+		objectHash.Write(chunk)
+		size += uint64(len(chunk))
+		if _, err = w.Write(chunk); err != nil {
+			return nil, errors.Wrapf(err, "failed to write large object '%s' in database '%s'", key, dbName)
+		}
+	}
+
+	if size != manifest.Size || !bytes.Equal(objectHash.Sum(nil), manifest.Hash) {
+		return nil, errors.Errorf("large object '%s' in database '%s' does not match the manifest size or hash", key, dbName)
+	}
+	return manifest, nil
+}
+
+func (s *largeObjectStore) Delete(dbName, key string) error {
+	manifest, err := s.manifest(dbName, key)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return errors.Errorf("large object '%s' in database '%s' does not exist", key, dbName)
+	}
+
+	// the manifest is deleted first, so readers never see an object with missing chunks
+	tx, err := s.session.DataTx()
+	if err != nil {
+		return err
+	}
+	if err = tx.Delete(dbName, key); err != nil {
+		tx.Abort()
+		return err
+	}
+	return s.deleteChunks(dbName, key, manifest.UploadID, len(manifest.ChunkHashes), tx)
+}
+
+// deleteChunks deletes the first count chunks of the given upload of the object, starting with tx, if not nil
+func (s *largeObjectStore) deleteChunks(dbName, key, uploadID string, count int, tx DataTxContext) error {
+	var err error
+	chunksInTx := 0
+	for index := 0; index < count; index++ {
+		if tx == nil {
+			if tx, err = s.session.DataTx(); err != nil {
+				return err
+			}
+		}
+		if err = tx.Delete(dbName, LargeObjectChunkKey(key, uploadID, index)); err != nil {
+			tx.Abort()
+			return err
+		}
+		chunksInTx++
+		if chunksInTx == s.chunksPerTx {
+			if err = s.commit(tx, dbName, key); err != nil {
+				return err
+			}
+			tx = nil
+			chunksInTx = 0
+		}
+	}
+	if tx == nil {
+		return nil
+	}
+	return s.commit(tx, dbName, key)
+}
+
+func (s *largeObjectStore) manifest(dbName, key string) (*LargeObjectManifest, error) {
+	tx, err := s.session.DataTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Abort()
+
+	manifest := &LargeObjectManifest{}
+	meta, err := tx.GetJSON(dbName, key, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+	return manifest, nil
+}
+
+func (s *largeObjectStore) commit(tx DataTxContext, dbName, key string) error {
+	if _, _, err := tx.Commit(true); err != nil {
+		return errors.WithMessagef(err, "failed to commit large object '%s' in database '%s'", key, dbName)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// memSession keeps the database in memory, the writes of a tx are applied when it is committed
+type memSession struct {
+	DBSession
+	mutex sync.Mutex
+	state map[string][]byte
+}
+
+func (s *memSession) DataTx() (DataTxContext, error) {
+	return &memDataTx{session: s, writes: map[string][]byte{}}, nil
+}
+
+func (s *memSession) keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var keys []string
+	for k := range s.state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type memDataTx struct {
+	DataTxContext
+	session *memSession
+	// writes nil value for deleted keys
+	writes map[string][]byte
+}
+
+func (tx *memDataTx) Get(_, key string) ([]byte, *types.Metadata, error) {
+	tx.session.mutex.Lock()
+	defer tx.session.mutex.Unlock()
+	value, ok := tx.session.state[key]
+	if !ok {
+		return nil, nil, nil
+	}
+	return value, &types.Metadata{}, nil
+}
+
+func (tx *memDataTx) GetJSON(dbName, key string, v interface{}) (*types.Metadata, error) {
+	value, meta, err := tx.Get(dbName, key)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	return meta, json.Unmarshal(value, v)
+}
+
+func (tx *memDataTx) Put(_, key string, value []byte, _ *types.AccessControl) error {
+	tx.writes[key] = value
+	return nil
+}
+
+func (tx *memDataTx) PutJSON(dbName, key string, v interface{}, acl *types.AccessControl) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Put(dbName, key, value, acl)
+}
+
+func (tx *memDataTx) Delete(_, key string) error {
+	tx.writes[key] = nil
+	return nil
+}
+
+func (tx *memDataTx) Commit(bool) (string, *types.TxReceipt, error) {
+	tx.session.mutex.Lock()
+	defer tx.session.mutex.Unlock()
+	for k, v := range tx.writes {
+		if v == nil {
+			delete(tx.session.state, k)
+		} else {
+			tx.session.state[k] = v
+		}
+	}
+	return "", nil, nil
+}
+
+func (tx *memDataTx) Abort() error {
+	return nil
+}
+
+// failingReader returns object, calling onRead before each read, and fails after failAfter bytes
+type failingReader struct {
+	object    []byte
+	failAfter int
+	offset    int
+	onRead    func()
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	r.onRead()
+	if r.offset == len(r.object) {
+		return 0, io.EOF
+	}
+	if r.offset >= r.failAfter {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > r.failAfter-r.offset {
+		p = p[:r.failAfter-r.offset]
+	}
+	n := copy(p, r.object[r.offset:])
+	r.offset += n
+	if r.offset == len(r.object) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestLargeObjectStore_PutGetDelete(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	store, err := NewLargeObjectStore(adminSession, 16*1024, 4)
+	require.NoError(t, err)
+
+	object := make([]byte, 300*1024+100)
+	_, err = rand.Read(object)
+	require.NoError(t, err)
+
+	manifest, err := store.Put("bdb", "doc1", bytes.NewReader(object), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(object)), manifest.Size)
+	require.Len(t, manifest.ChunkHashes, 19)
+
+	buf := &bytes.Buffer{}
+	readManifest, err := store.Get("bdb", "doc1", buf)
+	require.NoError(t, err)
+	require.Equal(t, manifest, readManifest)
+	require.Equal(t, object, buf.Bytes())
+
+	// replace with a smaller object, the chunks of the replaced object are deleted
+	replaced := manifest
+	smallObject := object[:40*1024]
+	manifest, err = store.Put("bdb", "doc1", bytes.NewReader(smallObject), nil)
+	require.NoError(t, err)
+	require.Len(t, manifest.ChunkHashes, 3)
+	require.Equal(t, uint64(2), manifest.Generation)
+
+	buf.Reset()
+	_, err = store.Get("bdb", "doc1", buf)
+	require.NoError(t, err)
+	require.Equal(t, smallObject, buf.Bytes())
+
+	tx, err := adminSession.DataTx()
+	require.NoError(t, err)
+	for i := 0; i < 19; i++ {
+		chunk, _, err := tx.Get("bdb", LargeObjectChunkKey("doc1", replaced.UploadID, i))
+		require.NoError(t, err)
+		require.Nil(t, chunk)
+	}
+
+	// tampered chunk is detected
+	tx, err = adminSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("bdb", LargeObjectChunkKey("doc1", manifest.UploadID, 1), []byte("tampered"), nil))
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+	_, err = store.Get("bdb", "doc1", &bytes.Buffer{})
+	require.EqualError(t, err, "hash of chunk 1 of large object 'doc1' in database 'bdb' does not match the manifest")
+
+	require.NoError(t, store.Delete("bdb", "doc1"))
+	deleted := manifest
+	manifest, err = store.Get("bdb", "doc1", &bytes.Buffer{})
+	require.NoError(t, err)
+	require.Nil(t, manifest)
+	tx, err = adminSession.DataTx()
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		chunk, _, err := tx.Get("bdb", LargeObjectChunkKey("doc1", deleted.UploadID, i))
+		require.NoError(t, err)
+		require.Nil(t, chunk)
+	}
+
+	err = store.Delete("bdb", "doc1")
+	require.EqualError(t, err, "large object 'doc1' in database 'bdb' does not exist")
+
+	// empty object
+	manifest, err = store.Put("bdb", "empty", bytes.NewReader(nil), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), manifest.Size)
+	buf.Reset()
+	_, err = store.Get("bdb", "empty", buf)
+	require.NoError(t, err)
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestLargeObjectStore_ChunkKey(t *testing.T) {
+	require.Equal(t, "doc1~chunk~3-0a1b~00000012", LargeObjectChunkKey("doc1", "3-0a1b", 12))
+
+	_, err := NewLargeObjectStore(nil, -1, 0)
+	require.EqualError(t, err, "invalid chunk size -1 or chunks per transaction 0")
+}
+
+func TestLargeObjectStore_ReplaceFailedUpload(t *testing.T) {
+	session := &memSession{state: map[string][]byte{}}
+	store, err := NewLargeObjectStore(session, 100, 2)
+	require.NoError(t, err)
+
+	object := make([]byte, 1000)
+	_, err = rand.Read(object)
+	require.NoError(t, err)
+	_, err = store.Put("bdb", "doc1", bytes.NewReader(object), nil)
+	require.NoError(t, err)
+	keys := session.keys()
+	require.Len(t, keys, 11)
+
+	requireObject := func(expected []byte) {
+		buf := &bytes.Buffer{}
+		_, err := store.Get("bdb", "doc1", buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, buf.Bytes())
+	}
+
+	// the replaced object is readable while the new one is uploaded, and after the upload fails
+	newObject := make([]byte, 1500)
+	_, err = rand.Read(newObject)
+	require.NoError(t, err)
+	reads := 0
+	_, err = store.Put("bdb", "doc1", &failingReader{
+		object:    newObject,
+		failAfter: 700,
+		onRead: func() {
+			reads++
+			requireObject(object)
+		},
+	}, nil)
+	require.EqualError(t, err, "failed to read large object 'doc1' in database 'bdb': connection reset")
+	require.Equal(t, 8, reads)
+	requireObject(object)
+	// the chunks committed by the failed upload are deleted
+	require.Equal(t, keys, session.keys())
+
+	// the next upload replaces the object and deletes the chunks of the replaced one
+	manifest, err := store.Put("bdb", "doc1", bytes.NewReader(newObject), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), manifest.Generation)
+	requireObject(newObject)
+	keys = session.keys()
+	require.Len(t, keys, 16)
+	for _, k := range keys[1:] {
+		require.Contains(t, k, "doc1~chunk~"+manifest.UploadID+"~")
+	}
+
+	// a concurrent replacement is detected
+	_, err = store.Put("bdb", "doc1", &failingReader{
+		object:    object,
+		failAfter: len(object),
+		onRead: func() {
+			session.mutex.Lock()
+			defer session.mutex.Unlock()
+			session.state["doc1"] = []byte(`{"generation":5}`)
+		},
+	}, nil)
+	require.EqualError(t, err, "large object 'doc1' in database 'bdb' was changed by another writer")
+	// the chunks of the upload that lost are deleted, the chunks of the other writer are kept
+	require.Equal(t, keys, session.keys())
+}
+
+func TestLargeObjectStore_ReplacedWhileRead(t *testing.T) {
+	session := &memSession{state: map[string][]byte{}}
+	store, err := NewLargeObjectStore(session, 100, 2)
+	require.NoError(t, err)
+
+	object := make([]byte, 1000)
+	_, err = rand.Read(object)
+	require.NoError(t, err)
+	_, err = store.Put("bdb", "doc1", bytes.NewReader(object), nil)
+	require.NoError(t, err)
+
+	// the object is replaced once its first chunk was read, so the chunks of the manifest being read are deleted
+	newObject := object[:500]
+	replaced := false
+	_, err = store.Get("bdb", "doc1", writerFunc(func(p []byte) (int, error) {
+		if !replaced {
+			replaced = true
+			_, err := store.Put("bdb", "doc1", bytes.NewReader(newObject), nil)
+			require.NoError(t, err)
+		}
+		return len(p), nil
+	}))
+	require.EqualError(t, err, "failed to get large object 'doc1' in database 'bdb': large object was replaced or deleted while it was read")
+	require.True(t, errors.Is(err, ErrLargeObjectChanged))
+
+	// a retry reads the new object
+	buf := &bytes.Buffer{}
+	_, err = store.Get("bdb", "doc1", buf)
+	require.NoError(t, err)
+	require.Equal(t, newObject, buf.Bytes())
+
+	// a chunk missing from the current object is not a change
+	session.mutex.Lock()
+	for k := range session.state {
+		if k != "doc1" {
+			delete(session.state, k)
+			break
+		}
+	}
+	session.mutex.Unlock()
+	_, err = store.Get("bdb", "doc1", &bytes.Buffer{})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrLargeObjectChanged))
+	require.Contains(t, err.Error(), "of large object 'doc1' in database 'bdb' is missing")
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
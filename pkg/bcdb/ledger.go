@@ -3,9 +3,14 @@
 package bcdb
 
 import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger-labs/orion-server/pkg/constants"
 	"github.com/hyperledger-labs/orion-server/pkg/state"
 	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
 )
 
 type ledger struct {
@@ -13,10 +18,20 @@ type ledger struct {
 }
 
 func (l *ledger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
-	path := constants.URLForLedgerBlock(blockNum)
+	header, err := l.queryBlockHeader(blockNum)
+	if err != nil {
+		l.logger.Errorf("failed to execute ledger block query %s, due to %s", constants.URLForLedgerBlock(blockNum), err)
+		return nil, err
+	}
+	return header, nil
+}
+
+// queryBlockHeader queries the header of block blockNum without logging a failure, for callers that
+// expect the block may not be committed yet, e.g. the block listener polling the ledger tip
+func (l *ledger) queryBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
 	resEnv := &types.GetBlockResponseEnvelope{}
 	err := l.handleRequest(
-		path,
+		constants.URLForLedgerBlock(blockNum),
 		&types.GetBlockQuery{
 			UserId:      l.userID,
 			BlockNumber: blockNum,
@@ -24,7 +39,6 @@ func (l *ledger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
 		resEnv,
 	)
 	if err != nil {
-		l.logger.Errorf("failed to execute ledger block query %s, due to %s", path, err)
 		return nil, err
 	}
 
@@ -34,6 +48,18 @@ func (l *ledger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
 }
 
 func (l *ledger) GetLedgerPath(startBlock, endBlock uint64) ([]*types.BlockHeader, error) {
+	headers, err := l.fetchLedgerPath(startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	if err = VerifyLedgerPath(headers, startBlock, endBlock); err != nil {
+		l.logger.Errorf("failed to verify ledger path from block %d to block %d, due to %s", startBlock, endBlock, err)
+		return nil, err
+	}
+	return headers, nil
+}
+
+func (l *ledger) fetchLedgerPath(startBlock, endBlock uint64) ([]*types.BlockHeader, error) {
 	path := constants.URLForLedgerPath(startBlock, endBlock)
 	resEnv := &types.GetLedgerPathResponseEnvelope{}
 	err := l.handleRequest(
@@ -134,3 +160,132 @@ func CalculateValueHash(dbName, key string, value []byte) ([]byte, error) {
 	}
 	return valueHash, nil
 }
+
+// TxVerificationReport describes the checks carried out by Ledger.VerifyTransaction
+type TxVerificationReport struct {
+	TxID     string
+	BlockNum uint64
+	TxIndex  uint64
+	// Flag validation flag of the tx, as recorded in the block header
+	Flag types.Flag
+	// TxIncluded the tx is proven to be part of the block tx merkle tree
+	TxIncluded bool
+	// AnchorBlockNum number of the trusted block the header was linked to
+	AnchorBlockNum uint64
+	// HeaderLinked the block header is connected to the anchor by a verified ledger path
+	HeaderLinked bool
+	// LedgerPath numbers of the blocks on the path between the block header and the anchor
+	LedgerPath []uint64
+	// Failure describes the first check that failed, empty if the tx is verified
+	Failure string
+}
+
+// Verified returns true if all the checks passed, note that an invalid tx can be verified as well,
+// i.e. it is part of the ledger, while its Flag tells it was rejected
+func (r *TxVerificationReport) Verified() bool {
+	return r.TxIncluded && r.HeaderLinked && r.Failure == ""
+}
+
+func (l *ledger) VerifyTransaction(tx proto.Message, receipt *types.TxReceipt, anchor *types.BlockHeader) (*TxVerificationReport, error) {
+	header := receipt.GetHeader()
+	if header == nil {
+		return nil, errors.New("receipt has no block header")
+	}
+	report := &TxVerificationReport{
+		TxID:     txIDOf(tx),
+		BlockNum: header.GetBaseHeader().GetNumber(),
+		TxIndex:  receipt.GetTxIndex(),
+	}
+	if receipt.GetTxIndex() >= uint64(len(header.GetValidationInfo())) {
+		report.Failure = fmt.Sprintf("tx index %d is out of range of block %d", receipt.GetTxIndex(), report.BlockNum)
+		return report, nil
+	}
+	report.Flag = header.GetValidationInfo()[receipt.GetTxIndex()].GetFlag()
+
+	txProof, err := l.GetTransactionProof(report.BlockNum, int(report.TxIndex))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get proof of tx %s", report.TxID)
+	}
+	report.TxIncluded, err = txProof.Verify(receipt, tx)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to verify proof of tx %s", report.TxID)
+	}
+	if !report.TxIncluded {
+		report.Failure = fmt.Sprintf("tx %s is not included in the tx merkle tree of block %d", report.TxID, report.BlockNum)
+		return report, nil
+	}
+
+	if anchor == nil {
+		if anchor, err = l.GetBlockHeader(1); err != nil {
+			return nil, errors.WithMessage(err, "failed to get genesis block header")
+		}
+	}
+	report.AnchorBlockNum = anchor.GetBaseHeader().GetNumber()
+	if failure, err := l.linkHeaders(header, anchor, report); err != nil || failure != "" {
+		report.Failure = failure
+		return report, err
+	}
+	report.HeaderLinked = true
+	return report, nil
+}
+
+// linkHeaders connects header and anchor by a verified ledger path, returns a failure description if they are not connected
+func (l *ledger) linkHeaders(header, anchor *types.BlockHeader, report *TxVerificationReport) (string, error) {
+	headerHash, err := CalculateBlockHeaderHash(header)
+	if err != nil {
+		return "", err
+	}
+	anchorHash, err := CalculateBlockHeaderHash(anchor)
+	if err != nil {
+		return "", err
+	}
+	if report.BlockNum == report.AnchorBlockNum {
+		report.LedgerPath = []uint64{report.BlockNum}
+		if !bytes.Equal(headerHash, anchorHash) {
+			return fmt.Sprintf("header of block %d does not match the anchor", report.BlockNum), nil
+		}
+		return "", nil
+	}
+
+	start, end := report.AnchorBlockNum, report.BlockNum
+	startHash, endHash := anchorHash, headerHash
+	if start > end {
+		start, end = end, start
+		startHash, endHash = endHash, startHash
+	}
+	path, err := l.fetchLedgerPath(start, end)
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed to get ledger path from block %d to block %d", start, end)
+	}
+	for _, h := range path {
+		report.LedgerPath = append(report.LedgerPath, h.GetBaseHeader().GetNumber())
+	}
+	if err = VerifyLedgerPath(path, start, end); err != nil {
+		return err.Error(), nil
+	}
+
+	fork, err := matchPathEnds(path, endHash, startHash)
+	if err != nil {
+		return "", err
+	}
+	if fork != nil {
+		return fmt.Sprintf("header of block %d on the ledger path does not match the supplied header", fork.BlockNum), nil
+	}
+	return "", nil
+}
+
+// txIDOf returns the ID of a tx envelope of any type, or empty string if tx is not a tx envelope
+func txIDOf(tx proto.Message) string {
+	switch env := tx.(type) {
+	case *types.DataTxEnvelope:
+		return env.GetPayload().GetTxId()
+	case *types.UserAdministrationTxEnvelope:
+		return env.GetPayload().GetTxId()
+	case *types.DBAdministrationTxEnvelope:
+		return env.GetPayload().GetTxId()
+	case *types.ConfigTxEnvelope:
+		return env.GetPayload().GetTxId()
+	default:
+		return ""
+	}
+}
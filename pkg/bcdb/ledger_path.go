@@ -0,0 +1,91 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/crypto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// skipListBase is the base of the block skip list, block n links to blocks n-1, n-2, n-4, ...
+// as long as n-1 is divisible by the distance, same as in the server block store
+const skipListBase = uint64(2)
+
+// CalculateBlockHeaderHash computes the hash of a block header, i.e. the block hash
+// referenced by the skip list hashes of later blocks
+func CalculateBlockHeaderHash(header *types.BlockHeader) ([]byte, error) {
+	headerBytes, err := proto.Marshal(header)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't marshal block header %d", header.GetBaseHeader().GetNumber())
+	}
+	return crypto.ComputeSHA256Hash(headerBytes)
+}
+
+// VerifyLedgerPath checks that headers, as returned by GetLedgerPath, form a valid path in the blocks skip
+// list from block endBlock down to block startBlock: the first header is endBlock, the last one is startBlock,
+// and the hash of every header is the skip list hash stored for it in the preceding header.
+// Returns an error naming the broken link, if any.
+func VerifyLedgerPath(headers []*types.BlockHeader, startBlock, endBlock uint64) error {
+	if len(headers) == 0 {
+		return errors.Errorf("ledger path from block %d to block %d is empty", startBlock, endBlock)
+	}
+	if first := headers[0].GetBaseHeader().GetNumber(); first != endBlock {
+		return errors.Errorf("ledger path starts at block %d, expected block %d", first, endBlock)
+	}
+	if last := headers[len(headers)-1].GetBaseHeader().GetNumber(); last != startBlock {
+		return errors.Errorf("ledger path ends at block %d, expected block %d", last, startBlock)
+	}
+
+	for i := 0; i < len(headers)-1; i++ {
+		from := headers[i].GetBaseHeader().GetNumber()
+		to := headers[i+1].GetBaseHeader().GetNumber()
+
+		linkIndex := -1
+		for j, link := range skipListLinks(from) {
+			if link == to {
+				linkIndex = j
+				break
+			}
+		}
+		if linkIndex < 0 {
+			return errors.Errorf("ledger path is broken between block %d and block %d: block %d does not link to block %d in the skip list", from, to, from, to)
+		}
+		skipchainHashes := headers[i].GetSkipchainHashes()
+		if linkIndex >= len(skipchainHashes) {
+			return errors.Errorf("ledger path is broken between block %d and block %d: block %d has %d skip list hashes, link to block %d is missing", from, to, from, len(skipchainHashes), to)
+		}
+
+		hash, err := CalculateBlockHeaderHash(headers[i+1])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, skipchainHashes[linkIndex]) {
+			return errors.Errorf("ledger path is broken between block %d and block %d: hash of block %d does not match skip list hash %d of block %d", from, to, to, linkIndex, from)
+		}
+	}
+	return nil
+}
+
+// skipListLinks returns the numbers of the blocks block blockNum links to, in the order of its skip list hashes
+func skipListLinks(blockNum uint64) []uint64 {
+	var links []uint64
+	if blockNum > 1 {
+		distance := uint64(1)
+		for i := uint64(0); i < skipListHeight(blockNum-1); i++ {
+			links = append(links, blockNum-distance)
+			distance *= skipListBase
+		}
+	}
+	return links
+}
+
+func skipListHeight(blockNum uint64) uint64 {
+	if blockNum%skipListBase != 0 {
+		return 1
+	}
+	return 1 + skipListHeight(blockNum/skipListBase)
+}
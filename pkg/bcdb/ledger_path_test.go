@@ -0,0 +1,118 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// testLedgerHeaders creates headers of blocks 1 to n, linked by a valid skip list, headers[i] is block i+1
+func testLedgerHeaders(t *testing.T, n int) []*types.BlockHeader {
+	var headers []*types.BlockHeader
+	for i := 1; i <= n; i++ {
+		header := &types.BlockHeader{
+			BaseHeader: &types.BlockHeaderBase{
+				Number: uint64(i),
+			},
+			TxMerkelTreeRootHash: []byte{byte(i)},
+		}
+		for _, link := range skipListLinks(uint64(i)) {
+			hash, err := CalculateBlockHeaderHash(headers[link-1])
+			require.NoError(t, err)
+			header.SkipchainHashes = append(header.SkipchainHashes, hash)
+		}
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestSkipListLinks(t *testing.T) {
+	require.Empty(t, skipListLinks(1))
+	require.Equal(t, []uint64{1}, skipListLinks(2))
+	require.Equal(t, []uint64{2, 1}, skipListLinks(3))
+	require.Equal(t, []uint64{4, 3, 1}, skipListLinks(5))
+	require.Equal(t, []uint64{5}, skipListLinks(6))
+	require.Equal(t, []uint64{8, 7, 5, 1}, skipListLinks(9))
+}
+
+func TestVerifyLedgerPath(t *testing.T) {
+	headers := testLedgerHeaders(t, 10)
+	path := func(blocks ...int) []*types.BlockHeader {
+		var p []*types.BlockHeader
+		for _, b := range blocks {
+			p = append(p, headers[b-1])
+		}
+		return p
+	}
+
+	require.NoError(t, VerifyLedgerPath(path(3, 2), 2, 3))
+	require.NoError(t, VerifyLedgerPath(path(6, 5, 1), 1, 6))
+	require.NoError(t, VerifyLedgerPath(path(10, 9, 1), 1, 10))
+	require.NoError(t, VerifyLedgerPath(path(4), 4, 4))
+
+	tamperedHeader := proto.Clone(headers[4]).(*types.BlockHeader)
+	tamperedHeader.TxMerkelTreeRootHash = []byte("tampered")
+
+	tests := []struct {
+		name       string
+		headers    []*types.BlockHeader
+		start      uint64
+		end        uint64
+		errMessage string
+	}{
+		{
+			name:       "empty path",
+			start:      1,
+			end:        6,
+			errMessage: "ledger path from block 1 to block 6 is empty",
+		},
+		{
+			name:       "wrong first block",
+			headers:    path(5, 1),
+			start:      1,
+			end:        6,
+			errMessage: "ledger path starts at block 5, expected block 6",
+		},
+		{
+			name:       "wrong last block",
+			headers:    path(6, 5),
+			start:      1,
+			end:        6,
+			errMessage: "ledger path ends at block 5, expected block 1",
+		},
+		{
+			name:       "missing link",
+			headers:    path(6, 4, 3, 1),
+			start:      1,
+			end:        6,
+			errMessage: "ledger path is broken between block 6 and block 4: block 6 does not link to block 4 in the skip list",
+		},
+		{
+			name:       "tampered header",
+			headers:    []*types.BlockHeader{headers[5], tamperedHeader, headers[0]},
+			start:      1,
+			end:        6,
+			errMessage: "ledger path is broken between block 6 and block 5: hash of block 5 does not match skip list hash 0 of block 6",
+		},
+		{
+			name: "missing skip list hash",
+			headers: []*types.BlockHeader{
+				{BaseHeader: &types.BlockHeaderBase{Number: 5}},
+				headers[0],
+			},
+			start:      1,
+			end:        5,
+			errMessage: "ledger path is broken between block 5 and block 1: block 5 has 0 skip list hashes, link to block 1 is missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.EqualError(t, VerifyLedgerPath(tt.headers, tt.start, tt.end), tt.errMessage)
+		})
+	}
+}
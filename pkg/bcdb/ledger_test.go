@@ -3,6 +3,7 @@
 package bcdb
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -200,6 +201,146 @@ func TestGetTransactionProof(t *testing.T) {
 	}
 }
 
+func TestVerifyTransaction(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCertTemDir, "alice")
+
+	txEnvs := make([]proto.Message, 0)
+	receipts := make([]*types.TxReceipt, 0)
+	for i := 0; i < 6; i++ {
+		tx, err := aliceSession.DataTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.Put("bdb", fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), nil))
+		_, receipt, err := tx.Commit(true)
+		require.NoError(t, err)
+		txEnv, err := tx.CommittedTxEnvelope()
+		require.NoError(t, err)
+		txEnvs = append(txEnvs, txEnv)
+		receipts = append(receipts, receipt)
+	}
+
+	l, err := aliceSession.Ledger()
+	require.NoError(t, err)
+
+	t.Run("anchored at genesis", func(t *testing.T) {
+		report, err := l.VerifyTransaction(txEnvs[4], receipts[4], nil)
+		require.NoError(t, err)
+		require.True(t, report.Verified(), report.Failure)
+		require.Equal(t, uint64(1), report.AnchorBlockNum)
+		require.Equal(t, receipts[4].GetHeader().GetBaseHeader().GetNumber(), report.LedgerPath[0])
+		require.Equal(t, types.Flag_VALID, report.Flag)
+	})
+
+	t.Run("anchored at a later block", func(t *testing.T) {
+		anchor := receipts[5].GetHeader()
+		report, err := l.VerifyTransaction(txEnvs[1], receipts[1], anchor)
+		require.NoError(t, err)
+		require.True(t, report.Verified(), report.Failure)
+		require.Equal(t, anchor.GetBaseHeader().GetNumber(), report.AnchorBlockNum)
+	})
+
+	t.Run("tampered tx", func(t *testing.T) {
+		report, err := l.VerifyTransaction(txEnvs[2], receipts[3], nil)
+		require.NoError(t, err)
+		require.False(t, report.Verified())
+		require.False(t, report.TxIncluded)
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		receipt := proto.Clone(receipts[3]).(*types.TxReceipt)
+		receipt.Header.StateMerkelTreeRootHash = []byte("tampered")
+		report, err := l.VerifyTransaction(txEnvs[3], receipt, nil)
+		require.NoError(t, err)
+		require.False(t, report.Verified())
+		require.True(t, report.TxIncluded)
+		require.Equal(t, fmt.Sprintf("header of block %d on the ledger path does not match the supplied header", receipt.Header.BaseHeader.Number), report.Failure)
+	})
+}
+
+func TestGetTransactionProof_AdministrationTx(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "bob", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	verifyCommittedTx := func(tx TxContext, receipt *types.TxReceipt) {
+		txEnv, err := tx.CommittedTxEnvelope()
+		require.NoError(t, err)
+		p, err := adminSession.Ledger()
+		require.NoError(t, err)
+		proof, err := p.GetTransactionProof(receipt.GetHeader().GetBaseHeader().GetNumber(), int(receipt.GetTxIndex()))
+		require.NoError(t, err)
+
+		res, err := proof.Verify(receipt, txEnv)
+		require.NoError(t, err)
+		require.True(t, res)
+
+		// the proof does not hold for a tampered tx
+		tamperedEnv := proto.Clone(txEnv)
+		switch env := tamperedEnv.(type) {
+		case *types.UserAdministrationTxEnvelope:
+			env.Payload.TxId = "tampered"
+		case *types.DBAdministrationTxEnvelope:
+			env.Payload.TxId = "tampered"
+		}
+		res, err = proof.Verify(receipt, tamperedEnv)
+		require.NoError(t, err)
+		require.False(t, res)
+	}
+
+	t.Run("user administration tx", func(t *testing.T) {
+		bobCert, _ := testutils.LoadTestClientCrypto(t, clientCertTemDir, "bob")
+		tx, err := adminSession.UsersTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.PutUser(&types.User{Id: "bob", Certificate: bobCert.Raw}, nil))
+		_, receipt, err := tx.Commit(true)
+		require.NoError(t, err)
+		verifyCommittedTx(tx, receipt)
+	})
+
+	t.Run("db administration tx", func(t *testing.T) {
+		tx, err := adminSession.DBsTx()
+		require.NoError(t, err)
+		require.NoError(t, tx.CreateDB("testDB"))
+		_, receipt, err := tx.Commit(true)
+		require.NoError(t, err)
+		verifyCommittedTx(tx, receipt)
+	})
+}
+
+func TestGetTransactionProof_ConfigTx(t *testing.T) {
+	t.Skip("Add admin is a config update, TODO in issue: https://github.com/hyperledger-labs/orion-server/issues/148")
+
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "admin2", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	StartTestServer(t, testServer)
+	_, adminSession := connectAndOpenAdminSession(t, testServer, clientCertTemDir)
+
+	admin2Cert, _ := testutils.LoadTestClientCrypto(t, clientCertTemDir, "admin2")
+	tx, err := adminSession.ConfigTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.AddAdmin(&types.Admin{Id: "admin2", Certificate: admin2Cert.Raw}))
+	_, receipt, err := tx.Commit(true)
+	require.NoError(t, err)
+	txEnv, err := tx.CommittedTxEnvelope()
+	require.NoError(t, err)
+
+	p, err := adminSession.Ledger()
+	require.NoError(t, err)
+	proof, err := p.GetTransactionProof(receipt.GetHeader().GetBaseHeader().GetNumber(), int(receipt.GetTxIndex()))
+	require.NoError(t, err)
+	res, err := proof.Verify(receipt, txEnv)
+	require.NoError(t, err)
+	require.True(t, res)
+}
+
 func TestGetTransactionReceipt(t *testing.T) {
 	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
 	testServer, _, _, err := SetupTestServerWithParams(t, clientCertTemDir, 5*time.Second, 10)
@@ -377,3 +518,80 @@ func TestGetStateProof(t *testing.T) {
 		})
 	}
 }
+
+func TestProveValueAndDeleted(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCertTemDir, "alice")
+
+	receipt1 := putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	putKeySync(t, "bdb", "key2", "value2", "alice", aliceSession)
+
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Delete("bdb", "key2"))
+	_, receipt3, err := tx.Commit(true)
+	require.NoError(t, err)
+	block1 := receipt1.GetHeader().GetBaseHeader().GetNumber()
+	block3 := receipt3.GetHeader().GetBaseHeader().GetNumber()
+
+	l, err := aliceSession.Ledger()
+	require.NoError(t, err)
+
+	proof, err := l.ProveValue("bdb", "key1", []byte("value1"), block1)
+	require.NoError(t, err)
+	require.Equal(t, block1, proof.BlockNum())
+	require.NoError(t, proof.Verify())
+
+	_, err = l.ProveValue("bdb", "key1", []byte("value2"), block1)
+	require.EqualError(t, err, fmt.Sprintf("value of key 'key1' in database 'bdb' is not part of the state at block %d", block1))
+
+	proof, err = l.ProveDeleted("bdb", "key2", block3)
+	require.NoError(t, err)
+	require.True(t, proof.Deleted)
+	require.Equal(t, []byte("value2"), proof.Value)
+
+	// the proof is verified offline after serialization
+	proofBytes, err := json.Marshal(proof)
+	require.NoError(t, err)
+	readProof := &StateProof{}
+	require.NoError(t, json.Unmarshal(proofBytes, readProof))
+	require.NoError(t, readProof.Verify())
+}
+
+func TestCollectEvidence(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCertTemDir, "alice")
+
+	putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("bdb", "key2", []byte("value2"), nil))
+	require.NoError(t, tx.Delete("bdb", "key1"))
+	_, receipt, err := tx.Commit(true)
+	require.NoError(t, err)
+	txEnv, err := tx.CommittedTxEnvelope()
+	require.NoError(t, err)
+
+	l, err := aliceSession.Ledger()
+	require.NoError(t, err)
+	bundle, err := l.CollectEvidence(txEnv, receipt, []*EvidenceKey{
+		{DBName: "bdb", Key: "key2", Value: []byte("value2")},
+		{DBName: "bdb", Key: "key1", Deleted: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, bundle.StateProofs, 2)
+
+	genesis, err := l.GetBlockHeader(1)
+	require.NoError(t, err)
+	bundleBytes, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	readBundle := &EvidenceBundle{}
+	require.NoError(t, json.Unmarshal(bundleBytes, readBundle))
+	require.NoError(t, VerifyBundle(readBundle, genesis))
+}
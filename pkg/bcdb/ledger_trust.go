@@ -0,0 +1,257 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// TrustAnchorStore persists the trusted block header of a LedgerTrustStore
+type TrustAnchorStore interface {
+	// Load returns the stored header, or nil if no header was stored yet
+	Load() (*types.BlockHeader, error)
+	// Store replaces the stored header
+	Store(header *types.BlockHeader) error
+}
+
+// LedgerTrustStore keeps the latest verified block header, the trust anchor, and accepts other
+// headers only if they are connected to the anchor by a valid ledger skip list path. Newer headers
+// advance the anchor, so trust is extended from block to block and never rests on the server alone.
+type LedgerTrustStore interface {
+	// Anchor returns the trusted block header
+	Anchor() *types.BlockHeader
+	// VerifyHeader checks that header is connected to the anchor, and advances the
+	// anchor if header is newer. Returns *ErrLedgerFork if the ledger was rewritten.
+	VerifyHeader(header *types.BlockHeader) error
+	// VerifyReceipt verifies the block header of receipt, see VerifyHeader
+	VerifyReceipt(receipt *types.TxReceipt) error
+}
+
+// ErrLedgerFork is returned when the ledger served contradicts the trusted anchor,
+// i.e. the server forked or rewrote its history
+type ErrLedgerFork struct {
+	// BlockNum the block that has two different hashes
+	BlockNum uint64
+	// TrustedHash hash of the block according to the trusted history
+	TrustedHash []byte
+	// ReceivedHash hash of the block as received from the server
+	ReceivedHash []byte
+}
+
+func (e *ErrLedgerFork) Error() string {
+	return fmt.Sprintf("ledger fork detected at block %d, trusted hash %x, received hash %x", e.BlockNum, e.TrustedHash, e.ReceivedHash)
+}
+
+// matchPathEnds compares the hashes of the first and the last headers of path with endHash and startHash,
+// returns the first mismatch as a fork, or nil if both match
+func matchPathEnds(path []*types.BlockHeader, endHash, startHash []byte) (*ErrLedgerFork, error) {
+	for _, end := range []struct {
+		header *types.BlockHeader
+		hash   []byte
+	}{
+		{path[0], endHash},
+		{path[len(path)-1], startHash},
+	} {
+		hash, err := CalculateBlockHeaderHash(end.header)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(hash, end.hash) {
+			return &ErrLedgerFork{
+				BlockNum:     end.header.GetBaseHeader().GetNumber(),
+				TrustedHash:  end.hash,
+				ReceivedHash: hash,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+type ledgerTrustStore struct {
+	ledger Ledger
+	store  TrustAnchorStore
+	onFork func(fork *ErrLedgerFork)
+	mutex  sync.Mutex
+	anchor *types.BlockHeader
+}
+
+// NewLedgerTrustStore creates a trust store that extends trust from the header kept in store, using paths from
+// ledger. If store is empty, the genesis block header is trusted on first use. onFork, if not nil, is called
+// whenever a fork is detected, in addition to the error returned.
+func NewLedgerTrustStore(ledger Ledger, store TrustAnchorStore, onFork func(fork *ErrLedgerFork)) (LedgerTrustStore, error) {
+	anchor, err := store.Load()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load trust anchor")
+	}
+	if anchor == nil {
+		if anchor, err = ledger.GetBlockHeader(1); err != nil {
+			return nil, errors.WithMessage(err, "failed to fetch genesis block header")
+		}
+		if anchor == nil {
+			return nil, errors.New("genesis block header is missing")
+		}
+		if err = store.Store(anchor); err != nil {
+			return nil, errors.WithMessage(err, "failed to store trust anchor")
+		}
+	}
+
+	return &ledgerTrustStore{
+		ledger: ledger,
+		store:  store,
+		onFork: onFork,
+		anchor: anchor,
+	}, nil
+}
+
+func (s *ledgerTrustStore) Anchor() *types.BlockHeader {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.anchor
+}
+
+func (s *ledgerTrustStore) VerifyReceipt(receipt *types.TxReceipt) error {
+	if receipt.GetHeader() == nil {
+		return errors.New("receipt has no block header")
+	}
+	return s.VerifyHeader(receipt.GetHeader())
+}
+
+func (s *ledgerTrustStore) VerifyHeader(header *types.BlockHeader) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	blockNum := header.GetBaseHeader().GetNumber()
+	anchorNum := s.anchor.GetBaseHeader().GetNumber()
+	hash, err := CalculateBlockHeaderHash(header)
+	if err != nil {
+		return err
+	}
+	anchorHash, err := CalculateBlockHeaderHash(s.anchor)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case blockNum == anchorNum:
+		if !bytes.Equal(hash, anchorHash) {
+			return s.fork(blockNum, anchorHash, hash)
+		}
+		return nil
+
+	case blockNum > anchorNum:
+		// the path must lead from header down to the anchor
+		path, err := s.path(anchorNum, blockNum)
+		if err != nil {
+			return err
+		}
+		if err = s.checkPathEnds(path, hash, anchorHash); err != nil {
+			return err
+		}
+		if err = s.store.Store(header); err != nil {
+			return errors.WithMessage(err, "failed to store trust anchor")
+		}
+		s.anchor = header
+		return nil
+
+	default:
+		// the path must lead from the anchor down to header
+		path, err := s.path(blockNum, anchorNum)
+		if err != nil {
+			return err
+		}
+		return s.checkPathEnds(path, anchorHash, hash)
+	}
+}
+
+// path fetches the path from startBlock down to endBlock, GetLedgerPath verifies it
+func (s *ledgerTrustStore) path(startBlock, endBlock uint64) ([]*types.BlockHeader, error) {
+	path, err := s.ledger.GetLedgerPath(startBlock, endBlock)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to fetch ledger path from block %d to block %d", startBlock, endBlock)
+	}
+	return path, nil
+}
+
+// checkPathEnds checks the ends of a verified path, a mismatch means the server holds
+// a different history than the one trusted or received
+func (s *ledgerTrustStore) checkPathEnds(path []*types.BlockHeader, endHash, startHash []byte) error {
+	fork, err := matchPathEnds(path, endHash, startHash)
+	if err != nil {
+		return err
+	}
+	if fork != nil {
+		return s.fork(fork.BlockNum, fork.TrustedHash, fork.ReceivedHash)
+	}
+	return nil
+}
+
+func (s *ledgerTrustStore) fork(blockNum uint64, trustedHash, receivedHash []byte) error {
+	fork := &ErrLedgerFork{
+		BlockNum:     blockNum,
+		TrustedHash:  trustedHash,
+		ReceivedHash: receivedHash,
+	}
+	if s.onFork != nil {
+		s.onFork(fork)
+	}
+	return fork
+}
+
+type fileTrustAnchorStore struct {
+	path string
+}
+
+// NewFileTrustAnchorStore creates a trust anchor store that keeps the header in the file at path
+func NewFileTrustAnchorStore(path string) TrustAnchorStore {
+	return &fileTrustAnchorStore{
+		path: path,
+	}
+}
+
+func (f *fileTrustAnchorStore) Load() (*types.BlockHeader, error) {
+	headerBytes, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read trust anchor file %s", f.path)
+	}
+	header := &types.BlockHeader{}
+	if err = proto.Unmarshal(headerBytes, header); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse trust anchor file %s", f.path)
+	}
+	return header, nil
+}
+
+// Store writes the header to a temporary file first, so a crash never leaves a partial anchor behind
+func (f *fileTrustAnchorStore) Store(header *types.BlockHeader) error {
+	headerBytes, err := proto.Marshal(header)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal trust anchor")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create trust anchor file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(headerBytes); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write trust anchor file %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write trust anchor file %s", tmp.Name())
+	}
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Wrapf(err, "failed to replace trust anchor file %s", f.path)
+	}
+	return nil
+}
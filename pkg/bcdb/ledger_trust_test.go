@@ -0,0 +1,125 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// pathLedger serves block headers and skip list paths the same way the server does
+type pathLedger struct {
+	Ledger
+	headers []*types.BlockHeader
+}
+
+func (l *pathLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	return l.headers[blockNum-1], nil
+}
+
+func (l *pathLedger) GetLedgerPath(startBlock, endBlock uint64) ([]*types.BlockHeader, error) {
+	current := l.headers[endBlock-1]
+	path := []*types.BlockHeader{current}
+	for current.GetBaseHeader().GetNumber() > startBlock {
+		links := skipListLinks(current.GetBaseHeader().GetNumber())
+		for i := len(links) - 1; i >= 0; i-- {
+			if links[i] >= startBlock {
+				current = l.headers[links[i]-1]
+				path = append(path, current)
+				break
+			}
+		}
+	}
+	return path, nil
+}
+
+func TestLedgerTrustStore(t *testing.T) {
+	headers := testLedgerHeaders(t, 20)
+	ledger := &pathLedger{headers: headers[:10]}
+	anchorPath := filepath.Join(t.TempDir(), "anchor")
+	var forks []*ErrLedgerFork
+
+	trustStore, err := NewLedgerTrustStore(ledger, NewFileTrustAnchorStore(anchorPath), func(fork *ErrLedgerFork) {
+		forks = append(forks, fork)
+	})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(headers[0], trustStore.Anchor()))
+
+	// newer blocks extend the anchor
+	require.NoError(t, trustStore.VerifyHeader(headers[6]))
+	require.True(t, proto.Equal(headers[6], trustStore.Anchor()))
+	require.NoError(t, trustStore.VerifyReceipt(&types.TxReceipt{Header: headers[9]}))
+	require.True(t, proto.Equal(headers[9], trustStore.Anchor()))
+
+	// older blocks and the anchor itself are verified, the anchor stays
+	require.NoError(t, trustStore.VerifyHeader(headers[2]))
+	require.NoError(t, trustStore.VerifyHeader(headers[9]))
+	require.True(t, proto.Equal(headers[9], trustStore.Anchor()))
+
+	// the anchor survives a restart
+	ledger.headers = headers
+	trustStore, err = NewLedgerTrustStore(ledger, NewFileTrustAnchorStore(anchorPath), nil)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(headers[9], trustStore.Anchor()))
+	require.NoError(t, trustStore.VerifyHeader(headers[19]))
+	require.Empty(t, forks)
+}
+
+func TestLedgerTrustStore_Fork(t *testing.T) {
+	headers := testLedgerHeaders(t, 10)
+	var forks []*ErrLedgerFork
+	trustStore, err := NewLedgerTrustStore(&pathLedger{headers: headers}, NewFileTrustAnchorStore(filepath.Join(t.TempDir(), "anchor")), func(fork *ErrLedgerFork) {
+		forks = append(forks, fork)
+	})
+	require.NoError(t, err)
+	require.NoError(t, trustStore.VerifyHeader(headers[5]))
+
+	// the server rewrote its history from block 4 on
+	rewritten := append([]*types.BlockHeader{}, headers[:3]...)
+	for i := 4; i <= 10; i++ {
+		h := &types.BlockHeader{
+			BaseHeader:           &types.BlockHeaderBase{Number: uint64(i)},
+			TxMerkelTreeRootHash: []byte("rewritten"),
+		}
+		for _, link := range skipListLinks(uint64(i)) {
+			hash, err := CalculateBlockHeaderHash(rewritten[link-1])
+			require.NoError(t, err)
+			h.SkipchainHashes = append(h.SkipchainHashes, hash)
+		}
+		rewritten = append(rewritten, h)
+	}
+	trustStore.(*ledgerTrustStore).ledger = &pathLedger{headers: rewritten}
+
+	err = trustStore.VerifyHeader(rewritten[9])
+	fork := &ErrLedgerFork{}
+	require.True(t, errors.As(err, &fork))
+	require.Equal(t, uint64(6), fork.BlockNum)
+	require.Len(t, forks, 1)
+	require.True(t, proto.Equal(headers[5], trustStore.Anchor()))
+
+	err = trustStore.VerifyHeader(rewritten[5])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ledger fork detected at block 6")
+
+	err = trustStore.VerifyHeader(rewritten[4])
+	require.Contains(t, err.Error(), "ledger fork detected at block 6")
+	require.Len(t, forks, 3)
+}
+
+func TestFileTrustAnchorStore(t *testing.T) {
+	store := NewFileTrustAnchorStore(filepath.Join(t.TempDir(), "anchor"))
+	header, err := store.Load()
+	require.NoError(t, err)
+	require.Nil(t, header)
+
+	headers := testLedgerHeaders(t, 3)
+	require.NoError(t, store.Store(headers[2]))
+	header, err = store.Load()
+	require.NoError(t, err)
+	require.True(t, proto.Equal(headers[2], header))
+}
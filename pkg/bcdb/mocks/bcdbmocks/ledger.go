@@ -0,0 +1,223 @@
+// Code generated by mockery v2.5.1. DO NOT EDIT.
+
+package bcdbmocks
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	bcdb "github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	state "github.com/hyperledger-labs/orion-server/pkg/state"
+	types "github.com/hyperledger-labs/orion-server/pkg/types"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Ledger is an autogenerated mock type for the Ledger type
+type Ledger struct {
+	mock.Mock
+}
+
+// CollectEvidence provides a mock function with given fields: tx, receipt, keys
+func (_m *Ledger) CollectEvidence(tx proto.Message, receipt *types.TxReceipt, keys []*bcdb.EvidenceKey) (*bcdb.EvidenceBundle, error) {
+	ret := _m.Called(tx, receipt, keys)
+
+	var r0 *bcdb.EvidenceBundle
+	if rf, ok := ret.Get(0).(func(proto.Message, *types.TxReceipt, []*bcdb.EvidenceKey) *bcdb.EvidenceBundle); ok {
+		r0 = rf(tx, receipt, keys)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.EvidenceBundle)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(proto.Message, *types.TxReceipt, []*bcdb.EvidenceKey) error); ok {
+		r1 = rf(tx, receipt, keys)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBlockHeader provides a mock function with given fields: blockNum
+func (_m *Ledger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	ret := _m.Called(blockNum)
+
+	var r0 *types.BlockHeader
+	if rf, ok := ret.Get(0).(func(uint64) *types.BlockHeader); ok {
+		r0 = rf(blockNum)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.BlockHeader)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint64) error); ok {
+		r1 = rf(blockNum)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDataProof provides a mock function with given fields: blockNum, dbName, key, isDeleted
+func (_m *Ledger) GetDataProof(blockNum uint64, dbName string, key string, isDeleted bool) (*state.Proof, error) {
+	ret := _m.Called(blockNum, dbName, key, isDeleted)
+
+	var r0 *state.Proof
+	if rf, ok := ret.Get(0).(func(uint64, string, string, bool) *state.Proof); ok {
+		r0 = rf(blockNum, dbName, key, isDeleted)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*state.Proof)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint64, string, string, bool) error); ok {
+		r1 = rf(blockNum, dbName, key, isDeleted)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLedgerPath provides a mock function with given fields: startBlock, endBlock
+func (_m *Ledger) GetLedgerPath(startBlock uint64, endBlock uint64) ([]*types.BlockHeader, error) {
+	ret := _m.Called(startBlock, endBlock)
+
+	var r0 []*types.BlockHeader
+	if rf, ok := ret.Get(0).(func(uint64, uint64) []*types.BlockHeader); ok {
+		r0 = rf(startBlock, endBlock)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.BlockHeader)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint64, uint64) error); ok {
+		r1 = rf(startBlock, endBlock)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTransactionProof provides a mock function with given fields: blockNum, txIndex
+func (_m *Ledger) GetTransactionProof(blockNum uint64, txIndex int) (*bcdb.TxProof, error) {
+	ret := _m.Called(blockNum, txIndex)
+
+	var r0 *bcdb.TxProof
+	if rf, ok := ret.Get(0).(func(uint64, int) *bcdb.TxProof); ok {
+		r0 = rf(blockNum, txIndex)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.TxProof)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint64, int) error); ok {
+		r1 = rf(blockNum, txIndex)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTransactionReceipt provides a mock function with given fields: txId
+func (_m *Ledger) GetTransactionReceipt(txId string) (*types.TxReceipt, error) {
+	ret := _m.Called(txId)
+
+	var r0 *types.TxReceipt
+	if rf, ok := ret.Get(0).(func(string) *types.TxReceipt); ok {
+		r0 = rf(txId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.TxReceipt)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(txId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ProveDeleted provides a mock function with given fields: dbName, key, blockNum
+func (_m *Ledger) ProveDeleted(dbName string, key string, blockNum uint64) (*bcdb.StateProof, error) {
+	ret := _m.Called(dbName, key, blockNum)
+
+	var r0 *bcdb.StateProof
+	if rf, ok := ret.Get(0).(func(string, string, uint64) *bcdb.StateProof); ok {
+		r0 = rf(dbName, key, blockNum)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.StateProof)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, uint64) error); ok {
+		r1 = rf(dbName, key, blockNum)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ProveValue provides a mock function with given fields: dbName, key, value, blockNum
+func (_m *Ledger) ProveValue(dbName string, key string, value []byte, blockNum uint64) (*bcdb.StateProof, error) {
+	ret := _m.Called(dbName, key, value, blockNum)
+
+	var r0 *bcdb.StateProof
+	if rf, ok := ret.Get(0).(func(string, string, []byte, uint64) *bcdb.StateProof); ok {
+		r0 = rf(dbName, key, value, blockNum)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.StateProof)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, []byte, uint64) error); ok {
+		r1 = rf(dbName, key, value, blockNum)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyTransaction provides a mock function with given fields: tx, receipt, anchor
+func (_m *Ledger) VerifyTransaction(tx proto.Message, receipt *types.TxReceipt, anchor *types.BlockHeader) (*bcdb.TxVerificationReport, error) {
+	ret := _m.Called(tx, receipt, anchor)
+
+	var r0 *bcdb.TxVerificationReport
+	if rf, ok := ret.Get(0).(func(proto.Message, *types.TxReceipt, *types.BlockHeader) *bcdb.TxVerificationReport); ok {
+		r0 = rf(tx, receipt, anchor)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.TxVerificationReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(proto.Message, *types.TxReceipt, *types.BlockHeader) error); ok {
+		r1 = rf(tx, receipt, anchor)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
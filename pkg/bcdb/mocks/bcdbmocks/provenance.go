@@ -0,0 +1,589 @@
+// Code generated by mockery v2.5.1. DO NOT EDIT.
+
+package bcdbmocks
+
+import (
+	bcdb "github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	types "github.com/hyperledger-labs/orion-server/pkg/types"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Provenance is an autogenerated mock type for the Provenance type
+type Provenance struct {
+	mock.Mock
+}
+
+// Diff provides a mock function with given fields: dbName, key, from, to
+func (_m *Provenance) Diff(dbName string, key string, from *types.Version, to *types.Version) (*bcdb.KeyDiff, error) {
+	ret := _m.Called(dbName, key, from, to)
+
+	var r0 *bcdb.KeyDiff
+	if rf, ok := ret.Get(0).(func(string, string, *types.Version, *types.Version) *bcdb.KeyDiff); ok {
+		r0 = rf(dbName, key, from, to)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.KeyDiff)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *types.Version, *types.Version) error); ok {
+		r1 = rf(dbName, key, from, to)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAsOfBlock provides a mock function with given fields: dbName, key, blockNum
+func (_m *Provenance) GetAsOfBlock(dbName string, key string, blockNum uint64) (*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, blockNum)
+
+	var r0 *types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, uint64) *types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, blockNum)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, uint64) error); ok {
+		r1 = rf(dbName, key, blockNum)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBeforeTx provides a mock function with given fields: dbName, key, txID
+func (_m *Provenance) GetBeforeTx(dbName string, key string, txID string) (*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, txID)
+
+	var r0 *types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, string) *types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, txID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
+		r1 = rf(dbName, key, txID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBeforeVersion provides a mock function with given fields: dbName, key, version
+func (_m *Provenance) GetBeforeVersion(dbName string, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, version)
+
+	var r0 *types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, *types.Version) *types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *types.Version) error); ok {
+		r1 = rf(dbName, key, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDataReadByUser provides a mock function with given fields: userID
+func (_m *Provenance) GetDataReadByUser(userID string) ([]*types.KVWithMetadata, error) {
+	ret := _m.Called(userID)
+
+	var r0 []*types.KVWithMetadata
+	if rf, ok := ret.Get(0).(func(string) []*types.KVWithMetadata); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.KVWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDataWrittenByUser provides a mock function with given fields: userID
+func (_m *Provenance) GetDataWrittenByUser(userID string) ([]*types.KVWithMetadata, error) {
+	ret := _m.Called(userID)
+
+	var r0 []*types.KVWithMetadata
+	if rf, ok := ret.Get(0).(func(string) []*types.KVWithMetadata); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.KVWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeletedValues provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetDeletedValues(dbName string, key string) ([]*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []*types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string) []*types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistoricalData provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetHistoricalData(dbName string, key string) ([]*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []*types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string) []*types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetHistoricalDataAt provides a mock function with given fields: dbName, key, version
+func (_m *Provenance) GetHistoricalDataAt(dbName string, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, version)
+
+	var r0 *types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, *types.Version) *types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *types.Version) error); ok {
+		r1 = rf(dbName, key, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetKeyAccessSummary provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetKeyAccessSummary(dbName string, key string) (*bcdb.KeyAccessSummary, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 *bcdb.KeyAccessSummary
+	if rf, ok := ret.Get(0).(func(string, string) *bcdb.KeyAccessSummary); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.KeyAccessSummary)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNextHistoricalData provides a mock function with given fields: dbName, key, version
+func (_m *Provenance) GetNextHistoricalData(dbName string, key string, version *types.Version) ([]*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, version)
+
+	var r0 []*types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, *types.Version) []*types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *types.Version) error); ok {
+		r1 = rf(dbName, key, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPreviousHistoricalData provides a mock function with given fields: dbName, key, version
+func (_m *Provenance) GetPreviousHistoricalData(dbName string, key string, version *types.Version) ([]*types.ValueWithMetadata, error) {
+	ret := _m.Called(dbName, key, version)
+
+	var r0 []*types.ValueWithMetadata
+	if rf, ok := ret.Get(0).(func(string, string, *types.Version) []*types.ValueWithMetadata); ok {
+		r0 = rf(dbName, key, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.ValueWithMetadata)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *types.Version) error); ok {
+		r1 = rf(dbName, key, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetReaders provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetReaders(dbName string, key string) ([]string, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string, string) []string); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetReadersWithCounts provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetReadersWithCounts(dbName string, key string) ([]*bcdb.UserAccessCount, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []*bcdb.UserAccessCount
+	if rf, ok := ret.Get(0).(func(string, string) []*bcdb.UserAccessCount); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*bcdb.UserAccessCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxDataChanges provides a mock function with given fields: env
+func (_m *Provenance) GetTxDataChanges(env *types.DataTxEnvelope) (*bcdb.TxDataChanges, error) {
+	ret := _m.Called(env)
+
+	var r0 *bcdb.TxDataChanges
+	if rf, ok := ret.Get(0).(func(*types.DataTxEnvelope) *bcdb.TxDataChanges); ok {
+		r0 = rf(env)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.TxDataChanges)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*types.DataTxEnvelope) error); ok {
+		r1 = rf(env)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxDataChangesByID provides a mock function with given fields: txID, envelopes
+func (_m *Provenance) GetTxDataChangesByID(txID string, envelopes func(string) (*types.DataTxEnvelope, error)) (*bcdb.TxDataChanges, error) {
+	ret := _m.Called(txID, envelopes)
+
+	var r0 *bcdb.TxDataChanges
+	if rf, ok := ret.Get(0).(func(string, func(string) (*types.DataTxEnvelope, error)) *bcdb.TxDataChanges); ok {
+		r0 = rf(txID, envelopes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.TxDataChanges)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, func(string) (*types.DataTxEnvelope, error)) error); ok {
+		r1 = rf(txID, envelopes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxIDsSubmittedByUser provides a mock function with given fields: userID
+func (_m *Provenance) GetTxIDsSubmittedByUser(userID string) ([]string, error) {
+	ret := _m.Called(userID)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string) []string); ok {
+		r0 = rf(userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWriters provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetWriters(dbName string, key string) ([]string, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(string, string) []string); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetWritersWithCounts provides a mock function with given fields: dbName, key
+func (_m *Provenance) GetWritersWithCounts(dbName string, key string) ([]*bcdb.UserAccessCount, error) {
+	ret := _m.Called(dbName, key)
+
+	var r0 []*bcdb.UserAccessCount
+	if rf, ok := ret.Get(0).(func(string, string) []*bcdb.UserAccessCount); ok {
+		r0 = rf(dbName, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*bcdb.UserAccessCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(dbName, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IterateDataReadByUser provides a mock function with given fields: userID, opts
+func (_m *Provenance) IterateDataReadByUser(userID string, opts *bcdb.ProvenanceQueryOptions) (bcdb.KVIterator, error) {
+	ret := _m.Called(userID, opts)
+
+	var r0 bcdb.KVIterator
+	if rf, ok := ret.Get(0).(func(string, *bcdb.ProvenanceQueryOptions) bcdb.KVIterator); ok {
+		r0 = rf(userID, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(bcdb.KVIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *bcdb.ProvenanceQueryOptions) error); ok {
+		r1 = rf(userID, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IterateDataWrittenByUser provides a mock function with given fields: userID, opts
+func (_m *Provenance) IterateDataWrittenByUser(userID string, opts *bcdb.ProvenanceQueryOptions) (bcdb.KVIterator, error) {
+	ret := _m.Called(userID, opts)
+
+	var r0 bcdb.KVIterator
+	if rf, ok := ret.Get(0).(func(string, *bcdb.ProvenanceQueryOptions) bcdb.KVIterator); ok {
+		r0 = rf(userID, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(bcdb.KVIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *bcdb.ProvenanceQueryOptions) error); ok {
+		r1 = rf(userID, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IterateHistoricalData provides a mock function with given fields: dbName, key, opts
+func (_m *Provenance) IterateHistoricalData(dbName string, key string, opts *bcdb.ProvenanceQueryOptions) (bcdb.HistoricalDataIterator, error) {
+	ret := _m.Called(dbName, key, opts)
+
+	var r0 bcdb.HistoricalDataIterator
+	if rf, ok := ret.Get(0).(func(string, string, *bcdb.ProvenanceQueryOptions) bcdb.HistoricalDataIterator); ok {
+		r0 = rf(dbName, key, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(bcdb.HistoricalDataIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, *bcdb.ProvenanceQueryOptions) error); ok {
+		r1 = rf(dbName, key, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IterateTxIDsSubmittedByUser provides a mock function with given fields: userID, opts
+func (_m *Provenance) IterateTxIDsSubmittedByUser(userID string, opts *bcdb.ProvenanceQueryOptions) (bcdb.TxIDIterator, error) {
+	ret := _m.Called(userID, opts)
+
+	var r0 bcdb.TxIDIterator
+	if rf, ok := ret.Get(0).(func(string, *bcdb.ProvenanceQueryOptions) bcdb.TxIDIterator); ok {
+		r0 = rf(userID, opts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(bcdb.TxIDIterator)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, *bcdb.ProvenanceQueryOptions) error); ok {
+		r1 = rf(userID, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SnapshotAt provides a mock function with given fields: blockNum
+func (_m *Provenance) SnapshotAt(blockNum uint64) (bcdb.Snapshot, error) {
+	ret := _m.Called(blockNum)
+
+	var r0 bcdb.Snapshot
+	if rf, ok := ret.Get(0).(func(uint64) bcdb.Snapshot); ok {
+		r0 = rf(blockNum)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(bcdb.Snapshot)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint64) error); ok {
+		r1 = rf(blockNum)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyHistoricalData provides a mock function with given fields: dbName, key, envelopes
+func (_m *Provenance) VerifyHistoricalData(dbName string, key string, envelopes func(*types.Version) (*types.DataTxEnvelope, error)) (*bcdb.HistoryVerificationReport, error) {
+	ret := _m.Called(dbName, key, envelopes)
+
+	var r0 *bcdb.HistoryVerificationReport
+	if rf, ok := ret.Get(0).(func(string, string, func(*types.Version) (*types.DataTxEnvelope, error)) *bcdb.HistoryVerificationReport); ok {
+		r0 = rf(dbName, key, envelopes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*bcdb.HistoryVerificationReport)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, func(*types.Version) (*types.DataTxEnvelope, error)) error); ok {
+		r1 = rf(dbName, key, envelopes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -16,13 +16,38 @@ type TxProof struct {
 	intermediateHashes [][]byte
 }
 
+// NewTxProof creates a transaction proof from the intermediate hashes returned by
+// GetTransactionProof, e.g. to verify a proof that was stored offline
+func NewTxProof(intermediateHashes [][]byte) *TxProof {
+	return &TxProof{
+		intermediateHashes: intermediateHashes,
+	}
+}
+
+// GetIntermediateHashes returns the hashes from hash(tx, validating info) to the root of the tx merkle tree
+func (p *TxProof) GetIntermediateHashes() [][]byte {
+	return p.intermediateHashes
+}
+
+// Verify checks that tx, committed as described by receipt, is part of the tx merkle tree of the receipt's block
+// header. Data, user administration, database administration and config transactions are supported. A block of
+// non data transactions holds a single transaction, hence its index must be 0.
 func (p *TxProof) Verify(receipt *types.TxReceipt, tx proto.Message) (bool, error) {
-	txEnv, ok := tx.(*types.DataTxEnvelope)
-	if !ok {
-		return false, errors.Errorf("tx [%s] is not data transaction, only data transaction supported so far", tx.String())
+	switch tx.(type) {
+	case *types.DataTxEnvelope:
+	case *types.UserAdministrationTxEnvelope, *types.DBAdministrationTxEnvelope, *types.ConfigTxEnvelope:
+		if receipt.GetTxIndex() != 0 {
+			return false, errors.Errorf("tx [%s] is the only transaction in its block, expected tx index 0, got %d", tx.String(), receipt.GetTxIndex())
+		}
+	default:
+		return false, errors.Errorf("tx [%s] of type %T is not supported", tx.String(), tx)
 	}
+	if receipt.GetTxIndex() >= uint64(len(receipt.GetHeader().GetValidationInfo())) {
+		return false, errors.Errorf("tx index %d is out of range of the block validation info", receipt.GetTxIndex())
+	}
+
 	valInfo := receipt.GetHeader().GetValidationInfo()[receipt.GetTxIndex()]
-	txBytes, err := json.Marshal(txEnv)
+	txBytes, err := json.Marshal(tx)
 	if err != nil {
 		return false, errors.Wrapf(err, "can't serialize tx [%s] to json", tx.String())
 	}
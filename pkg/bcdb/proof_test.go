@@ -0,0 +1,124 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/crypto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// singleTxReceipt returns the receipt and the proof of tx, as if tx was the only tx in its block
+func singleTxReceipt(t *testing.T, tx proto.Message) (*types.TxReceipt, *TxProof) {
+	valInfo := &types.ValidationInfo{Flag: types.Flag_VALID}
+	txBytes, err := json.Marshal(tx)
+	require.NoError(t, err)
+	viBytes, err := json.Marshal(valInfo)
+	require.NoError(t, err)
+	txHash, err := crypto.ComputeSHA256Hash(append(txBytes, viBytes...))
+	require.NoError(t, err)
+
+	receipt := &types.TxReceipt{
+		Header: &types.BlockHeader{
+			BaseHeader:           &types.BlockHeaderBase{Number: 2},
+			TxMerkelTreeRootHash: txHash,
+			ValidationInfo:       []*types.ValidationInfo{valInfo},
+		},
+	}
+	return receipt, NewTxProof([][]byte{txHash})
+}
+
+func TestTxProof_VerifyTxTypes(t *testing.T) {
+	txs := []proto.Message{
+		&types.DataTxEnvelope{
+			Payload: &types.DataTx{TxId: "tx1", MustSignUserIds: []string{"alice"}},
+		},
+		&types.UserAdministrationTxEnvelope{
+			Payload: &types.UserAdministrationTx{TxId: "tx2", UserId: "admin"},
+		},
+		&types.DBAdministrationTxEnvelope{
+			Payload: &types.DBAdministrationTx{TxId: "tx3", UserId: "admin", CreateDbs: []string{"db1"}},
+		},
+		&types.ConfigTxEnvelope{
+			Payload: &types.ConfigTx{TxId: "tx4", UserId: "admin"},
+		},
+	}
+
+	for _, tx := range txs {
+		t.Run(txIDOf(tx), func(t *testing.T) {
+			receipt, proof := singleTxReceipt(t, tx)
+			res, err := proof.Verify(receipt, tx)
+			require.NoError(t, err)
+			require.True(t, res)
+
+			tamperedReceipt, _ := singleTxReceipt(t, &types.ConfigTxEnvelope{Payload: &types.ConfigTx{TxId: "other"}})
+			res, err = proof.Verify(tamperedReceipt, tx)
+			require.NoError(t, err)
+			require.False(t, res)
+		})
+	}
+}
+
+func TestTxProof_VerifyErrors(t *testing.T) {
+	tx := &types.UserAdministrationTxEnvelope{
+		Payload: &types.UserAdministrationTx{TxId: "tx1", UserId: "admin"},
+	}
+	receipt, proof := singleTxReceipt(t, tx)
+
+	receipt.TxIndex = 1
+	_, err := proof.Verify(receipt, tx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is the only transaction in its block, expected tx index 0, got 1")
+
+	_, err = proof.Verify(receipt, &types.DataTxEnvelope{Payload: &types.DataTx{TxId: "tx1"}})
+	require.EqualError(t, err, "tx index 1 is out of range of the block validation info")
+
+	_, err = proof.Verify(receipt, &types.User{Id: "alice"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "of type *types.User is not supported")
+}
+
+// the proof of a config tx as committed by an admin, without a server as config updates are not supported by the test server
+func TestTxProof_VerifyConfigTx(t *testing.T) {
+	tx := &types.ConfigTxEnvelope{
+		Payload: &types.ConfigTx{
+			UserId:               "admin",
+			TxId:                 "config1",
+			ReadOldConfigVersion: &types.Version{BlockNum: 1},
+			NewConfig: &types.ClusterConfig{
+				Nodes: []*types.NodeConfig{{Id: "node1", Address: "127.0.0.1", Port: 6001, Certificate: []byte("node1 cert")}},
+				Admins: []*types.Admin{
+					{Id: "admin", Certificate: []byte("admin cert")},
+					{Id: "admin2", Certificate: []byte("admin2 cert")},
+				},
+				CertAuthConfig: &types.CAConfig{Roots: [][]byte{[]byte("root cert")}},
+			},
+		},
+		Signature: []byte("admin signature"),
+	}
+	receipt, proof := singleTxReceipt(t, tx)
+
+	res, err := proof.Verify(receipt, tx)
+	require.NoError(t, err)
+	require.True(t, res)
+
+	tampered := proto.Clone(tx).(*types.ConfigTxEnvelope)
+	tampered.Payload.NewConfig.Admins[1].Certificate = []byte("other cert")
+	res, err = proof.Verify(receipt, tampered)
+	require.NoError(t, err)
+	require.False(t, res)
+
+	receipt.Header.ValidationInfo[0].Flag = types.Flag_INVALID_NO_PERMISSION
+	res, err = proof.Verify(receipt, tx)
+	require.NoError(t, err)
+	require.False(t, res)
+
+	receipt.TxIndex = 1
+	_, err = proof.Verify(receipt, tx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is the only transaction in its block, expected tx index 0, got 1")
+}
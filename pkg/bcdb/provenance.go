@@ -4,6 +4,7 @@ package bcdb
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/hyperledger-labs/orion-server/pkg/constants"
 	"github.com/hyperledger-labs/orion-server/pkg/types"
@@ -31,6 +32,25 @@ func (p *provenance) GetHistoricalData(dbName, key string) ([]*types.ValueWithMe
 	return resEnv.GetResponse().GetValues(), nil
 }
 
+func (p *provenance) GetDeletedValues(dbName, key string) ([]*types.ValueWithMetadata, error) {
+	path := constants.URLForGetHistoricalDeletedData(dbName, key)
+	resEnv := &types.GetHistoricalDataResponseEnvelope{}
+	err := p.handleRequest(
+		path,
+		&types.GetHistoricalDataQuery{
+			UserId:      p.userID,
+			DbName:      dbName,
+			Key:         key,
+			OnlyDeletes: true,
+		}, resEnv,
+	)
+	if err != nil {
+		p.logger.Errorf("failed to execute historical deleted data query %s, due to %s", path, err)
+		return nil, err
+	}
+	return resEnv.GetResponse().GetValues(), nil
+}
+
 func (p *provenance) GetHistoricalDataAt(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
 	path := constants.URLForGetHistoricalDataAt(dbName, key, version)
 	resEnv := &types.GetHistoricalDataResponseEnvelope{}
@@ -134,6 +154,18 @@ func (p *provenance) GetDataWrittenByUser(userID string) ([]*types.KVWithMetadat
 }
 
 func (p *provenance) GetReaders(dbName, key string) ([]string, error) {
+	readBy, err := p.readBy(dbName, key)
+	if err != nil || readBy == nil {
+		return nil, err
+	}
+	readers := make([]string, 0)
+	for k := range readBy {
+		readers = append(readers, k)
+	}
+	return readers, nil
+}
+
+func (p *provenance) readBy(dbName, key string) (map[string]uint32, error) {
 	path := constants.URLForGetDataReaders(dbName, key)
 	resEnv := &types.GetDataReadersResponseEnvelope{}
 	err := p.handleRequest(
@@ -148,19 +180,22 @@ func (p *provenance) GetReaders(dbName, key string) ([]string, error) {
 		p.logger.Errorf("failed to execute data readers query %s, due to %s", path, err)
 		return nil, err
 	}
+	return resEnv.GetResponse().GetReadBy(), nil
+}
 
-	res := resEnv.GetResponse()
-	if res.GetReadBy() == nil {
-		return nil, nil
+func (p *provenance) GetWriters(dbName, key string) ([]string, error) {
+	writtenBy, err := p.writtenBy(dbName, key)
+	if err != nil || writtenBy == nil {
+		return nil, err
 	}
-	readers := make([]string, 0)
-	for k := range res.GetReadBy() {
-		readers = append(readers, k)
+	writers := make([]string, 0)
+	for k := range writtenBy {
+		writers = append(writers, k)
 	}
-	return readers, nil
+	return writers, nil
 }
 
-func (p *provenance) GetWriters(dbName, key string) ([]string, error) {
+func (p *provenance) writtenBy(dbName, key string) (map[string]uint32, error) {
 	path := constants.URLForGetDataWriters(dbName, key)
 	resEnv := &types.GetDataWritersResponseEnvelope{}
 	err := p.handleRequest(
@@ -175,16 +210,7 @@ func (p *provenance) GetWriters(dbName, key string) ([]string, error) {
 		p.logger.Errorf("failed to execute data writers query %s, due to %s", path, err)
 		return nil, err
 	}
-
-	res := resEnv.GetResponse()
-	if res.GetWrittenBy() == nil {
-		return nil, nil
-	}
-	writers := make([]string, 0)
-	for k := range res.GetWrittenBy() {
-		writers = append(writers, k)
-	}
-	return writers, nil
+	return resEnv.GetResponse().GetWrittenBy(), nil
 }
 
 func (p *provenance) GetTxIDsSubmittedByUser(userID string) ([]string, error) {
@@ -204,3 +230,19 @@ func (p *provenance) GetTxIDsSubmittedByUser(userID string) ([]string, error) {
 	}
 	return resEnv.GetResponse().GetTxIDs(), nil
 }
+
+// VersionLess tells if version a precedes version b, comparing the block
+// number first and the tx index within the block second
+func VersionLess(a, b *types.Version) bool {
+	if a.GetBlockNum() != b.GetBlockNum() {
+		return a.GetBlockNum() < b.GetBlockNum()
+	}
+	return a.GetTxNum() < b.GetTxNum()
+}
+
+// sortValuesByVersion sorts values from the oldest version to the most recent one
+func sortValuesByVersion(values []*types.ValueWithMetadata) {
+	sort.SliceStable(values, func(i, j int) bool {
+		return VersionLess(values[i].GetMetadata().GetVersion(), values[j].GetMetadata().GetVersion())
+	})
+}
@@ -0,0 +1,502 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultProvenancePageSize default number of results in a page of a provenance iterator
+const DefaultProvenancePageSize = 100
+
+// ProvenanceQueryOptions paging and filtering options of provenance iterators
+type ProvenanceQueryOptions struct {
+	// PageSize maximal number of results in a page, DefaultProvenancePageSize if zero
+	PageSize int
+	// Cursor resumes the iteration after the last page returned by an iterator with the same query, from
+	// the beginning if empty
+	Cursor string
+	// DBNames if not empty, only results of these databases are returned
+	DBNames []string
+	// FromBlock and ToBlock if not zero, only results committed within the block range, inclusive, are returned
+	FromBlock uint64
+	ToBlock   uint64
+}
+
+// HistoricalDataIterator iterates over the historical values of a key, from the oldest version on
+type HistoricalDataIterator interface {
+	// Next returns the next page of values, an empty page once the iteration is done
+	Next() ([]*types.ValueWithMetadata, error)
+	// Cursor returns the cursor of the iteration, after the last returned page
+	Cursor() string
+}
+
+// KVIterator iterates over the keys read or written by a user, ordered by version and key. The server does not
+// page these results, so the first call to Next loads all the reads or writes of the user, and the pages are
+// returned from memory.
+type KVIterator interface {
+	// Next returns the next page of keys, an empty page once the iteration is done
+	Next() ([]*types.KVWithMetadata, error)
+	// Cursor returns the cursor of the iteration, after the last returned page
+	Cursor() string
+}
+
+// TxIDIterator iterates over the IDs of the txs submitted by a user, in lexicographic order. The server does not
+// page the tx IDs, so the first call to Next loads all the tx IDs of the user, and the pages are returned from memory.
+type TxIDIterator interface {
+	// Next returns the next page of tx IDs, an empty page once the iteration is done
+	Next() ([]string, error)
+	// Cursor returns the cursor of the iteration, after the last returned page
+	Cursor() string
+}
+
+func (p *provenance) IterateHistoricalData(dbName, key string, opts *ProvenanceQueryOptions) (HistoricalDataIterator, error) {
+	return newHistoricalDataIterator(p, p.getMostRecentAtOrBelow, dbName, key, opts)
+}
+
+func (p *provenance) IterateDataWrittenByUser(userID string, opts *ProvenanceQueryOptions) (KVIterator, error) {
+	return newKVIterator(p, userID, p.GetDataWrittenByUser, p.GetWriters, opts)
+}
+
+func (p *provenance) IterateDataReadByUser(userID string, opts *ProvenanceQueryOptions) (KVIterator, error) {
+	return newKVIterator(p, userID, p.GetDataReadByUser, p.GetReaders, opts)
+}
+
+func (p *provenance) IterateTxIDsSubmittedByUser(userID string, opts *ProvenanceQueryOptions) (TxIDIterator, error) {
+	return newTxIDIterator(p, &ledger{p.commonTxContext}, userID, opts)
+}
+
+// provenanceCursor the position of the last result returned by an iterator
+type provenanceCursor struct {
+	BlockNum uint64 `json:"block_num,omitempty"`
+	TxNum    uint64 `json:"tx_num,omitempty"`
+	Key      string `json:"key,omitempty"`
+	TxID     string `json:"tx_id,omitempty"`
+	// Count number of results at the position of the cursor already iterated over, as the same key may be read or
+	// written at the same version in several databases. Zero stands for all of them.
+	Count int `json:"count,omitempty"`
+}
+
+func (c *provenanceCursor) encode() string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeProvenanceCursor(cursor string) (*provenanceCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.Errorf("invalid provenance cursor '%s'", cursor)
+	}
+	c := &provenanceCursor{}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, errors.Errorf("invalid provenance cursor '%s'", cursor)
+	}
+	return c, nil
+}
+
+func (c *provenanceCursor) version() *types.Version {
+	return &types.Version{BlockNum: c.BlockNum, TxNum: c.TxNum}
+}
+
+// after tells if the position of a key at a version comes after the cursor
+func (c *provenanceCursor) after(version *types.Version, key string) bool {
+	if c == nil {
+		return true
+	}
+	if VersionLess(c.version(), version) || VersionLess(version, c.version()) {
+		return VersionLess(c.version(), version)
+	}
+	return key > c.Key
+}
+
+// at tells if the position of a key at a version is the position of the cursor
+func (c *provenanceCursor) at(version *types.Version, key string) bool {
+	return c != nil && c.BlockNum == version.GetBlockNum() && c.TxNum == version.GetTxNum() && c.Key == key
+}
+
+type queryOptions struct {
+	ProvenanceQueryOptions
+	cursor *provenanceCursor
+}
+
+func newQueryOptions(opts *ProvenanceQueryOptions) (*queryOptions, error) {
+	o := &queryOptions{}
+	if opts != nil {
+		o.ProvenanceQueryOptions = *opts
+	}
+	if o.PageSize == 0 {
+		o.PageSize = DefaultProvenancePageSize
+	}
+	if o.PageSize < 0 {
+		return nil, errors.Errorf("invalid page size %d", o.PageSize)
+	}
+	if o.ToBlock != 0 && o.FromBlock > o.ToBlock {
+		return nil, errors.Errorf("invalid block range, from block %d is after to block %d", o.FromBlock, o.ToBlock)
+	}
+
+	var err error
+	if o.cursor, err = decodeProvenanceCursor(o.Cursor); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *queryOptions) inBlockRange(blockNum uint64) bool {
+	return blockNum >= o.FromBlock && (o.ToBlock == 0 || blockNum <= o.ToBlock)
+}
+
+type historicalDataIterator struct {
+	provenance Provenance
+	dbName     string
+	key        string
+	opts       *queryOptions
+	values     []*types.ValueWithMetadata
+	fetched    bool
+	cursor     *provenanceCursor
+	// atOrBelow returns the most recent value of a key at or below a version, including a deleted value
+	atOrBelow func(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error)
+}
+
+func newHistoricalDataIterator(p Provenance, atOrBelow func(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error),
+	dbName, key string, opts *ProvenanceQueryOptions) (*historicalDataIterator, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &historicalDataIterator{
+		provenance: p,
+		atOrBelow:  atOrBelow,
+		dbName:     dbName,
+		key:        key,
+		opts:       o,
+		cursor:     o.cursor,
+	}, nil
+}
+
+func (it *historicalDataIterator) Next() ([]*types.ValueWithMetadata, error) {
+	if !it.fetched {
+		if err := it.fetch(); err != nil {
+			return nil, err
+		}
+		it.fetched = true
+	}
+
+	page := it.values
+	if len(page) > it.opts.PageSize {
+		page = page[:it.opts.PageSize]
+	}
+	it.values = it.values[len(page):]
+	if len(page) > 0 {
+		version := page[len(page)-1].GetMetadata().GetVersion()
+		it.cursor = &provenanceCursor{BlockNum: version.GetBlockNum(), TxNum: version.GetTxNum()}
+	}
+	return page, nil
+}
+
+func (it *historicalDataIterator) Cursor() string {
+	return it.cursor.encode()
+}
+
+// fetch narrows the history on the server side to the versions after the start of the range, or
+// before its end, and filters the rest on the client side. The ends are looked up in the raw history,
+// so values deleted within the range are returned too
+func (it *historicalDataIterator) fetch() error {
+	fromBlock := it.opts.FromBlock
+	if it.cursor != nil && it.cursor.BlockNum > fromBlock {
+		fromBlock = it.cursor.BlockNum
+	}
+
+	var values []*types.ValueWithMetadata
+	var err error
+	switch {
+	case fromBlock > 1:
+		var start *types.ValueWithMetadata
+		if start, err = it.atOrBelow(it.dbName, it.key, &types.Version{BlockNum: fromBlock - 1, TxNum: math.MaxUint64}); err != nil {
+			return err
+		}
+		if start == nil {
+			values, err = it.provenance.GetHistoricalData(it.dbName, it.key)
+		} else {
+			values, err = it.provenance.GetNextHistoricalData(it.dbName, it.key, start.GetMetadata().GetVersion())
+		}
+	case it.opts.ToBlock > 0:
+		var end *types.ValueWithMetadata
+		if end, err = it.atOrBelow(it.dbName, it.key, &types.Version{BlockNum: it.opts.ToBlock, TxNum: math.MaxUint64}); err != nil || end == nil {
+			return err
+		}
+		if values, err = it.provenance.GetPreviousHistoricalData(it.dbName, it.key, end.GetMetadata().GetVersion()); err == nil {
+			values = append(values, end)
+		}
+	default:
+		values, err = it.provenance.GetHistoricalData(it.dbName, it.key)
+	}
+	if err != nil {
+		return err
+	}
+
+	sortValuesByVersion(values)
+	for _, v := range values {
+		version := v.GetMetadata().GetVersion()
+		if it.opts.inBlockRange(version.GetBlockNum()) && it.cursor.after(version, "") {
+			it.values = append(it.values, v)
+		}
+	}
+	return nil
+}
+
+type kvIterator struct {
+	provenance Provenance
+	userID     string
+	query      func(userID string) ([]*types.KVWithMetadata, error)
+	// accessors returns the users who accessed a key the way the query does, i.e. its readers or writers
+	accessors func(dbName, key string) ([]string, error)
+	opts      *queryOptions
+	kvs       []*types.KVWithMetadata
+	fetched   bool
+	cursor    *provenanceCursor
+	// dbKeys the keys looked up in the databases of the query, by database and key
+	dbKeys map[string]map[string]*dbKey
+}
+
+// dbKey a key looked up in a database
+type dbKey struct {
+	// accessed tells if the user accessed the key in the database
+	accessed bool
+	// values the history of the key, fetched only if the user accessed the key
+	values []*types.ValueWithMetadata
+	// matched the versions of the history already matched to a result of the query
+	matched map[string]bool
+}
+
+func newKVIterator(p Provenance, userID string, query func(userID string) ([]*types.KVWithMetadata, error),
+	accessors func(dbName, key string) ([]string, error), opts *ProvenanceQueryOptions) (*kvIterator, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &kvIterator{
+		provenance: p,
+		userID:     userID,
+		query:      query,
+		accessors:  accessors,
+		opts:       o,
+		cursor:     o.cursor,
+		dbKeys:     make(map[string]map[string]*dbKey),
+	}, nil
+}
+
+// Next checks the databases of the keys only if databases are given, and only for as many keys as needed to fill the page
+func (it *kvIterator) Next() ([]*types.KVWithMetadata, error) {
+	if !it.fetched {
+		if err := it.fetch(); err != nil {
+			return nil, err
+		}
+		it.fetched = true
+	}
+
+	var page []*types.KVWithMetadata
+	for len(it.kvs) > 0 && len(page) < it.opts.PageSize {
+		kv := it.kvs[0]
+		inDBs, err := it.inDBs(kv)
+		if err != nil {
+			return nil, err
+		}
+		if inDBs {
+			page = append(page, kv)
+		}
+		it.kvs = it.kvs[1:]
+
+		// the cursor moves past the results filtered out as well
+		version := kv.GetMetadata().GetVersion()
+		count := 1
+		if it.cursor.at(version, kv.GetKey()) {
+			count = it.cursor.Count + 1
+		}
+		it.cursor = &provenanceCursor{BlockNum: version.GetBlockNum(), TxNum: version.GetTxNum(), Key: kv.GetKey(), Count: count}
+	}
+	return page, nil
+}
+
+func (it *kvIterator) Cursor() string {
+	return it.cursor.encode()
+}
+
+func (it *kvIterator) fetch() error {
+	kvs, err := it.query(it.userID)
+	if err != nil {
+		return err
+	}
+
+	// results at the same position are ordered by value, so a cursor skips the same ones in every query
+	sort.SliceStable(kvs, func(i, j int) bool {
+		vi := kvs[i].GetMetadata().GetVersion()
+		vj := kvs[j].GetMetadata().GetVersion()
+		if VersionLess(vi, vj) || VersionLess(vj, vi) {
+			return VersionLess(vi, vj)
+		}
+		if kvs[i].GetKey() != kvs[j].GetKey() {
+			return kvs[i].GetKey() < kvs[j].GetKey()
+		}
+		return bytes.Compare(kvs[i].GetValue(), kvs[j].GetValue()) < 0
+	})
+
+	skipped := 0
+	for _, kv := range kvs {
+		version := kv.GetMetadata().GetVersion()
+		if !it.opts.inBlockRange(version.GetBlockNum()) {
+			continue
+		}
+		if it.cursor.at(version, kv.GetKey()) {
+			if it.cursor.Count == 0 || skipped < it.cursor.Count {
+				skipped++
+				continue
+			}
+		} else if !it.cursor.after(version, kv.GetKey()) {
+			continue
+		}
+		it.kvs = append(it.kvs, kv)
+	}
+	return nil
+}
+
+// inDBs tells if kv belongs to one of the databases of the query. The server does not return the database of
+// the keys read or written by a user, so kv is matched to a database in which the user accessed the key and the
+// key has the value of kv at its version. Each version of a key in a database is matched to a single result, as
+// the server returns a result for each database the key was accessed in. The users who accessed a key and its
+// history are queried once per key and database.
+func (it *kvIterator) inDBs(kv *types.KVWithMetadata) (bool, error) {
+	if len(it.opts.DBNames) == 0 {
+		return true, nil
+	}
+	version := kv.GetMetadata().GetVersion()
+	versionKey := fmt.Sprintf("%d:%d", version.GetBlockNum(), version.GetTxNum())
+	for _, dbName := range it.opts.DBNames {
+		k, err := it.dbKey(dbName, kv.GetKey())
+		if err != nil {
+			return false, err
+		}
+		if !k.accessed || k.matched[versionKey] {
+			continue
+		}
+		for _, v := range k.values {
+			if proto.Equal(v.GetMetadata().GetVersion(), version) && bytes.Equal(v.GetValue(), kv.GetValue()) {
+				k.matched[versionKey] = true
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (it *kvIterator) dbKey(dbName, key string) (*dbKey, error) {
+	if k, ok := it.dbKeys[dbName][key]; ok {
+		return k, nil
+	}
+
+	users, err := it.accessors(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to look up key '%s' in database '%s'", key, dbName)
+	}
+	k := &dbKey{matched: make(map[string]bool)}
+	for _, user := range users {
+		if user == it.userID {
+			k.accessed = true
+			break
+		}
+	}
+	if k.accessed {
+		if k.values, err = it.provenance.GetHistoricalData(dbName, key); err != nil {
+			return nil, errors.WithMessagef(err, "failed to look up key '%s' in database '%s'", key, dbName)
+		}
+	}
+
+	if _, ok := it.dbKeys[dbName]; !ok {
+		it.dbKeys[dbName] = make(map[string]*dbKey)
+	}
+	it.dbKeys[dbName][key] = k
+	return k, nil
+}
+
+type txIDIterator struct {
+	provenance Provenance
+	ledger     Ledger
+	userID     string
+	opts       *queryOptions
+	txIDs      []string
+	fetched    bool
+	cursor     *provenanceCursor
+}
+
+func newTxIDIterator(p Provenance, l Ledger, userID string, opts *ProvenanceQueryOptions) (*txIDIterator, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.DBNames) > 0 {
+		return nil, errors.New("filtering tx IDs by database is not supported")
+	}
+	return &txIDIterator{
+		provenance: p,
+		ledger:     l,
+		userID:     userID,
+		opts:       o,
+		cursor:     o.cursor,
+	}, nil
+}
+
+// Next fetches the receipts of the txs only if a block range is given, and only as many as needed to fill the page
+func (it *txIDIterator) Next() ([]string, error) {
+	if !it.fetched {
+		txIDs, err := it.provenance.GetTxIDsSubmittedByUser(it.userID)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(txIDs)
+		for _, txID := range txIDs {
+			if it.cursor == nil || txID > it.cursor.TxID {
+				it.txIDs = append(it.txIDs, txID)
+			}
+		}
+		it.fetched = true
+	}
+
+	var page []string
+	for len(it.txIDs) > 0 && len(page) < it.opts.PageSize {
+		txID := it.txIDs[0]
+		if it.opts.FromBlock != 0 || it.opts.ToBlock != 0 {
+			receipt, err := it.ledger.GetTransactionReceipt(txID)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+			}
+			if !it.opts.inBlockRange(receipt.GetHeader().GetBaseHeader().GetNumber()) {
+				it.txIDs = it.txIDs[1:]
+				continue
+			}
+		}
+		page = append(page, txID)
+		it.txIDs = it.txIDs[1:]
+	}
+	if len(page) > 0 {
+		it.cursor = &provenanceCursor{TxID: page[len(page)-1]}
+	}
+	return page, nil
+}
+
+func (it *txIDIterator) Cursor() string {
+	return it.cursor.encode()
+}
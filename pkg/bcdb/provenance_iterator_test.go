@@ -0,0 +1,336 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func (p *historyProvenance) GetPreviousHistoricalData(dbName, key string, version *types.Version) ([]*types.ValueWithMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var previous []*types.ValueWithMetadata
+	for _, v := range p.values {
+		if VersionLess(v.GetMetadata().GetVersion(), version) {
+			previous = append(previous, v)
+		}
+	}
+	return previous, nil
+}
+
+// getMostRecentAtOrBelow returns the most recent value at or below version, deleted or not, as the server does
+func (p *historyProvenance) getMostRecentAtOrBelow(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	values, _ := p.GetPreviousHistoricalData(dbName, key, version)
+	if at, _ := p.GetHistoricalDataAt(dbName, key, version); at != nil {
+		values = append(values, at)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	sortValuesByVersion(values)
+	return values[len(values)-1], nil
+}
+
+// userProvenance serves the writes of alice, and the histories of keys in databases, and counts the key lookups
+type userProvenance struct {
+	Provenance
+	writes  []*types.KVWithMetadata
+	values  map[string][]*types.ValueWithMetadata
+	writers map[string][]string
+	txIDs   []string
+	lookups int
+}
+
+func (p *userProvenance) GetDataWrittenByUser(userID string) ([]*types.KVWithMetadata, error) {
+	return p.writes, nil
+}
+
+func (p *userProvenance) GetHistoricalData(dbName, key string) ([]*types.ValueWithMetadata, error) {
+	p.lookups++
+	return p.values[dbName+"/"+key], nil
+}
+
+func (p *userProvenance) GetWriters(dbName, key string) ([]string, error) {
+	p.lookups++
+	return p.writers[dbName+"/"+key], nil
+}
+
+func (p *userProvenance) GetTxIDsSubmittedByUser(userID string) ([]string, error) {
+	return p.txIDs, nil
+}
+
+// write adds a write of user to key, only the writes of alice are returned by GetDataWrittenByUser
+func (p *userProvenance) write(user, dbName, key, value string, blockNum, txNum uint64) {
+	if user == "alice" {
+		kv := &types.KVWithMetadata{
+			Key:      key,
+			Value:    []byte(value),
+			Metadata: &types.Metadata{Version: &types.Version{BlockNum: blockNum, TxNum: txNum}},
+		}
+		p.writes = append([]*types.KVWithMetadata{kv}, p.writes...)
+	}
+	p.values[dbName+"/"+key] = append(p.values[dbName+"/"+key], historyValue(value, blockNum, txNum))
+	p.writers[dbName+"/"+key] = append(p.writers[dbName+"/"+key], user)
+}
+
+// receiptLedger serves the receipts of txs committed in blocks named by their IDs
+type receiptLedger struct {
+	Ledger
+	receipts int
+}
+
+func (l *receiptLedger) GetTransactionReceipt(txID string) (*types.TxReceipt, error) {
+	l.receipts++
+	var blockNum uint64
+	_, err := fmt.Sscanf(txID, "tx%d", &blockNum)
+	if err != nil {
+		return nil, err
+	}
+	return &types.TxReceipt{Header: &types.BlockHeader{BaseHeader: &types.BlockHeaderBase{Number: blockNum}}}, nil
+}
+
+func iteratedValues(t *testing.T, it HistoricalDataIterator) [][]string {
+	var pages [][]string
+	for {
+		page, err := it.Next()
+		require.NoError(t, err)
+		if len(page) == 0 {
+			return pages
+		}
+		var values []string
+		for _, v := range page {
+			values = append(values, string(v.GetValue()))
+		}
+		pages = append(pages, values)
+	}
+}
+
+func TestHistoricalDataIterator(t *testing.T) {
+	p := &historyProvenance{}
+	for i, blockNum := range []uint64{2, 3, 3, 5, 8, 9, 12} {
+		p.write(fmt.Sprintf("v%d", i), blockNum, uint64(i))
+	}
+	newIterator := func(opts *ProvenanceQueryOptions) (*historicalDataIterator, error) {
+		return newHistoricalDataIterator(p, p.getMostRecentAtOrBelow, "bdb", "key1", opts)
+	}
+
+	it, err := newIterator(&ProvenanceQueryOptions{PageSize: 3})
+	require.NoError(t, err)
+	require.Equal(t, "", it.Cursor())
+	require.Equal(t, [][]string{{"v0", "v1", "v2"}, {"v3", "v4", "v5"}, {"v6"}}, iteratedValues(t, it))
+
+	// resume after the first page
+	it, err = newIterator(&ProvenanceQueryOptions{PageSize: 3})
+	require.NoError(t, err)
+	_, err = it.Next()
+	require.NoError(t, err)
+	it, err = newIterator(&ProvenanceQueryOptions{PageSize: 4, Cursor: it.Cursor()})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"v3", "v4", "v5", "v6"}}, iteratedValues(t, it))
+
+	for _, tt := range []struct {
+		from, to uint64
+		values   []string
+	}{
+		{from: 3, to: 8, values: []string{"v1", "v2", "v3", "v4"}},
+		{from: 4, values: []string{"v3", "v4", "v5", "v6"}},
+		{to: 3, values: []string{"v0", "v1", "v2"}},
+		{to: 1},
+		{from: 13},
+	} {
+		it, err = newIterator(&ProvenanceQueryOptions{FromBlock: tt.from, ToBlock: tt.to})
+		require.NoError(t, err)
+		page, err := it.Next()
+		require.NoError(t, err)
+		var values []string
+		for _, v := range page {
+			values = append(values, string(v.GetValue()))
+		}
+		require.Equal(t, tt.values, values, "from %d to %d", tt.from, tt.to)
+	}
+
+	// values deleted within the range are iterated
+	p.delete()
+	p.write("v7", 14, 0)
+	for _, tt := range []struct {
+		from, to uint64
+		values   []string
+	}{
+		{from: 13, values: []string{"v7"}},
+		{to: 13, values: []string{"v0", "v1", "v2", "v3", "v4", "v5", "v6"}},
+		{from: 10, to: 13, values: []string{"v6"}},
+	} {
+		it, err = newIterator(&ProvenanceQueryOptions{FromBlock: tt.from, ToBlock: tt.to})
+		require.NoError(t, err)
+		require.Equal(t, [][]string{tt.values}, iteratedValues(t, it), "from %d to %d", tt.from, tt.to)
+	}
+
+	_, err = newIterator(&ProvenanceQueryOptions{FromBlock: 5, ToBlock: 4})
+	require.EqualError(t, err, "invalid block range, from block 5 is after to block 4")
+	_, err = newIterator(&ProvenanceQueryOptions{Cursor: "not a cursor"})
+	require.EqualError(t, err, "invalid provenance cursor 'not a cursor'")
+}
+
+func newUserProvenance() *userProvenance {
+	return &userProvenance{values: make(map[string][]*types.ValueWithMetadata), writers: make(map[string][]string)}
+}
+
+func TestKVIterator(t *testing.T) {
+	p := newUserProvenance()
+	p.write("alice", "db1", "key2", "a", 2, 0)
+	p.write("alice", "db2", "key1", "b", 2, 0)
+	p.write("alice", "db1", "key1", "c", 3, 1)
+	p.write("alice", "db2", "key3", "d", 4, 0)
+	p.write("alice", "db1", "key3", "e", 6, 2)
+
+	keys := func(it KVIterator) []string {
+		var keys []string
+		for {
+			page, err := it.Next()
+			require.NoError(t, err)
+			if len(page) == 0 {
+				return keys
+			}
+			for _, kv := range page {
+				keys = append(keys, fmt.Sprintf("%s=%s", kv.GetKey(), kv.GetValue()))
+			}
+		}
+	}
+	newIterator := func(opts *ProvenanceQueryOptions) *kvIterator {
+		it, err := newKVIterator(p, "alice", p.GetDataWrittenByUser, p.GetWriters, opts)
+		require.NoError(t, err)
+		return it
+	}
+
+	it := newIterator(&ProvenanceQueryOptions{PageSize: 2})
+	require.Equal(t, []string{"key1=b", "key2=a", "key1=c", "key3=d", "key3=e"}, keys(it))
+	require.Equal(t, 0, p.lookups)
+
+	it = newIterator(&ProvenanceQueryOptions{PageSize: 1, DBNames: []string{"db1"}, ToBlock: 5})
+	page, err := it.Next()
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, "key2", page[0].GetKey())
+	it = newIterator(&ProvenanceQueryOptions{DBNames: []string{"db1"}, ToBlock: 5, Cursor: it.Cursor()})
+	require.Equal(t, []string{"key1=c"}, keys(it))
+
+	it = newIterator(&ProvenanceQueryOptions{DBNames: []string{"db2", "db3"}, FromBlock: 3})
+	require.Equal(t, []string{"key3=d"}, keys(it))
+
+	// the key is looked up once per database
+	p.lookups = 0
+	it = newIterator(&ProvenanceQueryOptions{DBNames: []string{"db1"}})
+	require.Equal(t, []string{"key2=a", "key1=c", "key3=e"}, keys(it))
+	require.Equal(t, 6, p.lookups)
+}
+
+func TestKVIterator_SameKeyInDBs(t *testing.T) {
+	p := newUserProvenance()
+	// a tx of alice writes key1 in three databases, and a tx of bob writes the same value to key2 in db2 and db3
+	p.write("alice", "db1", "key1", "a", 2, 0)
+	p.write("alice", "db2", "key1", "a", 2, 0)
+	p.write("alice", "db3", "key1", "b", 2, 0)
+	p.write("alice", "db1", "key2", "c", 3, 0)
+	p.write("bob", "db2", "key2", "c", 3, 0)
+	p.write("bob", "db3", "key2", "c", 3, 0)
+
+	pages := func(opts *ProvenanceQueryOptions) [][]string {
+		it, err := newKVIterator(p, "alice", p.GetDataWrittenByUser, p.GetWriters, opts)
+		require.NoError(t, err)
+		var pages [][]string
+		for {
+			page, err := it.Next()
+			require.NoError(t, err)
+			if len(page) == 0 {
+				return pages
+			}
+			var kvs []string
+			for _, kv := range page {
+				kvs = append(kvs, fmt.Sprintf("%s=%s", kv.GetKey(), kv.GetValue()))
+			}
+			pages = append(pages, kvs)
+			opts.Cursor = it.Cursor()
+			it, err = newKVIterator(p, "alice", p.GetDataWrittenByUser, p.GetWriters, opts)
+			require.NoError(t, err)
+		}
+	}
+
+	// the writes at the same position are not skipped when a page ends among them
+	require.Equal(t, [][]string{{"key1=a"}, {"key1=a"}, {"key1=b"}, {"key2=c"}}, pages(&ProvenanceQueryOptions{PageSize: 1}))
+	// a write in one database is not matched to the same value in another database
+	require.Equal(t, [][]string{{"key1=a"}}, pages(&ProvenanceQueryOptions{DBNames: []string{"db2"}}))
+	require.Equal(t, [][]string{{"key1=a", "key1=a", "key2=c"}}, pages(&ProvenanceQueryOptions{DBNames: []string{"db1", "db2"}}))
+	require.Equal(t, [][]string{{"key1=b"}}, pages(&ProvenanceQueryOptions{DBNames: []string{"db3"}}))
+	require.Equal(t, [][]string{{"key1=a", "key2=c"}}, pages(&ProvenanceQueryOptions{DBNames: []string{"db1"}}))
+
+	// a cursor without a count skips all the results at its position
+	cursor := (&provenanceCursor{BlockNum: 2, Key: "key1"}).encode()
+	require.Equal(t, [][]string{{"key2=c"}}, pages(&ProvenanceQueryOptions{Cursor: cursor}))
+}
+
+func TestTxIDIterator(t *testing.T) {
+	p := &userProvenance{txIDs: []string{"tx7", "tx3", "tx9", "tx1", "tx5"}}
+	l := &receiptLedger{}
+
+	it, err := newTxIDIterator(p, l, "alice", &ProvenanceQueryOptions{PageSize: 2})
+	require.NoError(t, err)
+	page, err := it.Next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tx1", "tx3"}, page)
+	require.Equal(t, 0, l.receipts)
+
+	it, err = newTxIDIterator(p, l, "alice", &ProvenanceQueryOptions{PageSize: 2, FromBlock: 4, Cursor: it.Cursor()})
+	require.NoError(t, err)
+	page, err = it.Next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tx5", "tx7"}, page)
+	require.Equal(t, 2, l.receipts)
+	page, err = it.Next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tx9"}, page)
+	page, err = it.Next()
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	_, err = newTxIDIterator(p, l, "alice", &ProvenanceQueryOptions{DBNames: []string{"db1"}})
+	require.EqualError(t, err, "filtering tx IDs by database is not supported")
+}
+
+func TestProvenanceIterators(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	var blocks []uint64
+	for i := 0; i < 5; i++ {
+		receipt := putKeySync(t, "bdb", "key1", fmt.Sprintf("value%d", i), "alice", aliceSession)
+		blocks = append(blocks, receipt.GetHeader().GetBaseHeader().GetNumber())
+	}
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+
+	it, err := p.IterateHistoricalData("bdb", "key1", &ProvenanceQueryOptions{PageSize: 2, FromBlock: blocks[1]})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"value1", "value2"}, {"value3", "value4"}}, iteratedValues(t, it))
+
+	kvIt, err := p.IterateDataWrittenByUser("alice", &ProvenanceQueryOptions{DBNames: []string{"bdb"}, ToBlock: blocks[2]})
+	require.NoError(t, err)
+	kvs, err := kvIt.Next()
+	require.NoError(t, err)
+	require.Len(t, kvs, 3)
+	require.Equal(t, []byte("value2"), kvs[2].GetValue())
+
+	txIt, err := p.IterateTxIDsSubmittedByUser("alice", &ProvenanceQueryOptions{FromBlock: blocks[3]})
+	require.NoError(t, err)
+	txIDs, err := txIt.Next()
+	require.NoError(t, err)
+	require.Len(t, txIDs, 2)
+}
@@ -0,0 +1,178 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// RecordType describes a type of records kept in a database under a common key prefix,
+// the key of each record is the prefix followed by the record ID
+type RecordType struct {
+	// Name of the record type, e.g. "car"
+	Name string
+	// Prefix of the keys of all records of the type, e.g. "car~"
+	Prefix string
+	// ID derives the record ID from the record
+	ID func(record interface{}) (string, error)
+	// New returns a new empty record, used to decode historical records
+	New func() interface{}
+	// Codec encodes and decodes the records, JSONCodec is used if nil
+	Codec Codec
+	// ACL is the access control of saved records, unless a different ACL is provided to Save
+	ACL *types.AccessControl
+}
+
+// Repository keeps the record types of a single database,
+// every record type is registered under a distinct key prefix
+type Repository struct {
+	dbName string
+	stores map[string]*RecordStore
+}
+
+// NewRepository creates an empty repository of record types stored in database dbName
+func NewRepository(dbName string) *Repository {
+	return &Repository{
+		dbName: dbName,
+		stores: map[string]*RecordStore{},
+	}
+}
+
+// Register adds a record type to the repository and returns the store of its records.
+// The prefix of the record type must not overlap the prefix of any other registered type.
+func (r *Repository) Register(recordType *RecordType) (*RecordStore, error) {
+	switch {
+	case recordType == nil:
+		return nil, errors.New("record type is nil")
+	case recordType.Name == "":
+		return nil, errors.New("record type name is empty")
+	case recordType.Prefix == "":
+		return nil, errors.Errorf("record type '%s' has empty key prefix", recordType.Name)
+	case recordType.ID == nil:
+		return nil, errors.Errorf("record type '%s' has no ID function", recordType.Name)
+	case recordType.New == nil:
+		return nil, errors.Errorf("record type '%s' has no New function", recordType.Name)
+	}
+
+	if _, ok := r.stores[recordType.Name]; ok {
+		return nil, errors.Errorf("record type '%s' is already registered", recordType.Name)
+	}
+	for name, store := range r.stores {
+		prefix := store.recordType.Prefix
+		if strings.HasPrefix(prefix, recordType.Prefix) || strings.HasPrefix(recordType.Prefix, prefix) {
+			return nil, errors.Errorf("key prefix '%s' of record type '%s' overlaps key prefix '%s' of record type '%s'",
+				recordType.Prefix, recordType.Name, prefix, name)
+		}
+	}
+
+	rt := *recordType
+	if rt.Codec == nil {
+		rt.Codec = JSONCodec
+	}
+	store := &RecordStore{
+		dbName:     r.dbName,
+		recordType: &rt,
+	}
+	r.stores[rt.Name] = store
+	return store, nil
+}
+
+// Store returns the store of a registered record type
+func (r *Repository) Store(name string) (*RecordStore, bool) {
+	store, ok := r.stores[name]
+	return store, ok
+}
+
+// RecordStore loads, saves and deletes records of a single record type
+type RecordStore struct {
+	dbName     string
+	recordType *RecordType
+}
+
+// RecordVersion is a historical record, along with its metadata
+type RecordVersion struct {
+	// Record decoded record, nil if the version has no value
+	Record   interface{}
+	Metadata *types.Metadata
+}
+
+// Key returns the database key of the record with the given ID
+func (s *RecordStore) Key(id string) string {
+	return s.recordType.Prefix + id
+}
+
+// KeyOf returns the database key of the record
+func (s *RecordStore) KeyOf(record interface{}) (string, error) {
+	id, err := s.recordType.ID(record)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to derive ID of record type '%s'", s.recordType.Name)
+	}
+	if id == "" {
+		return "", errors.Errorf("empty ID derived for record type '%s'", s.recordType.Name)
+	}
+	return s.Key(id), nil
+}
+
+// Load reads the record with the given ID within tx into record, returns nil metadata if the record does not exist
+func (s *RecordStore) Load(tx DataTxContext, id string, record interface{}) (*types.Metadata, error) {
+	return tx.GetWithCodec(s.dbName, s.Key(id), record, s.recordType.Codec)
+}
+
+// Save writes the record within tx, if acl is nil the record type ACL is used. Returns the key of the record
+func (s *RecordStore) Save(tx DataTxContext, record interface{}, acl *types.AccessControl) (string, error) {
+	key, err := s.KeyOf(record)
+	if err != nil {
+		return "", err
+	}
+	if acl == nil {
+		acl = s.recordType.ACL
+	}
+	return key, tx.PutWithCodec(s.dbName, key, record, acl, s.recordType.Codec)
+}
+
+// Delete deletes the record with the given ID within tx
+func (s *RecordStore) Delete(tx DataTxContext, id string) error {
+	return tx.Delete(s.dbName, s.Key(id))
+}
+
+// History returns all the historical versions of the record with the given ID, ordered from the oldest version.
+// valueCodec is the value codec the records were saved with, see DataTxContext.SetValueCodec, nil if none.
+func (s *RecordStore) History(p Provenance, id string, valueCodec ValueCodec) ([]*RecordVersion, error) {
+	key := s.Key(id)
+	values, err := p.GetHistoricalData(s.dbName, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*RecordVersion
+	for _, v := range values {
+		version := &RecordVersion{
+			Metadata: v.GetMetadata(),
+		}
+		value := v.GetValue()
+		if len(value) > 0 && valueCodec != nil {
+			if value, err = valueCodec.Decode(s.dbName, key, value, v.GetMetadata()); err != nil {
+				return nil, errors.WithMessagef(err, "failed to decode version %s of key '%s' in database '%s'",
+					v.GetMetadata().GetVersion(), key, s.dbName)
+			}
+		}
+		if len(value) > 0 {
+			record := s.recordType.New()
+			if err = decodeWithCodec(s.recordType.Codec, value, record); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode version %s of key '%s' in database '%s' as %s",
+					v.GetMetadata().GetVersion(), key, s.dbName, s.recordType.Codec.ContentType())
+			}
+			version.Record = record
+		}
+		versions = append(versions, version)
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return VersionLess(versions[i].Metadata.GetVersion(), versions[j].Metadata.GetVersion())
+	})
+	return versions, nil
+}
@@ -0,0 +1,183 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecordType(name, prefix string) *RecordType {
+	return &RecordType{
+		Name:   name,
+		Prefix: prefix,
+		ID: func(record interface{}) (string, error) {
+			r, ok := record.(*testRecord)
+			if !ok {
+				return "", errors.Errorf("unexpected record type %T", record)
+			}
+			return r.Name, nil
+		},
+		New: func() interface{} {
+			return &testRecord{}
+		},
+	}
+}
+
+func TestRepository_Register(t *testing.T) {
+	repo := NewRepository("bdb")
+
+	store, err := repo.Register(testRecordType("car", "car~"))
+	require.NoError(t, err)
+	require.NotNil(t, store)
+	require.Equal(t, "car~1234", store.Key("1234"))
+	key, err := store.KeyOf(&testRecord{Name: "1234"})
+	require.NoError(t, err)
+	require.Equal(t, "car~1234", key)
+	_, err = store.KeyOf(&testRecord{})
+	require.EqualError(t, err, "empty ID derived for record type 'car'")
+	_, err = store.KeyOf("1234")
+	require.EqualError(t, err, "failed to derive ID of record type 'car': unexpected record type string")
+
+	s, ok := repo.Store("car")
+	require.True(t, ok)
+	require.Equal(t, store, s)
+	_, ok = repo.Store("bike")
+	require.False(t, ok)
+
+	tests := []struct {
+		name       string
+		recordType *RecordType
+		errMessage string
+	}{
+		{
+			name:       "nil",
+			recordType: nil,
+			errMessage: "record type is nil",
+		},
+		{
+			name:       "empty name",
+			recordType: testRecordType("", "bike~"),
+			errMessage: "record type name is empty",
+		},
+		{
+			name:       "empty prefix",
+			recordType: testRecordType("bike", ""),
+			errMessage: "record type 'bike' has empty key prefix",
+		},
+		{
+			name:       "no ID",
+			recordType: &RecordType{Name: "bike", Prefix: "bike~", New: func() interface{} { return nil }},
+			errMessage: "record type 'bike' has no ID function",
+		},
+		{
+			name:       "already registered",
+			recordType: testRecordType("car", "car2~"),
+			errMessage: "record type 'car' is already registered",
+		},
+		{
+			name:       "overlapping prefix",
+			recordType: testRecordType("carOwner", "car~owner~"),
+			errMessage: "key prefix 'car~owner~' of record type 'carOwner' overlaps key prefix 'car~' of record type 'car'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := repo.Register(tt.recordType)
+			require.EqualError(t, err, tt.errMessage)
+			require.Nil(t, store)
+		})
+	}
+}
+
+func TestRepository_LoadSaveDeleteHistory(t *testing.T) {
+	clientCertTemDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCertTemDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCertTemDir, "alice")
+
+	recordType := testRecordType("car", "car~")
+	recordType.ACL = &types.AccessControl{
+		ReadUsers:      map[string]bool{"alice": true},
+		ReadWriteUsers: map[string]bool{"alice": true},
+	}
+	store, err := NewRepository("bdb").Register(recordType)
+	require.NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		tx, err := aliceSession.DataTx()
+		require.NoError(t, err)
+		key, err := store.Save(tx, &testRecord{Name: "1234", Count: i}, nil)
+		require.NoError(t, err)
+		require.Equal(t, "car~1234", key)
+		_, _, err = tx.Commit(true)
+		require.NoError(t, err)
+	}
+
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	record := &testRecord{}
+	meta, err := store.Load(tx, "1234", record)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	require.Equal(t, &testRecord{Name: "1234", Count: 3}, record)
+	require.Equal(t, recordType.ACL.GetReadWriteUsers(), meta.GetAccessControl().GetReadWriteUsers())
+	require.NoError(t, store.Delete(tx, "1234"))
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+
+	tx, err = aliceSession.DataTx()
+	require.NoError(t, err)
+	meta, err = store.Load(tx, "1234", &testRecord{})
+	require.NoError(t, err)
+	require.Nil(t, meta)
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+	versions, err := store.History(p, "1234", nil)
+	require.NoError(t, err)
+	var counts []int
+	for _, v := range versions {
+		if v.Record != nil {
+			counts = append(counts, v.Record.(*testRecord).Count)
+		}
+	}
+	require.Equal(t, []int{1, 2, 3}, counts)
+}
+
+func TestRecordStore_HistoryWithValueCodec(t *testing.T) {
+	store, err := NewRepository("bdb").Register(testRecordType("car", "car~"))
+	require.NoError(t, err)
+	codec, err := NewCompressionValueCodec(CompressionGzip, 0)
+	require.NoError(t, err)
+	defer codec.Close()
+
+	name := strings.Repeat("car ", 50)
+	p := &historyProvenance{}
+	for i := 1; i <= 2; i++ {
+		value, err := JSONCodec.Marshal(&testRecord{Name: name, Count: i})
+		require.NoError(t, err)
+		encoded, err := codec.Encode("bdb", "car~1234", value, nil)
+		require.NoError(t, err)
+		_, tagged := ContentTypeOf(encoded)
+		require.True(t, tagged)
+		p.write(string(encoded), uint64(i+1), 0)
+	}
+
+	versions, err := store.History(p, "1234", codec)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, &testRecord{Name: name, Count: 1}, versions[0].Record)
+	require.Equal(t, &testRecord{Name: name, Count: 2}, versions[1].Record)
+
+	_, err = store.History(p, "1234", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to decode version")
+}
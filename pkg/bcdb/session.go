@@ -147,6 +147,26 @@ func (d *dbSession) Ledger() (Ledger, error) {
 	}, nil
 }
 
+// CompareAndSwap replaces the value of a single key, only if its committed version is still the expected version
+func (d *dbSession) CompareAndSwap(dbName, key string, expected *types.Version, value []byte, acl *types.AccessControl) (string, *types.TxReceipt, error) {
+	tx, err := d.DataTx()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = tx.PutIfVersion(dbName, key, value, acl, expected); err != nil {
+		tx.Abort()
+		return "", nil, err
+	}
+
+	txID, receipt, err := tx.Commit(true)
+	if err != nil && errors.Is(err, ErrVersionMismatch) {
+		d.logger.Debugf("compare and swap of key %s in database %s failed, due to %s", key, dbName, err)
+		return txID, receipt, errors.WithMessagef(ErrVersionMismatch, "compare and swap of key '%s' in database '%s', expected version %s", key, dbName, expected)
+	}
+	return txID, receipt, err
+}
+
 func (d *dbSession) newCommonTxContext() (*commonTxContext, error) {
 	httpClient := newHTTPClient()
 
@@ -0,0 +1,199 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"math"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/constants"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is a read-only view of the database state as of a block
+type Snapshot interface {
+	// BlockNum returns the number of the block the snapshot is taken at
+	BlockNum() uint64
+	// Get returns the most recent value of key written at or before the snapshot block, nil if the key was not
+	// written up to the block or was deleted at or before the block
+	Get(dbName, key string) (*types.ValueWithMetadata, error)
+	// GetWithProof returns the value of key as Get does, along with a verified proof that the value is part of
+	// the state of the snapshot block. If the key was deleted as of the block, a nil value and a verified proof
+	// of the deletion are returned. If the key was not written up to the block, no proof is returned.
+	GetWithProof(dbName, key string) (*types.ValueWithMetadata, *StateProof, error)
+}
+
+func (p *provenance) GetAsOfBlock(dbName, key string, blockNum uint64) (*types.ValueWithMetadata, error) {
+	value, err := p.getMostRecentAtOrBelow(dbName, key, &types.Version{BlockNum: blockNum, TxNum: math.MaxUint64})
+	if err != nil {
+		return nil, err
+	}
+	return valueAsOfBlock(p, &ledger{p.commonTxContext}, dbName, key, value, blockNum)
+}
+
+func (p *provenance) GetBeforeTx(dbName, key, txID string) (*types.ValueWithMetadata, error) {
+	receipt, err := (&ledger{p.commonTxContext}).GetTransactionReceipt(txID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+	}
+	return p.GetBeforeVersion(dbName, key, &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	})
+}
+
+func (p *provenance) GetBeforeVersion(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	blockNum := version.GetBlockNum()
+	previous := &types.Version{BlockNum: blockNum, TxNum: version.GetTxNum() - 1}
+	if version.GetTxNum() == 0 {
+		if blockNum <= 1 {
+			return nil, nil
+		}
+		previous = &types.Version{BlockNum: blockNum - 1, TxNum: math.MaxUint64}
+	}
+	value, err := p.getMostRecentAtOrBelow(dbName, key, previous)
+	if err != nil {
+		return nil, err
+	}
+	return valueBeforeVersion(p, &ledger{p.commonTxContext}, dbName, key, value, version)
+}
+
+func (p *provenance) SnapshotAt(blockNum uint64) (Snapshot, error) {
+	return newSnapshot(p, &ledger{p.commonTxContext}, blockNum)
+}
+
+func (p *provenance) getMostRecentAtOrBelow(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	path := constants.URLForGetHistoricalDataAtOrBelow(dbName, key, version)
+	resEnv := &types.GetHistoricalDataResponseEnvelope{}
+	err := p.handleRequest(
+		path,
+		&types.GetHistoricalDataQuery{
+			UserId:     p.userID,
+			DbName:     dbName,
+			Key:        key,
+			Version:    version,
+			MostRecent: true,
+		}, resEnv,
+	)
+	if err != nil {
+		p.logger.Errorf("failed to execute most recent historical data query %s, due to %s", path, err)
+		return nil, err
+	}
+
+	values := resEnv.GetResponse().GetValues()
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
+
+// valueBeforeVersion returns value, the most recent value of key written before version, unless it was
+// deleted by the end of the block preceding the block of version. A value written earlier in the same
+// block is returned as is, as a delete within the block leaves no proof in the state of any block.
+func valueBeforeVersion(p Provenance, l Ledger, dbName, key string, value *types.ValueWithMetadata, version *types.Version) (*types.ValueWithMetadata, error) {
+	if value == nil || value.GetMetadata().GetVersion().GetBlockNum() == version.GetBlockNum() {
+		return value, nil
+	}
+	return valueAsOfBlock(p, l, dbName, key, value, version.GetBlockNum()-1)
+}
+
+// valueAsOfBlock returns value, the most recent value of key written at or before block blockNum, unless it was
+// deleted at or before the block. Only a value found in the deleted values history is looked up in the state of
+// the block, as the history tells the version a deleted value was written at, but not when it was deleted.
+func valueAsOfBlock(p Provenance, l Ledger, dbName, key string, value *types.ValueWithMetadata, blockNum uint64) (*types.ValueWithMetadata, error) {
+	if value == nil {
+		return nil, nil
+	}
+	deletedValues, err := p.GetDeletedValues(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get deleted values of key '%s' in database '%s'", key, dbName)
+	}
+	for _, deleted := range deletedValues {
+		if !proto.Equal(deleted.GetMetadata().GetVersion(), value.GetMetadata().GetVersion()) {
+			continue
+		}
+		_, err = l.ProveDeleted(dbName, key, blockNum)
+		if err == nil {
+			return nil, nil
+		}
+		// the server has no proof of the deletion at the block, the value was deleted later
+		if isNotFound(err) {
+			return value, nil
+		}
+		return nil, errors.WithMessagef(err, "failed to check if key '%s' in database '%s' was deleted at block %d", key, dbName, blockNum)
+	}
+	return value, nil
+}
+
+type snapshot struct {
+	blockNum   uint64
+	provenance Provenance
+	ledger     Ledger
+	mutex      sync.Mutex
+	values     map[string]map[string]*types.ValueWithMetadata
+}
+
+func newSnapshot(p Provenance, l Ledger, blockNum uint64) (*snapshot, error) {
+	// a snapshot of a block beyond the tip would change as blocks are committed
+	if _, err := l.GetBlockHeader(blockNum); err != nil {
+		return nil, errors.WithMessagef(err, "failed to take a snapshot at block %d", blockNum)
+	}
+	return &snapshot{
+		blockNum:   blockNum,
+		provenance: p,
+		ledger:     l,
+		values:     make(map[string]map[string]*types.ValueWithMetadata),
+	}, nil
+}
+
+func (s *snapshot) BlockNum() uint64 {
+	return s.blockNum
+}
+
+func (s *snapshot) Get(dbName, key string) (*types.ValueWithMetadata, error) {
+	s.mutex.Lock()
+	value, ok := s.values[dbName][key]
+	s.mutex.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	value, err := s.provenance.GetAsOfBlock(dbName, key, s.blockNum)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok = s.values[dbName]; !ok {
+		s.values[dbName] = make(map[string]*types.ValueWithMetadata)
+	}
+	s.values[dbName][key] = value
+	return value, nil
+}
+
+func (s *snapshot) GetWithProof(dbName, key string) (*types.ValueWithMetadata, *StateProof, error) {
+	value, err := s.Get(dbName, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value != nil {
+		proof, err := s.ledger.ProveValue(dbName, key, value.GetValue(), s.blockNum)
+		if err != nil {
+			return nil, nil, err
+		}
+		return value, proof, nil
+	}
+
+	// the key was deleted, or not written up to the block
+	proof, err := s.ledger.ProveDeleted(dbName, key, s.blockNum)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	return nil, proof, nil
+}
@@ -0,0 +1,205 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// asOfProvenance answers as of block queries from the history of a single key, and counts them
+type asOfProvenance struct {
+	*historyProvenance
+	ledger  Ledger
+	queries int
+}
+
+func (p *asOfProvenance) GetAsOfBlock(dbName, key string, blockNum uint64) (*types.ValueWithMetadata, error) {
+	p.queries++
+	values, _ := p.GetHistoricalData(dbName, key)
+	sortValuesByVersion(values)
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].GetMetadata().GetVersion().GetBlockNum() <= blockNum {
+			return valueAsOfBlock(p, p.ledger, dbName, key, values[i], blockNum)
+		}
+	}
+	return nil, nil
+}
+
+// deletedKeyLedger proves the values of keys, except of the deleted ones, which are deleted at block deletedAt
+type deletedKeyLedger struct {
+	Ledger
+	tip       uint64
+	deleted   map[string]bool
+	deletedAt uint64
+}
+
+func (l *deletedKeyLedger) GetBlockHeader(blockNum uint64) (*types.BlockHeader, error) {
+	if blockNum > l.tip {
+		return nil, blockNotFound(blockNum)
+	}
+	return &types.BlockHeader{BaseHeader: &types.BlockHeaderBase{Number: blockNum}}, nil
+}
+
+func (l *deletedKeyLedger) ProveValue(dbName, key string, value []byte, blockNum uint64) (*StateProof, error) {
+	if l.deleted[key] && blockNum >= l.deletedAt {
+		return nil, errors.Errorf("value of key '%s' in database '%s' is not part of the state at block %d", key, dbName, blockNum)
+	}
+	return &StateProof{DBName: dbName, Key: key, Value: value}, nil
+}
+
+func (l *deletedKeyLedger) ProveDeleted(dbName, key string, blockNum uint64) (*StateProof, error) {
+	if !l.deleted[key] || blockNum < l.deletedAt {
+		return nil, errors.WithMessagef(&ErrorServerResponse{
+			StatusCode: http.StatusNotFound,
+			Status:     "404 Not Found",
+			Message:    fmt.Sprintf("no proof for block %d, db %s, key %s, isDeleted true found", blockNum, dbName, key),
+		}, "failed to get state proof of key '%s' in database '%s' at block %d", key, dbName, blockNum)
+	}
+	return &StateProof{DBName: dbName, Key: key, Deleted: true}, nil
+}
+
+func TestSnapshot(t *testing.T) {
+	l := &deletedKeyLedger{tip: 10}
+	p := &asOfProvenance{historyProvenance: &historyProvenance{}, ledger: l}
+	p.write("a", 2, 0)
+	p.write("b", 5, 1)
+	p.write("c", 8, 0)
+
+	_, err := newSnapshot(p, l, 11)
+	require.EqualError(t, err, "failed to take a snapshot at block 11: error handling request, server returned: status: 404 Not Found, message: error while processing 'GET /ledger/block/11' because block not found: 11")
+
+	s, err := newSnapshot(p, l, 6)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), s.BlockNum())
+
+	value, err := s.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(value.GetValue()))
+
+	// values are read once per snapshot
+	value, proof, err := s.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(value.GetValue()))
+	require.Equal(t, []byte("b"), proof.Value)
+	require.False(t, proof.Deleted)
+	require.Equal(t, 1, p.queries)
+
+	s, err = newSnapshot(p, l, 1)
+	require.NoError(t, err)
+	value, proof, err = s.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	require.Nil(t, proof)
+
+	// the key is deleted at block 9, so it has no value as of block 9, along with a proof of the deletion
+	p.delete()
+	l.deleted = map[string]bool{"key1": true}
+	l.deletedAt = 9
+	s, err = newSnapshot(p, l, 9)
+	require.NoError(t, err)
+	value, err = s.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	value, proof, err = s.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	require.True(t, proof.Deleted)
+
+	// the deleted value is returned as of the blocks before the deletion
+	s, err = newSnapshot(p, l, 8)
+	require.NoError(t, err)
+	value, proof, err = s.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, "c", string(value.GetValue()))
+	require.False(t, proof.Deleted)
+
+	// the deletion can't be checked
+	l.tip = 12
+	l.deletedAt = 0
+	l.deleted = nil
+	p.ledger = &failingProofLedger{deletedKeyLedger: l}
+	s, err = newSnapshot(p, l, 12)
+	require.NoError(t, err)
+	_, err = s.Get("bdb", "key1")
+	require.EqualError(t, err, "failed to check if key 'key1' in database 'bdb' was deleted at block 12: connection refused")
+}
+
+type failingProofLedger struct {
+	*deletedKeyLedger
+}
+
+func (l *failingProofLedger) ProveDeleted(dbName, key string, blockNum uint64) (*StateProof, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestGetAsOfBlockAndBeforeTx(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	receipt1 := putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	block1 := receipt1.GetHeader().GetBaseHeader().GetNumber()
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("bdb", "key1", []byte("value2"), nil))
+	txID2, receipt2, err := tx.Commit(true)
+	require.NoError(t, err)
+	block2 := receipt2.GetHeader().GetBaseHeader().GetNumber()
+	tx, err = aliceSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Delete("bdb", "key1"))
+	_, receipt3, err := tx.Commit(true)
+	require.NoError(t, err)
+	block3 := receipt3.GetHeader().GetBaseHeader().GetNumber()
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+
+	value, err := p.GetAsOfBlock("bdb", "key1", block1-1)
+	require.NoError(t, err)
+	require.Nil(t, value)
+	value, err = p.GetAsOfBlock("bdb", "key1", block1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), value.GetValue())
+	value, err = p.GetAsOfBlock("bdb", "key1", block2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value2"), value.GetValue())
+	value, err = p.GetAsOfBlock("bdb", "key1", block3)
+	require.NoError(t, err)
+	require.Nil(t, value)
+	deleted, err := p.GetDeletedValues("bdb", "key1")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, []byte("value2"), deleted[0].GetValue())
+
+	value, err = p.GetBeforeTx("bdb", "key1", txID2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value1"), value.GetValue())
+
+	snapshot, err := p.SnapshotAt(block2)
+	require.NoError(t, err)
+	value, proof, err := snapshot.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value2"), value.GetValue())
+	require.NoError(t, proof.Verify())
+
+	snapshot, err = p.SnapshotAt(block3)
+	require.NoError(t, err)
+	value, proof, err = snapshot.GetWithProof("bdb", "key1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+	require.True(t, proof.Deleted)
+	require.Equal(t, []byte("value2"), proof.Value)
+
+	_, err = p.SnapshotAt(block3 + 10)
+	require.Error(t, err)
+}
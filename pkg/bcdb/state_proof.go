@@ -0,0 +1,109 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// StateProof proves that a key held a value, or that the value was deleted, in the state of a block.
+// It is self contained and can be serialized as JSON, to be verified offline by a third party, which
+// should also establish trust in BlockHeader, e.g. by VerifyLedgerPath or a LedgerTrustStore.
+type StateProof struct {
+	DBName string `json:"db_name"`
+	Key    string `json:"key"`
+	// Value the value of the key, or the value that was deleted
+	Value []byte `json:"value"`
+	// Deleted true if the proof is of the deletion of Value
+	Deleted bool `json:"deleted"`
+	// BlockHeader header of the block whose state the proof refers to
+	BlockHeader *types.BlockHeader `json:"block_header"`
+	// Path from the trie node holding the value hash to the state trie root, as returned by GetDataProof
+	Path []*types.MPTrieProofElement `json:"path"`
+}
+
+// BlockNum returns the number of the block whose state the proof refers to
+func (p *StateProof) BlockNum() uint64 {
+	return p.BlockHeader.GetBaseHeader().GetNumber()
+}
+
+// Verify checks the proof against the state trie root of the block header, no server connection is needed
+func (p *StateProof) Verify() error {
+	valueHash, err := CalculateValueHash(p.DBName, p.Key, p.Value)
+	if err != nil {
+		return err
+	}
+	ok, err := state.NewProof(p.Path).Verify(valueHash, p.BlockHeader.GetStateMerkelTreeRootHash(), p.Deleted)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to verify state proof of key '%s' in database '%s' at block %d", p.Key, p.DBName, p.BlockNum())
+	}
+	if !ok {
+		if p.Deleted {
+			return errors.Errorf("deletion of key '%s' in database '%s' is not part of the state at block %d", p.Key, p.DBName, p.BlockNum())
+		}
+		return errors.Errorf("value of key '%s' in database '%s' is not part of the state at block %d", p.Key, p.DBName, p.BlockNum())
+	}
+	return nil
+}
+
+func (l *ledger) ProveValue(dbName, key string, value []byte, blockNum uint64) (*StateProof, error) {
+	proof, err := l.stateProof(dbName, key, blockNum, false)
+	if err != nil {
+		return nil, err
+	}
+	proof.Value = value
+	if err = proof.Verify(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func (l *ledger) ProveDeleted(dbName, key string, blockNum uint64) (*StateProof, error) {
+	proof, err := l.stateProof(dbName, key, blockNum, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// the trie keeps the hash of the deleted value, so the value is looked up in the key's history,
+	// starting from the most recent value written up to the block
+	p := &provenance{l.commonTxContext}
+	values, err := p.GetHistoricalData(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get history of key '%s' in database '%s'", key, dbName)
+	}
+	sortValuesByVersion(values)
+	for i := len(values) - 1; i >= 0; i-- {
+		v := values[i]
+		if v.GetMetadata().GetVersion().GetBlockNum() > blockNum {
+			continue
+		}
+		proof.Value = v.GetValue()
+		if proof.Verify() == nil {
+			return proof, nil
+		}
+	}
+	return nil, errors.Errorf("deletion of key '%s' in database '%s' is not part of the state at block %d", key, dbName, blockNum)
+}
+
+func (l *ledger) stateProof(dbName, key string, blockNum uint64, isDeleted bool) (*StateProof, error) {
+	header, err := l.GetBlockHeader(blockNum)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get header of block %d", blockNum)
+	}
+	if header == nil {
+		return nil, errors.Errorf("block %d does not exist", blockNum)
+	}
+	trieProof, err := l.GetDataProof(blockNum, dbName, key, isDeleted)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get state proof of key '%s' in database '%s' at block %d", key, dbName, blockNum)
+	}
+	return &StateProof{
+		DBName:      dbName,
+		Key:         key,
+		Deleted:     isDeleted,
+		BlockHeader: header,
+		Path:        trieProof.GetPath(),
+	}, nil
+}
@@ -0,0 +1,65 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func testStateProof(t *testing.T, value []byte, deleted bool) *StateProof {
+	valueHash, err := CalculateValueHash("bdb", "key1", value)
+	require.NoError(t, err)
+	valueNode := [][]byte{[]byte("key path"), valueHash}
+	if deleted {
+		valueNode = append(valueNode, state.KeyDeleteMarkerBytes)
+	}
+	valueNodeHash, err := state.CalcHash(valueNode)
+	require.NoError(t, err)
+	rootNode := [][]byte{[]byte("sibling"), valueNodeHash}
+	rootHash, err := state.CalcHash(rootNode)
+	require.NoError(t, err)
+
+	return &StateProof{
+		DBName:  "bdb",
+		Key:     "key1",
+		Value:   value,
+		Deleted: deleted,
+		BlockHeader: &types.BlockHeader{
+			BaseHeader:              &types.BlockHeaderBase{Number: 5},
+			StateMerkelTreeRootHash: rootHash,
+		},
+		Path: []*types.MPTrieProofElement{{Hashes: valueNode}, {Hashes: rootNode}},
+	}
+}
+
+func TestStateProof_Verify(t *testing.T) {
+	proof := testStateProof(t, []byte("value1"), false)
+	require.NoError(t, proof.Verify())
+	require.Equal(t, uint64(5), proof.BlockNum())
+
+	proofBytes, err := json.Marshal(proof)
+	require.NoError(t, err)
+	readProof := &StateProof{}
+	require.NoError(t, json.Unmarshal(proofBytes, readProof))
+	require.NoError(t, readProof.Verify())
+
+	readProof.Value = []byte("value2")
+	require.EqualError(t, readProof.Verify(), "value of key 'key1' in database 'bdb' is not part of the state at block 5")
+
+	// a value proof is not a deletion proof
+	proof.Deleted = true
+	require.EqualError(t, proof.Verify(), "deletion of key 'key1' in database 'bdb' is not part of the state at block 5")
+}
+
+func TestStateProof_VerifyDeleted(t *testing.T) {
+	proof := testStateProof(t, []byte("value1"), true)
+	require.NoError(t, proof.Verify())
+
+	proof.BlockHeader.StateMerkelTreeRootHash = []byte("tampered")
+	require.EqualError(t, proof.Verify(), "deletion of key 'key1' in database 'bdb' is not part of the state at block 5")
+}
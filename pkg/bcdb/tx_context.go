@@ -177,7 +177,7 @@ func (t *commonTxContext) handleRequest(rawurl string, query, res proto.Message)
 				errMsg = errRes.Error()
 			}
 		}
-		return errors.Errorf("error handling request, server returned: status: %s, message: %s", response.Status, errMsg)
+		return &ErrorServerResponse{StatusCode: response.StatusCode, Status: response.Status, Message: errMsg}
 	}
 
 	err = json.NewDecoder(response.Body).Decode(res)
@@ -215,3 +215,33 @@ type ErrorTxValidation struct {
 func (e *ErrorTxValidation) Error() string {
 	return "transaction txID = " + e.TxID + " is not valid, flag: " + e.Flag + ", reason: " + e.Reason
 }
+
+// Is reports an MVCC invalidation as ErrVersionMismatch, so callers can use errors.Is(err, ErrVersionMismatch)
+func (e *ErrorTxValidation) Is(target error) bool {
+	if target != ErrVersionMismatch {
+		return false
+	}
+	return e.Flag == types.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE.String() ||
+		e.Flag == types.Flag_INVALID_MVCC_CONFLICT_WITHIN_BLOCK.String()
+}
+
+// ErrorServerResponse is returned when the server responds to a request with a status other than OK
+type ErrorServerResponse struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *ErrorServerResponse) Error() string {
+	return "error handling request, server returned: status: " + e.Status + ", message: " + e.Message
+}
+
+// isNotFound tells if err is the server's not found response, e.g. to a query of a block beyond the ledger tip
+func isNotFound(err error) bool {
+	var responseErr *ErrorServerResponse
+	return errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound
+}
+
+// ErrVersionMismatch is returned when a key version asserted by a conditional
+// operation, i.e. PutIfVersion, PutIfAbsent or DeleteIfVersion, differs from the committed one
+var ErrVersionMismatch = errors.New("version mismatch, the key was changed since the expected version")
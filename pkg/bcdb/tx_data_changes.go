@@ -0,0 +1,138 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// TxReadValue a key read by a data tx, along with the value the tx read
+type TxReadValue struct {
+	DBName string
+	Key    string
+	// Version recorded in the read set, nil if the key did not exist when it was read
+	Version *types.Version
+	// Value the value of the key at Version, nil if Version is nil
+	Value *types.ValueWithMetadata
+}
+
+// TxWriteChange a key written or deleted by a data tx, along with the value before the tx
+type TxWriteChange struct {
+	DBName  string
+	Key     string
+	Deleted bool
+	// Before the value of the key before the tx, nil if the key did not exist. If the tx read the key the read
+	// value is used, otherwise the most recent value written before the tx, nil if it was deleted before the
+	// block of the tx. A delete by an earlier tx of the same block is not detected.
+	Before *types.ValueWithMetadata
+	// After and ACL the value and ACL written by the tx, nil if the key was deleted
+	After []byte
+	ACL   *types.AccessControl
+	// ACLChange the change from the ACL of Before to ACL, nil if the ACL did not change or the key was deleted
+	ACLChange *ACLChange
+}
+
+// TxDataChanges the values a committed data tx read and the changes it made, the changes
+// took effect only if Flag is valid
+type TxDataChanges struct {
+	TxID     string
+	BlockNum uint64
+	TxIndex  uint64
+	Flag     types.Flag
+	Reads    []*TxReadValue
+	Writes   []*TxWriteChange
+}
+
+func (p *provenance) GetTxDataChanges(env *types.DataTxEnvelope) (*TxDataChanges, error) {
+	return txDataChanges(p, &ledger{p.commonTxContext}, env)
+}
+
+func (p *provenance) GetTxDataChangesByID(txID string, envelopes func(txID string) (*types.DataTxEnvelope, error)) (*TxDataChanges, error) {
+	env, err := envelopes(txID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get envelope of tx %s", txID)
+	}
+	if env.GetPayload().GetTxId() != txID {
+		return nil, errors.Errorf("envelope of tx %s does not match tx %s", env.GetPayload().GetTxId(), txID)
+	}
+	return p.GetTxDataChanges(env)
+}
+
+func txDataChanges(p Provenance, l Ledger, env *types.DataTxEnvelope) (*TxDataChanges, error) {
+	txID := env.GetPayload().GetTxId()
+	if txID == "" {
+		return nil, errors.New("transaction ID in the transaction envelope is empty")
+	}
+	receipt, err := l.GetTransactionReceipt(txID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+	}
+
+	changes := &TxDataChanges{
+		TxID:     txID,
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxIndex:  receipt.GetTxIndex(),
+	}
+	if valInfo := receipt.GetHeader().GetValidationInfo(); receipt.GetTxIndex() < uint64(len(valInfo)) {
+		changes.Flag = valInfo[receipt.GetTxIndex()].GetFlag()
+	}
+
+	for _, ops := range env.GetPayload().GetDbOperations() {
+		dbName := ops.GetDbName()
+		readValues := map[string]*types.ValueWithMetadata{}
+		for _, r := range ops.GetDataReads() {
+			read := &TxReadValue{
+				DBName:  dbName,
+				Key:     r.GetKey(),
+				Version: r.GetVersion(),
+			}
+			if r.GetVersion() != nil {
+				if read.Value, err = historicalValueAt(p, dbName, r.GetKey(), r.GetVersion()); err != nil {
+					return nil, err
+				}
+			}
+			readValues[r.GetKey()] = read.Value
+			changes.Reads = append(changes.Reads, read)
+		}
+
+		for _, w := range ops.GetDataWrites() {
+			before, err := valueBeforeTx(p, dbName, w.GetKey(), changes, readValues)
+			if err != nil {
+				return nil, err
+			}
+			changes.Writes = append(changes.Writes, &TxWriteChange{
+				DBName:    dbName,
+				Key:       w.GetKey(),
+				Before:    before,
+				After:     w.GetValue(),
+				ACL:       w.GetAcl(),
+				ACLChange: diffACL(before.GetMetadata().GetAccessControl(), w.GetAcl()),
+			})
+		}
+		for _, d := range ops.GetDataDeletes() {
+			before, err := valueBeforeTx(p, dbName, d.GetKey(), changes, readValues)
+			if err != nil {
+				return nil, err
+			}
+			changes.Writes = append(changes.Writes, &TxWriteChange{
+				DBName:  dbName,
+				Key:     d.GetKey(),
+				Deleted: true,
+				Before:  before,
+			})
+		}
+	}
+	return changes, nil
+}
+
+func valueBeforeTx(p Provenance, dbName, key string, changes *TxDataChanges, readValues map[string]*types.ValueWithMetadata) (*types.ValueWithMetadata, error) {
+	if value, ok := readValues[key]; ok {
+		return value, nil
+	}
+	value, err := p.GetBeforeVersion(dbName, key, &types.Version{BlockNum: changes.BlockNum, TxNum: changes.TxIndex})
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get key '%s' in database '%s' before tx %s", key, dbName, changes.TxID)
+	}
+	return value, nil
+}
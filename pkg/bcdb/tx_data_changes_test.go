@@ -0,0 +1,177 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"testing"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// keysProvenance serves the histories of several keys, the txs are named by the blocks they are committed in.
+// The deletes are proven by ledger.
+type keysProvenance struct {
+	Provenance
+	keys   map[string]*historyProvenance
+	ledger Ledger
+}
+
+func (p *keysProvenance) GetHistoricalDataAt(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	return p.keys[key].GetHistoricalDataAt(dbName, key, version)
+}
+
+func (p *keysProvenance) GetDeletedValues(dbName, key string) ([]*types.ValueWithMetadata, error) {
+	return p.keys[key].GetDeletedValues(dbName, key)
+}
+
+func (p *keysProvenance) GetBeforeVersion(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	values, _ := p.keys[key].GetHistoricalData(dbName, key)
+	sortValuesByVersion(values)
+	for i := len(values) - 1; i >= 0; i-- {
+		if VersionLess(values[i].GetMetadata().GetVersion(), version) {
+			return valueBeforeVersion(p, p.ledger, dbName, key, values[i], version)
+		}
+	}
+	return nil, nil
+}
+
+func TestTxDataChanges(t *testing.T) {
+	p := &keysProvenance{
+		keys:   map[string]*historyProvenance{},
+		ledger: &deletedKeyLedger{tip: 6, deleted: map[string]bool{"key5": true}, deletedAt: 4},
+	}
+	for _, key := range []string{"key1", "key2", "key3", "key4", "key5", "key6"} {
+		p.keys[key] = &historyProvenance{}
+	}
+	p.keys["key1"].write("a1", 2, 0)
+	p.keys["key1"].write("b1", 3, 0)
+	p.keys["key2"].write("a2", 4, 0)
+	p.keys["key2"].values[0].Metadata.AccessControl = &types.AccessControl{ReadWriteUsers: map[string]bool{"alice": true}}
+	p.keys["key3"].write("a3", 5, 0)
+	// key5 was deleted at block 4, before the tx, and key6 after the tx
+	p.keys["key5"].write("a5", 2, 0)
+	p.keys["key5"].delete()
+	p.keys["key6"].write("a6", 3, 0)
+	p.keys["key6"].delete()
+
+	env := &types.DataTxEnvelope{
+		Payload: &types.DataTx{
+			TxId: "tx6",
+			DbOperations: []*types.DBOperation{
+				{
+					DbName: "bdb",
+					DataReads: []*types.DataRead{
+						{Key: "key1", Version: &types.Version{BlockNum: 2}},
+						{Key: "key4"},
+					},
+					DataWrites: []*types.DataWrite{
+						{Key: "key1", Value: []byte("c1")},
+						{Key: "key2", Value: []byte("b2"), Acl: &types.AccessControl{ReadWriteUsers: map[string]bool{"bob": true}}},
+						{Key: "key4", Value: []byte("a4")},
+						{Key: "key5", Value: []byte("b5")},
+						{Key: "key6", Value: []byte("b6")},
+					},
+					DataDeletes: []*types.DataDelete{{Key: "key3"}},
+				},
+			},
+		},
+	}
+
+	l := &receiptLedger{}
+	changes, err := txDataChanges(p, l, env)
+	require.NoError(t, err)
+	// the position of the tx is taken from a single receipt for all the keys
+	require.Equal(t, 1, l.receipts)
+	require.Equal(t, "tx6", changes.TxID)
+	require.Equal(t, uint64(6), changes.BlockNum)
+
+	require.Len(t, changes.Reads, 2)
+	require.Equal(t, "a1", string(changes.Reads[0].Value.GetValue()))
+	require.Equal(t, uint64(2), changes.Reads[0].Version.GetBlockNum())
+	require.Equal(t, "key4", changes.Reads[1].Key)
+	require.Nil(t, changes.Reads[1].Version)
+	require.Nil(t, changes.Reads[1].Value)
+
+	require.Len(t, changes.Writes, 6)
+	// the value read by the tx, not the most recent one before it
+	require.Equal(t, "key1", changes.Writes[0].Key)
+	require.Equal(t, "a1", string(changes.Writes[0].Before.GetValue()))
+	require.Equal(t, []byte("c1"), changes.Writes[0].After)
+	require.Nil(t, changes.Writes[0].ACLChange)
+
+	require.Equal(t, "a2", string(changes.Writes[1].Before.GetValue()))
+	require.Equal(t, &ACLChange{
+		ReadWriteUsersAdded:   []string{"bob"},
+		ReadWriteUsersRemoved: []string{"alice"},
+	}, changes.Writes[1].ACLChange)
+
+	require.Nil(t, changes.Writes[2].Before)
+
+	// the most recent value before the tx was deleted before its block
+	require.Equal(t, "key5", changes.Writes[3].Key)
+	require.Nil(t, changes.Writes[3].Before)
+	require.Equal(t, "a6", string(changes.Writes[4].Before.GetValue()))
+
+	require.Equal(t, "key3", changes.Writes[5].Key)
+	require.True(t, changes.Writes[5].Deleted)
+	require.Equal(t, "a3", string(changes.Writes[5].Before.GetValue()))
+	require.Nil(t, changes.Writes[5].After)
+
+	env.Payload.DbOperations[0].DataReads[0].Version = &types.Version{BlockNum: 7}
+	_, err = txDataChanges(p, &receiptLedger{}, env)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key 'key1' in database 'bdb' has no value at version")
+}
+
+func TestGetTxDataChangesByID_EnvelopeMismatch(t *testing.T) {
+	p := &provenance{}
+	envelopes := func(txID string) (*types.DataTxEnvelope, error) {
+		if txID == "tx2" {
+			return nil, errors.New("not kept")
+		}
+		return &types.DataTxEnvelope{Payload: &types.DataTx{TxId: "tx3"}}, nil
+	}
+
+	_, err := p.GetTxDataChangesByID("tx1", envelopes)
+	require.EqualError(t, err, "envelope of tx tx3 does not match tx tx1")
+	_, err = p.GetTxDataChangesByID("tx2", envelopes)
+	require.EqualError(t, err, "failed to get envelope of tx tx2: not kept")
+}
+
+func TestGetTxDataChanges(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	putKeySync(t, "bdb", "key2", "value2", "alice", aliceSession)
+
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	_, _, err = tx.Get("bdb", "key1")
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("bdb", "key2", []byte("value3"), nil))
+	txID, _, err := tx.Commit(true)
+	require.NoError(t, err)
+	env, err := tx.CommittedTxEnvelope()
+	require.NoError(t, err)
+
+	p, err := aliceSession.Provenance()
+	require.NoError(t, err)
+	changes, err := p.GetTxDataChangesByID(txID, func(string) (*types.DataTxEnvelope, error) {
+		return env.(*types.DataTxEnvelope), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, types.Flag_VALID, changes.Flag)
+	require.Len(t, changes.Reads, 1)
+	require.Equal(t, []byte("value1"), changes.Reads[0].Value.GetValue())
+	require.Len(t, changes.Writes, 1)
+	require.Equal(t, []byte("value2"), changes.Writes[0].Before.GetValue())
+	require.Equal(t, []byte("value3"), changes.Writes[0].After)
+	require.NotNil(t, changes.Writes[0].ACLChange)
+}
@@ -0,0 +1,198 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-server/pkg/logger"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultWatchPollInterval default interval between checks of a watched key
+const DefaultWatchPollInterval = time.Second
+
+// WatchConfig configuration of a key watch
+type WatchConfig struct {
+	// PollInterval between checks of the key, DefaultWatchPollInterval if zero
+	PollInterval time.Duration
+	// BlockTriggered if true, the key is checked after every committed block, as delivered by a block
+	// listener starting from the block of the last seen version, instead of every PollInterval
+	BlockTriggered bool
+	// BufferSize capacity of the changes channel
+	BufferSize int
+}
+
+// KeyChange a change of a watched key
+type KeyChange struct {
+	// Value the new value of the key, or the last value of the key if it was deleted
+	Value *types.ValueWithMetadata
+	// Deleted true if the key was deleted
+	Deleted bool
+}
+
+type keyWatch struct {
+	dbName      string
+	key         string
+	provenance  Provenance
+	ledger      Ledger
+	config      WatchConfig
+	lastVersion *types.Version
+	lastValue   *types.ValueWithMetadata
+	deleted     bool
+	changes     chan *KeyChange
+	logger      *logger.SugarLogger
+}
+
+// Watch delivers the changes of key committed after fromVersion, in version order, until ctx is done.
+// If fromVersion is nil, all the historical values of the key, and their deletes, are delivered first. The
+// values and the deleted values are followed through the key's provenance, so no version is skipped, and a
+// delete followed by a new value between two checks of the key is delivered before the new value.
+func (d *dbSession) Watch(ctx context.Context, dbName, key string, fromVersion *types.Version, config *WatchConfig) (<-chan *KeyChange, error) {
+	p, err := d.Provenance()
+	if err != nil {
+		return nil, err
+	}
+	var l Ledger
+	if config != nil && config.BlockTriggered {
+		if l, err = d.Ledger(); err != nil {
+			return nil, err
+		}
+	}
+	return watchKey(ctx, dbName, key, fromVersion, config, p, l, d.logger)
+}
+
+func watchKey(ctx context.Context, dbName, key string, fromVersion *types.Version, config *WatchConfig,
+	p Provenance, l Ledger, logger *logger.SugarLogger) (<-chan *KeyChange, error) {
+	w := &keyWatch{
+		dbName:      dbName,
+		key:         key,
+		provenance:  p,
+		ledger:      l,
+		lastVersion: fromVersion,
+		logger:      logger,
+	}
+	if config != nil {
+		w.config = *config
+	}
+	if w.config.PollInterval == 0 {
+		w.config.PollInterval = DefaultWatchPollInterval
+	}
+	w.changes = make(chan *KeyChange, w.config.BufferSize)
+
+	if fromVersion != nil {
+		value, err := p.GetHistoricalDataAt(dbName, key, fromVersion)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, errors.Errorf("version %s of key '%s' in database '%s' does not exist", fromVersion, key, dbName)
+		}
+		w.lastValue = value
+	}
+
+	// the first check is done before returning, so errors such as a missing permission are reported to the caller
+	changes, err := w.check()
+	if err != nil {
+		return nil, err
+	}
+
+	go w.run(ctx, changes)
+	return w.changes, nil
+}
+
+func (w *keyWatch) run(ctx context.Context, changes []*KeyChange) {
+	defer close(w.changes)
+
+	var blocks <-chan *BlockEvent
+	if w.ledger != nil {
+		listener := newBlockListener(ctx, w.ledger, &BlockListenerConfig{
+			StartBlock:   w.lastVersion.GetBlockNum() + 1,
+			PollInterval: w.config.PollInterval,
+		}, w.logger)
+		defer listener.Stop()
+		blocks = listener.Events()
+	}
+
+	for {
+		for _, change := range changes {
+			select {
+			case <-ctx.Done():
+				return
+			case w.changes <- change:
+			}
+		}
+
+		if blocks != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-blocks:
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.config.PollInterval):
+			}
+		}
+
+		var err error
+		if changes, err = w.check(); err != nil {
+			w.logger.Errorf("failed to check key %s in database %s for changes, due to %s", w.key, w.dbName, err)
+		}
+	}
+}
+
+// check returns the changes of the key since the last check. The deleted values are merged with the
+// history by version, a deleted value is followed by its delete, so every delete is delivered once
+func (w *keyWatch) check() ([]*KeyChange, error) {
+	var values []*types.ValueWithMetadata
+	var err error
+	if w.lastVersion == nil {
+		values, err = w.provenance.GetHistoricalData(w.dbName, w.key)
+	} else {
+		values, err = w.provenance.GetNextHistoricalData(w.dbName, w.key, w.lastVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	deletedValues, err := w.provenance.GetDeletedValues(w.dbName, w.key)
+	if err != nil {
+		return nil, err
+	}
+	sortValuesByVersion(values)
+
+	var changes []*KeyChange
+	// the last delivered value may have been deleted since
+	if w.lastValue != nil && !w.deleted && containsVersion(deletedValues, w.lastVersion) {
+		changes = append(changes, &KeyChange{Value: w.lastValue, Deleted: true})
+		w.deleted = true
+	}
+	for _, v := range values {
+		version := v.GetMetadata().GetVersion()
+		if w.lastVersion != nil && !VersionLess(w.lastVersion, version) {
+			continue
+		}
+		changes = append(changes, &KeyChange{Value: v})
+		w.lastVersion = version
+		w.lastValue = v
+		w.deleted = containsVersion(deletedValues, version)
+		if w.deleted {
+			changes = append(changes, &KeyChange{Value: v, Deleted: true})
+		}
+	}
+	return changes, nil
+}
+
+func containsVersion(values []*types.ValueWithMetadata, version *types.Version) bool {
+	for _, v := range values {
+		if proto.Equal(v.GetMetadata().GetVersion(), version) {
+			return true
+		}
+	}
+	return false
+}
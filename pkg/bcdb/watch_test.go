@@ -0,0 +1,222 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package bcdb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger-labs/orion-server/pkg/server/testutils"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// historyProvenance serves the history of a single key
+type historyProvenance struct {
+	Provenance
+	mutex  sync.Mutex
+	values []*types.ValueWithMetadata
+	// deletedValues the deleted values, as the server records them
+	deletedValues []*types.ValueWithMetadata
+}
+
+func (p *historyProvenance) GetHistoricalData(dbName, key string) ([]*types.ValueWithMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*types.ValueWithMetadata{}, p.values...), nil
+}
+
+func (p *historyProvenance) GetDeletedValues(dbName, key string) ([]*types.ValueWithMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*types.ValueWithMetadata{}, p.deletedValues...), nil
+}
+
+func (p *historyProvenance) GetHistoricalDataAt(dbName, key string, version *types.Version) (*types.ValueWithMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, v := range p.values {
+		if !VersionLess(v.GetMetadata().GetVersion(), version) && !VersionLess(version, v.GetMetadata().GetVersion()) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *historyProvenance) GetNextHistoricalData(dbName, key string, version *types.Version) ([]*types.ValueWithMetadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var next []*types.ValueWithMetadata
+	for _, v := range p.values {
+		if VersionLess(version, v.GetMetadata().GetVersion()) {
+			next = append(next, v)
+		}
+	}
+	return next, nil
+}
+
+// write adds a value, values are added out of order as the server may return them so
+func (p *historyProvenance) write(value string, blockNum, txNum uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.values = append([]*types.ValueWithMetadata{historyValue(value, blockNum, txNum)}, p.values...)
+}
+
+// delete deletes the value of the last version
+func (p *historyProvenance) delete() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	last := p.values[0]
+	for _, v := range p.values {
+		if VersionLess(last.GetMetadata().GetVersion(), v.GetMetadata().GetVersion()) {
+			last = v
+		}
+	}
+	p.deletedValues = append(p.deletedValues, last)
+}
+
+func historyValue(value string, blockNum, txNum uint64) *types.ValueWithMetadata {
+	return &types.ValueWithMetadata{
+		Value: []byte(value),
+		Metadata: &types.Metadata{
+			Version: &types.Version{BlockNum: blockNum, TxNum: txNum},
+		},
+	}
+}
+
+func requireKeyChange(t *testing.T, changes <-chan *KeyChange, value string, blockNum, txNum uint64, deleted bool) {
+	select {
+	case change := <-changes:
+		require.Equal(t, value, string(change.Value.GetValue()))
+		require.Equal(t, &types.Version{BlockNum: blockNum, TxNum: txNum}, change.Value.GetMetadata().GetVersion())
+		require.Equal(t, deleted, change.Deleted)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no change of the key was delivered")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	p := &historyProvenance{}
+	p.write("a", 2, 0)
+	p.write("b", 3, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := watchKey(ctx, "bdb", "key1", nil, &WatchConfig{PollInterval: 10 * time.Millisecond}, p, nil, createTestLogger(t))
+	require.NoError(t, err)
+	requireKeyChange(t, changes, "a", 2, 0, false)
+	requireKeyChange(t, changes, "b", 3, 1, false)
+
+	// values committed between checks are delivered in version order
+	p.write("d", 5, 0)
+	p.write("c", 4, 2)
+	requireKeyChange(t, changes, "c", 4, 2, false)
+	requireKeyChange(t, changes, "d", 5, 0, false)
+
+	p.delete()
+	requireKeyChange(t, changes, "d", 5, 0, true)
+	p.write("e", 7, 0)
+	requireKeyChange(t, changes, "e", 7, 0, false)
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestWatch_Deletes(t *testing.T) {
+	p := &historyProvenance{}
+	p.write("a", 2, 0)
+	p.delete()
+	p.write("b", 3, 0)
+
+	// past deletes are delivered along with the history
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := watchKey(ctx, "bdb", "key1", nil, &WatchConfig{PollInterval: 10 * time.Millisecond}, p, nil, createTestLogger(t))
+	require.NoError(t, err)
+	requireKeyChange(t, changes, "a", 2, 0, false)
+	requireKeyChange(t, changes, "a", 2, 0, true)
+	requireKeyChange(t, changes, "b", 3, 0, false)
+
+	// deletes followed by new values between two checks are not dropped
+	p.mutex.Lock()
+	p.deletedValues = append(p.deletedValues, p.values[0], historyValue("c", 4, 0))
+	p.values = append([]*types.ValueWithMetadata{historyValue("d", 5, 0), historyValue("c", 4, 0)}, p.values...)
+	p.mutex.Unlock()
+	requireKeyChange(t, changes, "b", 3, 0, true)
+	requireKeyChange(t, changes, "c", 4, 0, false)
+	requireKeyChange(t, changes, "c", 4, 0, true)
+	requireKeyChange(t, changes, "d", 5, 0, false)
+
+	// nothing is delivered twice
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, changes)
+}
+
+func TestWatch_FromVersion(t *testing.T) {
+	p := &historyProvenance{}
+	p.write("a", 2, 0)
+	p.write("b", 3, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := watchKey(ctx, "bdb", "key1", &types.Version{BlockNum: 2}, nil, p, nil, createTestLogger(t))
+	require.NoError(t, err)
+	requireKeyChange(t, changes, "b", 3, 1, false)
+
+	_, err = watchKey(ctx, "bdb", "key1", &types.Version{BlockNum: 2, TxNum: 1}, nil, p, nil, createTestLogger(t))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "of key 'key1' in database 'bdb' does not exist")
+}
+
+func TestWatch_BlockTriggered(t *testing.T) {
+	p := &historyProvenance{}
+	p.write("a", 2, 0)
+	ledger, headers := testTipLedger(t, 5)
+	ledger.commit(headers[:2])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := watchKey(ctx, "bdb", "key1", &types.Version{BlockNum: 2}, &WatchConfig{
+		PollInterval:   10 * time.Millisecond,
+		BlockTriggered: true,
+	}, p, ledger, createTestLogger(t))
+	require.NoError(t, err)
+
+	// the key is checked only when a block is committed
+	p.write("b", 3, 0)
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, changes)
+	ledger.commit(headers[:3])
+	requireKeyChange(t, changes, "b", 3, 0, false)
+}
+
+func TestWatch_Session(t *testing.T) {
+	clientCryptoDir := testutils.GenerateTestClientCrypto(t, []string{"admin", "alice", "server"})
+	testServer, _, _, err := SetupTestServer(t, clientCryptoDir)
+	defer testServer.Stop()
+	require.NoError(t, err)
+	_, _, aliceSession := startServerConnectOpenAdminCreateUserAndUserSession(t, testServer, clientCryptoDir, "alice")
+
+	receipt := putKeySync(t, "bdb", "key1", "value1", "alice", aliceSession)
+	version := &types.Version{
+		BlockNum: receipt.GetHeader().GetBaseHeader().GetNumber(),
+		TxNum:    receipt.GetTxIndex(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := aliceSession.Watch(ctx, "bdb", "key1", version, &WatchConfig{PollInterval: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	receipt = putKeySync(t, "bdb", "key1", "value2", "alice", aliceSession)
+	requireKeyChange(t, changes, "value2", receipt.GetHeader().GetBaseHeader().GetNumber(), receipt.GetTxIndex(), false)
+
+	tx, err := aliceSession.DataTx()
+	require.NoError(t, err)
+	require.NoError(t, tx.Delete("bdb", "key1"))
+	_, _, err = tx.Commit(true)
+	require.NoError(t, err)
+	requireKeyChange(t, changes, "value2", receipt.GetHeader().GetBaseHeader().GetNumber(), receipt.GetTxIndex(), true)
+}
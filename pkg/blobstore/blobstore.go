@@ -0,0 +1,165 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package blobstore keeps bulk payloads outside of the ledger, and anchors only their
+// descriptors, i.e. hash, size, media type and location, in BCDB keys.
+package blobstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// BlobStore stores blobs outside of the ledger
+type BlobStore interface {
+	// Put stores the blob read from r and returns its location. Each Put returns a new location, so
+	// a blob can be deleted without affecting the descriptors of other blobs of the same content.
+	Put(r io.Reader) (string, error)
+	// Get opens the blob stored at location
+	Get(location string) (io.ReadCloser, error)
+	// Delete removes the blob stored at location
+	Delete(location string) error
+}
+
+// Descriptor describes a blob, it is stored in a BCDB key in place of the blob itself
+type Descriptor struct {
+	// Hash SHA256 hash of the blob
+	Hash []byte `json:"hash"`
+	// Size of the blob in bytes
+	Size int64 `json:"size"`
+	// MediaType of the blob, e.g. "application/pdf"
+	MediaType string `json:"media_type"`
+	// Location of the blob in the blob store
+	Location string `json:"location"`
+}
+
+// ErrBlobTampered is returned when a blob does not match the hash or size anchored in its descriptor
+var ErrBlobTampered = errors.New("blob does not match its anchored descriptor")
+
+// Anchor stores blobs in a blob store and anchors their descriptors in BCDB
+type Anchor struct {
+	store BlobStore
+}
+
+// NewAnchor creates an anchor of the blobs kept in store
+func NewAnchor(store BlobStore) *Anchor {
+	return &Anchor{
+		store: store,
+	}
+}
+
+// Put stores the blob read from r in the blob store, and puts its descriptor to key within tx.
+// The descriptor is anchored when tx is committed, which is left to the caller. If the descriptor
+// cannot be put the blob is deleted; if tx is aborted the caller should delete it from the store.
+func (a *Anchor) Put(tx bcdb.DataTxContext, dbName, key string, r io.Reader, mediaType string, acl *types.AccessControl) (*Descriptor, error) {
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, hash)}
+	location, err := a.store.Put(counter)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to store blob of key '%s' in database '%s'", key, dbName)
+	}
+
+	desc := &Descriptor{
+		Hash:      hash.Sum(nil),
+		Size:      counter.n,
+		MediaType: mediaType,
+		Location:  location,
+	}
+	if err = tx.PutJSON(dbName, key, desc, acl); err != nil {
+		if deleteErr := a.store.Delete(location); deleteErr != nil {
+			return nil, errors.WithMessagef(err, "failed to delete blob %s of key '%s' in database '%s': %s", location, key, dbName, deleteErr)
+		}
+		return nil, err
+	}
+	return desc, nil
+}
+
+// Get reads the descriptor stored in key within tx, and copies the blob it points to into w, while
+// verifying it against the anchored hash and size. On ErrBlobTampered the content already written to w
+// must be discarded. Returns nil descriptor and metadata if the key does not exist.
+func (a *Anchor) Get(tx bcdb.DataTxContext, dbName, key string, w io.Writer) (*Descriptor, *types.Metadata, error) {
+	desc := &Descriptor{}
+	meta, err := tx.GetJSON(dbName, key, desc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta == nil {
+		return nil, nil, nil
+	}
+
+	if err = a.copyAndVerify(desc, w); err != nil {
+		return nil, nil, errors.WithMessagef(err, "blob of key '%s' in database '%s'", key, dbName)
+	}
+	return desc, meta, nil
+}
+
+// Verify checks the blob pointed to by desc against the anchored hash and size
+func (a *Anchor) Verify(desc *Descriptor) error {
+	return a.copyAndVerify(desc, io.Discard)
+}
+
+func (a *Anchor) copyAndVerify(desc *Descriptor, w io.Writer) error {
+	blob, err := a.store.Get(desc.Location)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(w, io.TeeReader(blob, hash))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read blob %s", desc.Location)
+	}
+	if n != desc.Size || !bytes.Equal(hash.Sum(nil), desc.Hash) {
+		return errors.WithMessagef(ErrBlobTampered, "blob %s", desc.Location)
+	}
+	return nil
+}
+
+// VerifyProof checks that desc is the value of key at block blockNum, using the state proof returned by
+// Ledger.GetDataProof and the state root of the block header, so tampering with the descriptor is detected.
+// The descriptor must have been stored without a value codec.
+func VerifyProof(l bcdb.Ledger, dbName, key string, desc *Descriptor, blockNum uint64) error {
+	value, err := json.Marshal(desc)
+	if err != nil {
+		return err
+	}
+	valueHash, err := bcdb.CalculateValueHash(dbName, key, value)
+	if err != nil {
+		return err
+	}
+
+	header, err := l.GetBlockHeader(blockNum)
+	if err != nil {
+		return err
+	}
+	proof, err := l.GetDataProof(blockNum, dbName, key, false)
+	if err != nil {
+		return err
+	}
+	ok, err := proof.Verify(valueHash, header.GetStateMerkelTreeRootHash(), false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify state proof of key '%s' in database '%s' at block %d", key, dbName, blockNum)
+	}
+	if !ok {
+		return errors.Errorf("descriptor of key '%s' in database '%s' is not part of the state at block %d", key, dbName, blockNum)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,120 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package blobstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb/mocks/bcdbmocks"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTx struct {
+	bcdb.DataTxContext
+	values map[string][]byte
+	putErr error
+}
+
+func (tx *fakeTx) PutJSON(_, key string, value interface{}, _ *types.AccessControl) error {
+	if tx.putErr != nil {
+		return tx.putErr
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tx.values[key] = v
+	return nil
+}
+
+func (tx *fakeTx) GetJSON(_, key string, value interface{}) (*types.Metadata, error) {
+	v, ok := tx.values[key]
+	if !ok {
+		return nil, nil
+	}
+	return &types.Metadata{Version: &types.Version{BlockNum: 5}}, json.Unmarshal(v, value)
+}
+
+func TestAnchor_PutGet(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSystemStore(dir)
+	require.NoError(t, err)
+	anchor := NewAnchor(store)
+	tx := &fakeTx{values: map[string][]byte{}}
+
+	blob := []byte("contract scan, page 1 of 1")
+	desc, err := anchor.Put(tx, "bdb", "doc1", bytes.NewReader(blob), "application/pdf", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(blob)), desc.Size)
+	require.Equal(t, "application/pdf", desc.MediaType)
+
+	buf := &bytes.Buffer{}
+	readDesc, meta, err := anchor.Get(tx, "bdb", "doc1", buf)
+	require.NoError(t, err)
+	require.NotNil(t, meta)
+	require.Equal(t, desc, readDesc)
+	require.Equal(t, blob, buf.Bytes())
+	require.NoError(t, anchor.Verify(desc))
+
+	readDesc, meta, err = anchor.Get(tx, "bdb", "doc2", buf)
+	require.NoError(t, err)
+	require.Nil(t, readDesc)
+	require.Nil(t, meta)
+
+	// tampered blob is detected
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, desc.Location), []byte("contract scan, page 1 of 2"), 0644))
+	_, _, err = anchor.Get(tx, "bdb", "doc1", &bytes.Buffer{})
+	require.True(t, errors.Is(err, ErrBlobTampered))
+	require.EqualError(t, err, "blob of key 'doc1' in database 'bdb': blob "+desc.Location+": blob does not match its anchored descriptor")
+	require.True(t, errors.Is(anchor.Verify(desc), ErrBlobTampered))
+}
+
+func TestAnchor_PutFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSystemStore(dir)
+	require.NoError(t, err)
+	anchor := NewAnchor(store)
+
+	// the blob is deleted if its descriptor cannot be put
+	tx := &fakeTx{values: map[string][]byte{}, putErr: bcdb.ErrTxSpent}
+	_, err = anchor.Put(tx, "bdb", "doc1", bytes.NewReader([]byte("contract scan")), "application/pdf", nil)
+	require.Equal(t, bcdb.ErrTxSpent, err)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestVerifyProof(t *testing.T) {
+	desc := &Descriptor{
+		Hash:      []byte{1, 2, 3},
+		Size:      3,
+		MediaType: "text/plain",
+		Location:  "loc",
+	}
+	value, err := json.Marshal(desc)
+	require.NoError(t, err)
+	valueHash, err := bcdb.CalculateValueHash("bdb", "doc1", value)
+	require.NoError(t, err)
+
+	hashes := [][]byte{[]byte("sibling"), valueHash}
+	rootHash, err := state.CalcHash(hashes)
+	require.NoError(t, err)
+	l := &bcdbmocks.Ledger{}
+	l.On("GetBlockHeader", uint64(5)).Return(&types.BlockHeader{StateMerkelTreeRootHash: rootHash}, nil)
+	l.On("GetDataProof", uint64(5), "bdb", "doc1", false).Return(state.NewProof([]*types.MPTrieProofElement{{Hashes: hashes}}), nil)
+	require.NoError(t, VerifyProof(l, "bdb", "doc1", desc, 5))
+
+	// tampered descriptor is detected
+	tampered := *desc
+	tampered.Hash = []byte{3, 2, 1}
+	err = VerifyProof(l, "bdb", "doc1", &tampered, 5)
+	require.EqualError(t, err, "descriptor of key 'doc1' in database 'bdb' is not part of the state at block 5")
+}
@@ -0,0 +1,95 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package blobstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// locationSize size in bytes of the random blob locations, hex encoded in file names
+const locationSize = 16
+
+type fsStore struct {
+	dir string
+}
+
+// NewFileSystemStore creates a blob store that keeps blobs as files in dir, intended for
+// development and tests. Each blob is stored at a new random location, even if a blob of the
+// same content is already stored, so deleting a blob does not affect other descriptors.
+func NewFileSystemStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create blob store directory %s", dir)
+	}
+	return &fsStore{
+		dir: dir,
+	}, nil
+}
+
+// Put stores the blob read from r
+func (s *fsStore) Put(r io.Reader) (string, error) {
+	f, err := ioutil.TempFile(s.dir, ".blob-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create blob file")
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return "", errors.Wrap(err, "failed to write blob file")
+	}
+	if err = f.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to write blob file")
+	}
+
+	id := make([]byte, locationSize)
+	if _, err = io.ReadFull(rand.Reader, id); err != nil {
+		return "", errors.Wrap(err, "failed to generate blob location")
+	}
+	location := hex.EncodeToString(id)
+	if err = os.Rename(f.Name(), filepath.Join(s.dir, location)); err != nil {
+		return "", errors.Wrap(err, "failed to store blob file")
+	}
+	return location, nil
+}
+
+// Get opens the blob stored at location
+func (s *fsStore) Get(location string) (io.ReadCloser, error) {
+	path, err := s.path(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("blob %s does not exist", location)
+		}
+		return nil, errors.Wrapf(err, "failed to open blob %s", location)
+	}
+	return f, nil
+}
+
+// Delete removes the blob stored at location
+func (s *fsStore) Delete(location string) error {
+	path, err := s.path(location)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete blob %s", location)
+	}
+	return nil
+}
+
+func (s *fsStore) path(location string) (string, error) {
+	if b, err := hex.DecodeString(location); err != nil || len(b) != locationSize {
+		return "", errors.Errorf("invalid blob location %s", location)
+	}
+	return filepath.Join(s.dir, location), nil
+}
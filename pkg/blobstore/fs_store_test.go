@@ -0,0 +1,55 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package blobstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSystemStore_PutGetDelete(t *testing.T) {
+	store, err := NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+
+	blob := []byte("some bulk payload")
+	location, err := store.Put(bytes.NewReader(blob))
+	require.NoError(t, err)
+	require.Len(t, location, 32)
+
+	// same content, another location, which is kept when the first one is deleted
+	location2, err := store.Put(bytes.NewReader(blob))
+	require.NoError(t, err)
+	require.NotEqual(t, location, location2)
+
+	r, err := store.Get(location)
+	require.NoError(t, err)
+	readBlob, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, blob, readBlob)
+
+	require.NoError(t, store.Delete(location))
+	_, err = store.Get(location)
+	require.EqualError(t, err, "blob "+location+" does not exist")
+	require.NoError(t, store.Delete(location))
+
+	r, err = store.Get(location2)
+	require.NoError(t, err)
+	readBlob, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, blob, readBlob)
+}
+
+func TestFileSystemStore_InvalidLocation(t *testing.T) {
+	store, err := NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = store.Get("../etc/passwd")
+	require.EqualError(t, err, "invalid blob location ../etc/passwd")
+	err = store.Delete("abcd")
+	require.EqualError(t, err, "invalid blob location abcd")
+}
@@ -0,0 +1,61 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package lineage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var nodeShapes = map[NodeType]string{
+	KeyNode:     "box",
+	VersionNode: "ellipse",
+	TxNode:      "diamond",
+	UserNode:    "house",
+}
+
+// JSON returns the graph as indented JSON
+func (g *Graph) JSON() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
+
+// DOT returns the graph as a Graphviz DOT digraph
+func (g *Graph) DOT() string {
+	sb := &strings.Builder{}
+	sb.WriteString("digraph lineage {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(sb, "  %s [label=%s, shape=%s];\n", quote(n.ID), quote(n.label()), nodeShapes[n.Type])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(sb, "  %s -> %s [label=%s];\n", quote(e.From), quote(e.To), quote(string(e.Type)))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func (n *Node) label() string {
+	switch n.Type {
+	case KeyNode:
+		return n.DBName + "/" + n.Key
+	case VersionNode:
+		return fmt.Sprintf("%s (%d, %d)", n.Key, n.Version.GetBlockNum(), n.Version.GetTxNum())
+	case TxNode:
+		if n.TxID == "" {
+			return fmt.Sprintf("tx (%d, %d)", n.Version.GetBlockNum(), n.Version.GetTxNum())
+		}
+		return "tx " + n.TxID
+	case UserNode:
+		return n.UserID
+	}
+	return n.ID
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quote returns s as a DOT quoted string, escaping only quotes and backslashes; unlike in Go quoted
+// strings, non-ASCII characters are kept as they are
+func quote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,311 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package lineage builds the lineage graph of a BCDB key: its versions, the transactions
+// that wrote them, the users who read and wrote the key, and, following the read sets of
+// the transactions, the versions of other keys the values were derived from. The graph is
+// built from the provenance of the keys only: a version is written by the tx at its block
+// number and tx index, and the tx ID, signers and read set of that tx are known only if
+// its envelope is available. The graph can be exported as JSON or as a Graphviz DOT digraph.
+package lineage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// NodeType type of a lineage graph node
+type NodeType string
+
+const (
+	// KeyNode a key in a database
+	KeyNode NodeType = "key"
+	// VersionNode a version of a key
+	VersionNode NodeType = "version"
+	// TxNode a transaction, identified by its block number and tx index
+	TxNode NodeType = "tx"
+	// UserNode a user
+	UserNode NodeType = "user"
+)
+
+// EdgeType type of a lineage graph edge
+type EdgeType string
+
+const (
+	// HasVersion from a key to each of its versions
+	HasVersion EdgeType = "has_version"
+	// Next from a version of a key to the following version
+	Next EdgeType = "next"
+	// Wrote from a tx to the version it wrote, or from a user to a key the user wrote
+	Wrote EdgeType = "wrote"
+	// Read from a tx to the version it read, or from a user to a key the user read
+	Read EdgeType = "read"
+	// Submitted from a user who signed a tx to the tx, known only if the tx envelope is available
+	Submitted EdgeType = "submitted"
+)
+
+// Node a node of the lineage graph
+type Node struct {
+	ID      string         `json:"id"`
+	Type    NodeType       `json:"type"`
+	DBName  string         `json:"db_name,omitempty"`
+	Key     string         `json:"key,omitempty"`
+	Version *types.Version `json:"version,omitempty"`
+	Value   []byte         `json:"value,omitempty"`
+	TxID    string         `json:"tx_id,omitempty"`
+	UserID  string         `json:"user_id,omitempty"`
+}
+
+// Edge a directed edge of the lineage graph
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Type EdgeType `json:"type"`
+}
+
+// Graph the lineage graph, nodes and edges are sorted by ID
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Options options of the lineage builder
+type Options struct {
+	// Depth number of read set hops followed from the root key, 0 means only the root key
+	Depth int
+	// Envelopes returns the envelope of the data tx committed at the block number and tx index of
+	// version, nil if it is not available. The SDK cannot fetch tx envelopes from the server, so the tx
+	// IDs, signers and read sets are added only if Envelopes is set, e.g. with envelopes kept by the
+	// application through TxContext.CommittedTxEnvelope, along with the position in their receipts.
+	Envelopes func(version *types.Version) (*types.DataTxEnvelope, error)
+}
+
+// Builder builds lineage graphs from the provenance
+type Builder struct {
+	provenance bcdb.Provenance
+	opts       Options
+	// envelopes of the txs, by block number and tx index
+	envelopes map[string]*types.DataTxEnvelope
+}
+
+// NewBuilder creates a lineage builder
+func NewBuilder(p bcdb.Provenance, opts *Options) *Builder {
+	b := &Builder{
+		provenance: p,
+		envelopes:  make(map[string]*types.DataTxEnvelope),
+	}
+	if opts != nil {
+		b.opts = *opts
+	}
+	return b
+}
+
+type dbKey struct {
+	dbName string
+	key    string
+	depth  int
+}
+
+type graphBuilder struct {
+	nodes map[string]*Node
+	edges map[Edge]bool
+}
+
+// Build builds the lineage graph of key in database dbName
+func (b *Builder) Build(dbName, key string) (*Graph, error) {
+	g := &graphBuilder{
+		nodes: make(map[string]*Node),
+		edges: make(map[Edge]bool),
+	}
+
+	queue := []*dbKey{{dbName: dbName, key: key}}
+	visited := map[string]bool{keyID(dbName, key): true}
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+
+		reads, err := b.addKey(g, k.dbName, k.key, k.depth < b.opts.Depth)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range reads {
+			if id := keyID(r.dbName, r.key); !visited[id] {
+				visited[id] = true
+				queue = append(queue, &dbKey{dbName: r.dbName, key: r.key, depth: k.depth + 1})
+			}
+		}
+	}
+
+	return g.graph(), nil
+}
+
+// addKey adds the key, its versions, readers, writers and writing txs, and returns the keys read by
+// those txs if followReads is set
+func (b *Builder) addKey(g *graphBuilder, dbName, key string, followReads bool) ([]*dbKey, error) {
+	kID := keyID(dbName, key)
+	g.addNode(&Node{ID: kID, Type: KeyNode, DBName: dbName, Key: key})
+
+	values, err := b.provenance.GetHistoricalData(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get history of key '%s' in database '%s'", key, dbName)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return bcdb.VersionLess(values[i].GetMetadata().GetVersion(), values[j].GetMetadata().GetVersion())
+	})
+	var reads []*dbKey
+	for i, v := range values {
+		version := v.GetMetadata().GetVersion()
+		vID := versionID(dbName, key, version)
+		g.addNode(&Node{ID: vID, Type: VersionNode, DBName: dbName, Key: key, Version: version, Value: v.GetValue()})
+		g.addEdge(kID, vID, HasVersion)
+		if i > 0 {
+			g.addEdge(versionID(dbName, key, values[i-1].GetMetadata().GetVersion()), vID, Next)
+		}
+
+		txReads, err := b.addTx(g, version, vID, followReads)
+		if err != nil {
+			return nil, err
+		}
+		reads = append(reads, txReads...)
+	}
+
+	readers, err := b.provenance.GetReaders(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get readers of key '%s' in database '%s'", key, dbName)
+	}
+	for _, userID := range readers {
+		g.addNode(&Node{ID: userNodeID(userID), Type: UserNode, UserID: userID})
+		g.addEdge(userNodeID(userID), kID, Read)
+	}
+
+	writers, err := b.provenance.GetWriters(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get writers of key '%s' in database '%s'", key, dbName)
+	}
+	for _, userID := range writers {
+		g.addNode(&Node{ID: userNodeID(userID), Type: UserNode, UserID: userID})
+		g.addEdge(userNodeID(userID), kID, Wrote)
+	}
+	return reads, nil
+}
+
+// addTx adds the tx that wrote the version vID, its signers if its envelope is available, and the
+// versions it read if followReads is set, and returns the keys read
+func (b *Builder) addTx(g *graphBuilder, version *types.Version, vID string, followReads bool) ([]*dbKey, error) {
+	txID := txNodeID(version)
+	env, err := b.envelope(version)
+	if err != nil {
+		return nil, err
+	}
+	g.addNode(&Node{ID: txID, Type: TxNode, Version: version, TxID: env.GetPayload().GetTxId()})
+	g.addEdge(txID, vID, Wrote)
+	if env == nil {
+		return nil, nil
+	}
+
+	for _, userID := range env.GetPayload().GetMustSignUserIds() {
+		g.addNode(&Node{ID: userNodeID(userID), Type: UserNode, UserID: userID})
+		g.addEdge(userNodeID(userID), txID, Submitted)
+	}
+	if !followReads {
+		return nil, nil
+	}
+
+	var reads []*dbKey
+	for _, ops := range env.GetPayload().GetDbOperations() {
+		for _, r := range ops.GetDataReads() {
+			rID := versionID(ops.GetDbName(), r.GetKey(), r.GetVersion())
+			g.addNode(&Node{ID: rID, Type: VersionNode, DBName: ops.GetDbName(), Key: r.GetKey(), Version: r.GetVersion()})
+			g.addEdge(txID, rID, Read)
+			reads = append(reads, &dbKey{dbName: ops.GetDbName(), key: r.GetKey()})
+		}
+	}
+	return reads, nil
+}
+
+// envelope returns the envelope of the tx at the position of version, nil if Envelopes is not set
+// or the envelope is not available
+func (b *Builder) envelope(version *types.Version) (*types.DataTxEnvelope, error) {
+	if b.opts.Envelopes == nil {
+		return nil, nil
+	}
+	position := positionID(version)
+	if env, ok := b.envelopes[position]; ok {
+		return env, nil
+	}
+	env, err := b.opts.Envelopes(version)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get envelope of tx at block %d, index %d", version.GetBlockNum(), version.GetTxNum())
+	}
+	b.envelopes[position] = env
+	return env, nil
+}
+
+func (g *graphBuilder) addNode(n *Node) {
+	existing, ok := g.nodes[n.ID]
+	if !ok {
+		g.nodes[n.ID] = n
+		return
+	}
+	// a version first reached through a read set gets its value once the key history is added, and a
+	// tx gets its ID once an envelope of the tx is found
+	if existing.Value == nil {
+		existing.Value = n.Value
+	}
+	if existing.TxID == "" {
+		existing.TxID = n.TxID
+	}
+}
+
+func (g *graphBuilder) addEdge(from, to string, edgeType EdgeType) {
+	g.edges[Edge{From: from, To: to, Type: edgeType}] = true
+}
+
+func (g *graphBuilder) graph() *Graph {
+	graph := &Graph{}
+	for _, n := range g.nodes {
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+	for e := range g.edges {
+		e := e
+		graph.Edges = append(graph.Edges, &e)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		ei, ej := graph.Edges[i], graph.Edges[j]
+		if ei.From != ej.From {
+			return ei.From < ej.From
+		}
+		if ei.To != ej.To {
+			return ei.To < ej.To
+		}
+		return ei.Type < ej.Type
+	})
+	return graph
+}
+
+func keyID(dbName, key string) string {
+	return fmt.Sprintf("key:%s/%s", dbName, key)
+}
+
+func versionID(dbName, key string, version *types.Version) string {
+	return fmt.Sprintf("version:%s/%s@%s", dbName, key, positionID(version))
+}
+
+func positionID(version *types.Version) string {
+	return fmt.Sprintf("%d:%d", version.GetBlockNum(), version.GetTxNum())
+}
+
+func txNodeID(version *types.Version) string {
+	return "tx:" + positionID(version)
+}
+
+func userNodeID(userID string) string {
+	return "user:" + userID
+}
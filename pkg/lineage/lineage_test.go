@@ -0,0 +1,160 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package lineage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb/mocks/bcdbmocks"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func value(v string, blockNum, txNum uint64) *types.ValueWithMetadata {
+	return &types.ValueWithMetadata{
+		Value:    []byte(v),
+		Metadata: &types.Metadata{Version: &types.Version{BlockNum: blockNum, TxNum: txNum}},
+	}
+}
+
+func envelopes(envs map[string]*types.DataTxEnvelope) func(version *types.Version) (*types.DataTxEnvelope, error) {
+	return func(version *types.Version) (*types.DataTxEnvelope, error) {
+		return envs[positionID(version)], nil
+	}
+}
+
+// price was written at (3, 0) and by bob in tx3 at (5, 1), which read rate, written by alice in tx2 at (4, 0).
+// The envelope of the tx at (3, 0) is not available.
+func testProvenance() (*bcdbmocks.Provenance, map[string]*types.DataTxEnvelope) {
+	p := &bcdbmocks.Provenance{}
+	p.On("GetHistoricalData", "bdb", "price").Return([]*types.ValueWithMetadata{value("110", 5, 1), value("100", 3, 0)}, nil)
+	p.On("GetHistoricalData", "bdb", "rate").Return([]*types.ValueWithMetadata{value("1.1", 4, 0)}, nil)
+	p.On("GetReaders", "bdb", "price").Return([]string{"carol"}, nil)
+	p.On("GetReaders", "bdb", "rate").Return([]string{"bob"}, nil)
+	p.On("GetWriters", "bdb", "price").Return([]string{"bob", "alice"}, nil)
+	p.On("GetWriters", "bdb", "rate").Return([]string{"alice"}, nil)
+
+	envs := map[string]*types.DataTxEnvelope{
+		"4:0": {Payload: &types.DataTx{
+			TxId:            "tx2",
+			MustSignUserIds: []string{"alice"},
+		}},
+		"5:1": {Payload: &types.DataTx{
+			TxId:            "tx3",
+			MustSignUserIds: []string{"bob"},
+			DbOperations: []*types.DBOperation{{
+				DbName:    "bdb",
+				DataReads: []*types.DataRead{{Key: "rate", Version: &types.Version{BlockNum: 4, TxNum: 0}}},
+			}},
+		}},
+	}
+	return p, envs
+}
+
+func TestBuild(t *testing.T) {
+	p, envs := testProvenance()
+	b := NewBuilder(p, &Options{Depth: 1, Envelopes: envelopes(envs)})
+
+	g, err := b.Build("bdb", "price")
+	require.NoError(t, err)
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.ID)
+	}
+	require.Equal(t, []string{
+		"key:bdb/price", "key:bdb/rate",
+		"tx:3:0", "tx:4:0", "tx:5:1",
+		"user:alice", "user:bob", "user:carol",
+		"version:bdb/price@3:0", "version:bdb/price@5:1", "version:bdb/rate@4:0",
+	}, nodes)
+	require.Equal(t, "", g.Nodes[2].TxID)
+	require.Equal(t, "tx2", g.Nodes[3].TxID)
+	require.Equal(t, "tx3", g.Nodes[4].TxID)
+	require.Equal(t, &types.Version{BlockNum: 5, TxNum: 1}, g.Nodes[4].Version)
+	require.Equal(t, []byte("1.1"), g.Nodes[10].Value)
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -"+string(e.Type)+"-> "+e.To)
+	}
+	require.Equal(t, []string{
+		"key:bdb/price -has_version-> version:bdb/price@3:0",
+		"key:bdb/price -has_version-> version:bdb/price@5:1",
+		"key:bdb/rate -has_version-> version:bdb/rate@4:0",
+		"tx:3:0 -wrote-> version:bdb/price@3:0",
+		"tx:4:0 -wrote-> version:bdb/rate@4:0",
+		"tx:5:1 -wrote-> version:bdb/price@5:1",
+		"tx:5:1 -read-> version:bdb/rate@4:0",
+		"user:alice -wrote-> key:bdb/price",
+		"user:alice -wrote-> key:bdb/rate",
+		"user:alice -submitted-> tx:4:0",
+		"user:bob -wrote-> key:bdb/price",
+		"user:bob -read-> key:bdb/rate",
+		"user:bob -submitted-> tx:5:1",
+		"user:carol -read-> key:bdb/price",
+		"version:bdb/price@3:0 -next-> version:bdb/price@5:1",
+	}, edges)
+	// the txs are found from the history of the keys, not from all the txs of the writers
+	p.AssertNotCalled(t, "GetTxIDsSubmittedByUser", mock.Anything)
+
+	g, err = NewBuilder(p, nil).Build("bdb", "price")
+	require.NoError(t, err)
+	require.Len(t, g.Nodes, 8)
+
+	g, err = NewBuilder(p, &Options{Envelopes: envelopes(envs)}).Build("bdb", "price")
+	require.NoError(t, err)
+	require.Len(t, g.Nodes, 8)
+	require.Equal(t, "tx3", g.Nodes[2].TxID)
+
+	_, err = NewBuilder(p, &Options{
+		Envelopes: func(version *types.Version) (*types.DataTxEnvelope, error) {
+			return nil, errors.New("envelope store is closed")
+		},
+	}).Build("bdb", "price")
+	require.EqualError(t, err, "failed to get envelope of tx at block 3, index 0: envelope store is closed")
+
+	p = &bcdbmocks.Provenance{}
+	p.On("GetHistoricalData", "bdb", "price").Return(nil, errors.New("server is down"))
+	_, err = NewBuilder(p, nil).Build("bdb", "price")
+	require.EqualError(t, err, "failed to get history of key 'price' in database 'bdb': server is down")
+}
+
+func TestExport(t *testing.T) {
+	key := `pri"ce\€`
+	p := &bcdbmocks.Provenance{}
+	p.On("GetHistoricalData", "bdb", key).Return([]*types.ValueWithMetadata{value("100", 3, 0)}, nil)
+	p.On("GetReaders", "bdb", key).Return(nil, nil)
+	p.On("GetWriters", "bdb", key).Return([]string{"alice"}, nil)
+	envs := map[string]*types.DataTxEnvelope{
+		"3:0": {Payload: &types.DataTx{TxId: "tx1", MustSignUserIds: []string{"alice"}}},
+	}
+	g, err := NewBuilder(p, &Options{Envelopes: envelopes(envs)}).Build("bdb", key)
+	require.NoError(t, err)
+
+	require.Equal(t, `digraph lineage {
+  rankdir=LR;
+  "key:bdb/pri\"ce\\€" [label="bdb/pri\"ce\\€", shape=box];
+  "tx:3:0" [label="tx tx1", shape=diamond];
+  "user:alice" [label="alice", shape=house];
+  "version:bdb/pri\"ce\\€@3:0" [label="pri\"ce\\€ (3, 0)", shape=ellipse];
+  "key:bdb/pri\"ce\\€" -> "version:bdb/pri\"ce\\€@3:0" [label="has_version"];
+  "tx:3:0" -> "version:bdb/pri\"ce\\€@3:0" [label="wrote"];
+  "user:alice" -> "key:bdb/pri\"ce\\€" [label="wrote"];
+  "user:alice" -> "tx:3:0" [label="submitted"];
+}
+`, g.DOT())
+
+	g, err = NewBuilder(p, nil).Build("bdb", key)
+	require.NoError(t, err)
+	require.Contains(t, g.DOT(), `"tx:3:0" [label="tx (3, 0)", shape=diamond];`)
+
+	b, err := g.JSON()
+	require.NoError(t, err)
+	decoded := &Graph{}
+	require.NoError(t, json.Unmarshal(b, decoded))
+	require.Equal(t, g, decoded)
+}
@@ -0,0 +1,98 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package notary
+
+import (
+	"crypto/sha256"
+)
+
+// Leaves and inner nodes are hashed with distinct prefixes, so an inner node can never be
+// presented as a document hash
+var (
+	leafPrefix = []byte{0x00}
+	nodePrefix = []byte{0x01}
+)
+
+// PathStep is a single step of an inclusion path, from a leaf up to the root
+type PathStep struct {
+	// Hash of the sibling node
+	Hash []byte `json:"hash"`
+	// Left is true if the sibling is the left child of the parent node
+	Left bool `json:"left"`
+}
+
+// merkleTree is a binary Merkle tree, levels[0] holds the leaves and the last level holds the root.
+// A node without a sibling is promoted to the next level as is.
+type merkleTree struct {
+	levels [][][]byte
+}
+
+func newMerkleTree(documentHashes [][]byte) *merkleTree {
+	level := make([][]byte, len(documentHashes))
+	for i, h := range documentHashes {
+		level[i] = hashLeaf(h)
+	}
+
+	t := &merkleTree{
+		levels: [][][]byte{level},
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashNode(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+func (t *merkleTree) root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// path returns the inclusion path of leaf index
+func (t *merkleTree) path(index int) []*PathStep {
+	var path []*PathStep
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if index%2 == 1 {
+			path = append(path, &PathStep{Hash: level[index-1], Left: true})
+		} else if index+1 < len(level) {
+			path = append(path, &PathStep{Hash: level[index+1]})
+		}
+		index /= 2
+	}
+	return path
+}
+
+// calculateRoot folds a document hash through its inclusion path
+func calculateRoot(documentHash []byte, path []*PathStep) []byte {
+	h := hashLeaf(documentHash)
+	for _, step := range path {
+		if step.Left {
+			h = hashNode(step.Hash, h)
+		} else {
+			h = hashNode(h, step.Hash)
+		}
+	}
+	return h
+}
+
+func hashLeaf(documentHash []byte) []byte {
+	h := sha256.New()
+	h.Write(leafPrefix)
+	h.Write(documentHash)
+	return h.Sum(nil)
+}
+
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write(nodePrefix)
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
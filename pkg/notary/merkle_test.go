@@ -0,0 +1,37 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package notary
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleTree(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 13} {
+		t.Run(fmt.Sprintf("%d leaves", n), func(t *testing.T) {
+			var hashes [][]byte
+			for i := 0; i < n; i++ {
+				h := sha256.Sum256([]byte(fmt.Sprintf("document-%d", i)))
+				hashes = append(hashes, h[:])
+			}
+			tree := newMerkleTree(hashes)
+
+			for i, h := range hashes {
+				require.Equal(t, tree.root(), calculateRoot(h, tree.path(i)))
+			}
+			other := sha256.Sum256([]byte("other"))
+			require.NotEqual(t, tree.root(), calculateRoot(other[:], tree.path(0)))
+		})
+	}
+}
+
+func TestMerkleTree_SingleLeaf(t *testing.T) {
+	h := sha256.Sum256([]byte("document"))
+	tree := newMerkleTree([][]byte{h[:]})
+	require.Equal(t, hashLeaf(h[:]), tree.root())
+	require.Empty(t, tree.path(0))
+}
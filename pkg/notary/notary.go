@@ -0,0 +1,258 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package notary notarizes batches of documents. The hashes of the documents in a batch are
+// the leaves of a Merkle tree, and only the tree root is stored in a BCDB key, by a single
+// data transaction. Every document gets a standalone proof, which can be verified offline
+// against the header of the block the transaction was committed in.
+package notary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Batch collects the hashes of the documents notarized together
+type Batch struct {
+	ids    []string
+	hashes [][]byte
+	index  map[string]bool
+}
+
+// NewBatch creates an empty batch
+func NewBatch() *Batch {
+	return &Batch{
+		index: map[string]bool{},
+	}
+}
+
+// Add hashes the document read from r and adds it to the batch
+func (b *Batch) Add(documentID string, r io.Reader) error {
+	hash, err := HashDocument(r)
+	if err != nil {
+		return errors.WithMessagef(err, "document %s", documentID)
+	}
+	return b.AddHash(documentID, hash)
+}
+
+// AddHash adds a document to the batch by its SHA256 hash
+func (b *Batch) AddHash(documentID string, hash []byte) error {
+	if documentID == "" {
+		return errors.New("document ID is empty")
+	}
+	if len(hash) != sha256.Size {
+		return errors.Errorf("hash of document %s is %d bytes long, expected %d", documentID, len(hash), sha256.Size)
+	}
+	if b.index[documentID] {
+		return errors.Errorf("document %s is already in the batch", documentID)
+	}
+	b.index[documentID] = true
+	b.ids = append(b.ids, documentID)
+	b.hashes = append(b.hashes, hash)
+	return nil
+}
+
+// Len returns the number of documents in the batch
+func (b *Batch) Len() int {
+	return len(b.ids)
+}
+
+// HashDocument returns the SHA256 hash of the document read from r
+func HashDocument(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, errors.Wrap(err, "failed to read document")
+	}
+	return h.Sum(nil), nil
+}
+
+// DocumentProof proves that a document was notarized, it is self contained and can be serialized as JSON
+type DocumentProof struct {
+	DocumentID   string `json:"document_id"`
+	DocumentHash []byte `json:"document_hash"`
+	// Path inclusion path from the document hash to the batch root
+	Path []*PathStep `json:"path"`
+	// Root of the batch Merkle tree, the value stored in Key
+	Root   []byte `json:"root"`
+	DBName string `json:"db_name"`
+	Key    string `json:"key"`
+	TxID   string `json:"tx_id"`
+	// BlockNumber number of the block the transaction was committed in
+	BlockNumber uint64 `json:"block_number"`
+	TxIndex     uint64 `json:"tx_index"`
+	// TxEnvelope protobuf serialized types.DataTxEnvelope of the transaction
+	TxEnvelope []byte `json:"tx_envelope"`
+	// TxProof intermediate hashes from the transaction to the block tx merkle tree root
+	TxProof [][]byte `json:"tx_proof"`
+	// StateProof path from the root value to the block state trie root, as returned by GetDataProof
+	StateProof []*types.MPTrieProofElement `json:"state_proof,omitempty"`
+}
+
+// Notary stores the roots of document batches in a database
+type Notary struct {
+	session bcdb.DBSession
+	dbName  string
+}
+
+// NewNotary creates a notary that stores the batch roots in database dbName
+func NewNotary(session bcdb.DBSession, dbName string) *Notary {
+	return &Notary{
+		session: session,
+		dbName:  dbName,
+	}
+}
+
+// Notarize stores the root of batch in key, waits for the transaction to commit, and returns
+// a proof for every document of the batch, in the order the documents were added
+func (n *Notary) Notarize(batch *Batch, key string, acl *types.AccessControl) ([]*DocumentProof, error) {
+	if batch.Len() == 0 {
+		return nil, errors.New("batch is empty")
+	}
+	tree := newMerkleTree(batch.hashes)
+	root := tree.root()
+
+	tx, err := n.session.DataTx()
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Put(n.dbName, key, root, acl); err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	txID, receipt, err := tx.Commit(true)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to commit batch root to key '%s' in database '%s'", key, n.dbName)
+	}
+	env, err := tx.CommittedTxEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	envBytes, err := proto.Marshal(env)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize transaction envelope")
+	}
+
+	blockNum := receipt.GetHeader().GetBaseHeader().GetNumber()
+	ledger, err := n.session.Ledger()
+	if err != nil {
+		return nil, err
+	}
+	txProof, err := ledger.GetTransactionProof(blockNum, int(receipt.GetTxIndex()))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get proof of transaction %s", txID)
+	}
+	stateProof, err := ledger.GetDataProof(blockNum, n.dbName, key, false)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get proof of key '%s' in database '%s'", key, n.dbName)
+	}
+
+	proofs := make([]*DocumentProof, batch.Len())
+	for i, id := range batch.ids {
+		proofs[i] = &DocumentProof{
+			DocumentID:   id,
+			DocumentHash: batch.hashes[i],
+			Path:         tree.path(i),
+			Root:         root,
+			DBName:       n.dbName,
+			Key:          key,
+			TxID:         txID,
+			BlockNumber:  blockNum,
+			TxIndex:      receipt.GetTxIndex(),
+			TxEnvelope:   envBytes,
+			TxProof:      txProof.GetIntermediateHashes(),
+			StateProof:   stateProof.GetPath(),
+		}
+	}
+	return proofs, nil
+}
+
+// VerifyDocument hashes the document read from r and verifies it against proof, see Verify
+func VerifyDocument(r io.Reader, proof *DocumentProof, header *types.BlockHeader) error {
+	hash, err := HashDocument(r)
+	if err != nil {
+		return err
+	}
+	return Verify(hash, proof, header)
+}
+
+// Verify checks offline that the document with documentHash was notarized, using only proof and the
+// header of the block the transaction was committed in. The header must come from a trusted source,
+// e.g. a verified ledger path. Returns nil if the document is proven, or an error naming the failed check.
+func Verify(documentHash []byte, proof *DocumentProof, header *types.BlockHeader) error {
+	if !bytes.Equal(documentHash, proof.DocumentHash) {
+		return errors.Errorf("document hash does not match the hash of document %s in the proof", proof.DocumentID)
+	}
+	if !bytes.Equal(calculateRoot(documentHash, proof.Path), proof.Root) {
+		return errors.Errorf("inclusion path of document %s does not lead to the batch root", proof.DocumentID)
+	}
+	if header.GetBaseHeader().GetNumber() != proof.BlockNumber {
+		return errors.Errorf("block header %d does not match block %d of the proof", header.GetBaseHeader().GetNumber(), proof.BlockNumber)
+	}
+
+	env := &types.DataTxEnvelope{}
+	if err := proto.Unmarshal(proof.TxEnvelope, env); err != nil {
+		return errors.Wrap(err, "failed to parse transaction envelope")
+	}
+	if env.GetPayload().GetTxId() != proof.TxID {
+		return errors.Errorf("transaction envelope %s does not match transaction %s of the proof", env.GetPayload().GetTxId(), proof.TxID)
+	}
+	if !writesRoot(env, proof) {
+		return errors.Errorf("transaction %s does not write the batch root to key '%s' in database '%s'", proof.TxID, proof.Key, proof.DBName)
+	}
+
+	valInfo := header.GetValidationInfo()
+	if proof.TxIndex >= uint64(len(valInfo)) {
+		return errors.Errorf("transaction index %d is out of range of block %d", proof.TxIndex, proof.BlockNumber)
+	}
+	if valInfo[proof.TxIndex].GetFlag() != types.Flag_VALID {
+		return errors.Errorf("transaction %s is invalid, flag: %s", proof.TxID, valInfo[proof.TxIndex].GetFlag())
+	}
+	receipt := &types.TxReceipt{
+		Header:  header,
+		TxIndex: proof.TxIndex,
+	}
+	ok, err := bcdb.NewTxProof(proof.TxProof).Verify(receipt, env)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("transaction %s is not part of block %d", proof.TxID, proof.BlockNumber)
+	}
+
+	if len(proof.StateProof) == 0 {
+		return nil
+	}
+	valueHash, err := bcdb.CalculateValueHash(proof.DBName, proof.Key, proof.Root)
+	if err != nil {
+		return err
+	}
+	ok, err = state.NewProof(proof.StateProof).Verify(valueHash, header.GetStateMerkelTreeRootHash(), false)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify state proof")
+	}
+	if !ok {
+		return errors.Errorf("batch root is not the value of key '%s' in database '%s' at block %d", proof.Key, proof.DBName, proof.BlockNumber)
+	}
+	return nil
+}
+
+func writesRoot(env *types.DataTxEnvelope, proof *DocumentProof) bool {
+	for _, ops := range env.GetPayload().GetDbOperations() {
+		if ops.GetDbName() != proof.DBName {
+			continue
+		}
+		for _, w := range ops.GetDataWrites() {
+			if w.GetKey() == proof.Key && bytes.Equal(w.GetValue(), proof.Root) {
+				return true
+			}
+		}
+	}
+	return false
+}
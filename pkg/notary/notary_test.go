@@ -0,0 +1,182 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package notary
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb/mocks/bcdbmocks"
+	"github.com/hyperledger-labs/orion-server/pkg/crypto"
+	"github.com/hyperledger-labs/orion-server/pkg/state"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSession struct {
+	bcdb.DBSession
+	ledger *bcdbmocks.Ledger
+	// header of the block committed by the last tx
+	header *types.BlockHeader
+}
+
+func (s *fakeSession) DataTx() (bcdb.DataTxContext, error) {
+	return &fakeTx{session: s}, nil
+}
+
+func (s *fakeSession) Ledger() (bcdb.Ledger, error) {
+	return s.ledger, nil
+}
+
+type fakeTx struct {
+	bcdb.DataTxContext
+	session *fakeSession
+	ops     *types.DBOperation
+	env     *types.DataTxEnvelope
+}
+
+func (tx *fakeTx) Put(dbName, key string, value []byte, acl *types.AccessControl) error {
+	tx.ops = &types.DBOperation{
+		DbName:     dbName,
+		DataWrites: []*types.DataWrite{{Key: key, Value: value, Acl: acl}},
+	}
+	return nil
+}
+
+func (tx *fakeTx) Abort() error {
+	return nil
+}
+
+// Commit puts the transaction alone in block 3
+func (tx *fakeTx) Commit(bool) (string, *types.TxReceipt, error) {
+	tx.env = &types.DataTxEnvelope{
+		Payload: &types.DataTx{
+			MustSignUserIds: []string{"alice"},
+			TxId:            "tx1",
+			DbOperations:    []*types.DBOperation{tx.ops},
+		},
+		Signatures: map[string][]byte{"alice": []byte("signature")},
+	}
+	valInfo := &types.ValidationInfo{Flag: types.Flag_VALID}
+	envBytes, _ := json.Marshal(tx.env)
+	valInfoBytes, _ := json.Marshal(valInfo)
+	txHash, _ := crypto.ComputeSHA256Hash(append(envBytes, valInfoBytes...))
+
+	w := tx.ops.DataWrites[0]
+	valueHash, _ := bcdb.CalculateValueHash(tx.ops.DbName, w.Key, w.Value)
+	trieNode := [][]byte{[]byte("sibling"), valueHash}
+	stateRoot, _ := state.CalcHash(trieNode)
+
+	tx.session.header = &types.BlockHeader{
+		BaseHeader:              &types.BlockHeaderBase{Number: 3},
+		TxMerkelTreeRootHash:    txHash,
+		StateMerkelTreeRootHash: stateRoot,
+		ValidationInfo:          []*types.ValidationInfo{valInfo},
+	}
+	tx.session.ledger.On("GetTransactionProof", uint64(3), 0).Return(bcdb.NewTxProof([][]byte{txHash}), nil)
+	tx.session.ledger.On("GetDataProof", uint64(3), tx.ops.DbName, w.Key, false).
+		Return(state.NewProof([]*types.MPTrieProofElement{{Hashes: trieNode}}), nil)
+	return "tx1", &types.TxReceipt{Header: tx.session.header, TxIndex: 0}, nil
+}
+
+func (tx *fakeTx) CommittedTxEnvelope() (proto.Message, error) {
+	return tx.env, nil
+}
+
+func notarizeTestBatch(t *testing.T, documents ...string) ([]*DocumentProof, *types.BlockHeader) {
+	session := &fakeSession{ledger: &bcdbmocks.Ledger{}}
+	n := NewNotary(session, "bdb")
+
+	batch := NewBatch()
+	for i, doc := range documents {
+		require.NoError(t, batch.Add(string(rune('a'+i)), strings.NewReader(doc)))
+	}
+	proofs, err := n.Notarize(batch, "batch1", nil)
+	require.NoError(t, err)
+	require.Len(t, proofs, len(documents))
+	session.ledger.AssertExpectations(t)
+	return proofs, session.header
+}
+
+func TestNotary_NotarizeAndVerify(t *testing.T) {
+	documents := []string{"first", "second", "third", "fourth", "fifth"}
+	proofs, header := notarizeTestBatch(t, documents...)
+
+	for i, doc := range documents {
+		proof := proofs[i]
+		require.Equal(t, "tx1", proof.TxID)
+		require.Equal(t, uint64(3), proof.BlockNumber)
+		require.NoError(t, VerifyDocument(strings.NewReader(doc), proof, header))
+
+		// the proof survives serialization
+		proofBytes, err := json.Marshal(proof)
+		require.NoError(t, err)
+		readProof := &DocumentProof{}
+		require.NoError(t, json.Unmarshal(proofBytes, readProof))
+		require.NoError(t, VerifyDocument(strings.NewReader(doc), readProof, header))
+	}
+}
+
+func TestNotary_VerifyFailures(t *testing.T) {
+	proofs, header := notarizeTestBatch(t, "first", "second", "third")
+
+	t.Run("tampered document", func(t *testing.T) {
+		err := VerifyDocument(strings.NewReader("secnod"), proofs[1], header)
+		require.EqualError(t, err, "document hash does not match the hash of document b in the proof")
+	})
+
+	t.Run("document of another proof", func(t *testing.T) {
+		proof := *proofs[1]
+		proof.DocumentHash = proofs[0].DocumentHash
+		err := VerifyDocument(strings.NewReader("first"), &proof, header)
+		require.EqualError(t, err, "inclusion path of document b does not lead to the batch root")
+	})
+
+	t.Run("tampered root", func(t *testing.T) {
+		proof := *proofs[0]
+		proof.Path = nil
+		proof.Root = calculateRoot(proof.DocumentHash, nil)
+		err := Verify(proof.DocumentHash, &proof, header)
+		require.EqualError(t, err, "transaction tx1 does not write the batch root to key 'batch1' in database 'bdb'")
+	})
+
+	t.Run("wrong block header", func(t *testing.T) {
+		otherHeader := proto.Clone(header).(*types.BlockHeader)
+		otherHeader.TxMerkelTreeRootHash = sha256.New().Sum(nil)
+		err := Verify(proofs[0].DocumentHash, proofs[0], otherHeader)
+		require.EqualError(t, err, "transaction tx1 is not part of block 3")
+
+		otherHeader = proto.Clone(header).(*types.BlockHeader)
+		otherHeader.BaseHeader.Number = 4
+		err = Verify(proofs[0].DocumentHash, proofs[0], otherHeader)
+		require.EqualError(t, err, "block header 4 does not match block 3 of the proof")
+
+		otherHeader = proto.Clone(header).(*types.BlockHeader)
+		otherHeader.StateMerkelTreeRootHash = sha256.New().Sum(nil)
+		err = Verify(proofs[0].DocumentHash, proofs[0], otherHeader)
+		require.EqualError(t, err, "batch root is not the value of key 'batch1' in database 'bdb' at block 3")
+	})
+
+	t.Run("invalid transaction", func(t *testing.T) {
+		otherHeader := proto.Clone(header).(*types.BlockHeader)
+		otherHeader.ValidationInfo[0].Flag = types.Flag_INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE
+		err := Verify(proofs[0].DocumentHash, proofs[0], otherHeader)
+		require.EqualError(t, err, "transaction tx1 is invalid, flag: INVALID_MVCC_CONFLICT_WITH_COMMITTED_STATE")
+	})
+}
+
+func TestBatch_Add(t *testing.T) {
+	batch := NewBatch()
+	require.NoError(t, batch.Add("a", strings.NewReader("first")))
+	require.EqualError(t, batch.Add("a", strings.NewReader("second")), "document a is already in the batch")
+	require.EqualError(t, batch.AddHash("b", []byte{1, 2}), "hash of document b is 2 bytes long, expected 32")
+	require.EqualError(t, batch.AddHash("", make([]byte, 32)), "document ID is empty")
+	require.Equal(t, 1, batch.Len())
+
+	_, err := NewNotary(&fakeSession{}, "bdb").Notarize(NewBatch(), "batch1", nil)
+	require.EqualError(t, err, "batch is empty")
+}
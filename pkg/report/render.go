@@ -0,0 +1,114 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package report
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var columns = []string{"access", "user_id", "tx_id", "block_num", "tx_index", "db_name", "key", "version", "value", "value_hash", "flag", "count"}
+
+// JSON returns the report as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// WriteCSV writes the entries of the report as CSV, with a header row
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		if err := cw.Write(e.fields()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the report as a Markdown document with a table of the entries
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "# %s\n\n", r.Title)
+	if r.FromBlock != 0 || r.ToBlock != 0 {
+		fmt.Fprintf(sb, "Blocks %s to %s\n\n", blockBound(r.FromBlock, "first"), blockBound(r.ToBlock, "last"))
+	}
+	if len(r.Entries) == 0 {
+		sb.WriteString("No accesses.\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	fmt.Fprintf(sb, "| %s |\n", strings.Join(columns, " | "))
+	sb.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, e := range r.Entries {
+		fields := e.fields()
+		for i, f := range fields {
+			fields[i] = markdownEscaper.Replace(f)
+		}
+		fmt.Fprintf(sb, "| %s |\n", strings.Join(fields, " | "))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\n", " ", "\r", " ")
+
+func (e *Entry) fields() []string {
+	var version, count, blockNum, txIndex string
+	if e.Version != nil {
+		version = fmt.Sprintf("%d:%d", e.Version.GetBlockNum(), e.Version.GetTxNum())
+	}
+	if e.Count != 0 {
+		count = strconv.FormatUint(uint64(e.Count), 10)
+	}
+	if e.BlockNum != 0 {
+		blockNum = strconv.FormatUint(e.BlockNum, 10)
+		txIndex = strconv.FormatUint(e.TxIndex, 10)
+	}
+	return []string{
+		string(e.Access),
+		e.UserID,
+		e.TxID,
+		blockNum,
+		txIndex,
+		e.DBName,
+		e.Key,
+		version,
+		formatValue(e.Value),
+		hex.EncodeToString(e.ValueHash),
+		e.Flag,
+		count,
+	}
+}
+
+// formatValue returns printable values as they are, and other values in base64
+func formatValue(value []byte) string {
+	if value == nil {
+		return ""
+	}
+	if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) < 0 {
+		return string(value)
+	}
+	return "base64:" + base64.StdEncoding.EncodeToString(value)
+}
+
+func blockBound(blockNum uint64, unbounded string) string {
+	if blockNum == 0 {
+		return unbounded
+	}
+	return strconv.FormatUint(blockNum, 10)
+}
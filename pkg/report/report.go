@@ -0,0 +1,341 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package report generates audit reports of the data accessed by a user, and of the users
+// who accessed a key, from the provenance and the ledger. Reports can be rendered as JSON,
+// CSV and Markdown. The ledger does not record the time of blocks, so reports are bounded
+// by block ranges; mapping dates to blocks is left to the application.
+package report
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// Access type of an access in a report
+type Access string
+
+const (
+	// Submit a tx submitted by the user
+	Submit Access = "submit"
+	// Write a value written by a tx
+	Write Access = "write"
+	// Read a value read by the user. The server does not tell which tx read a value, so read entries
+	// carry only the version read.
+	Read Access = "read"
+)
+
+// Entry a single access in a report
+type Entry struct {
+	Access   Access `json:"access"`
+	UserID   string `json:"user_id,omitempty"`
+	TxID     string `json:"tx_id,omitempty"`
+	BlockNum uint64 `json:"block_num,omitempty"`
+	TxIndex  uint64 `json:"tx_index,omitempty"`
+	// DBName the database of the key, unknown for the keys of a user report, as the server does not return it
+	DBName string `json:"db_name,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// Version of the value read or written
+	Version *types.Version `json:"version,omitempty"`
+	// Value the value read or written, only if values are included in the report
+	Value []byte `json:"value,omitempty"`
+	// ValueHash SHA256 hash of the value read or written
+	ValueHash []byte `json:"value_hash,omitempty"`
+	// Flag the validation flag of the tx
+	Flag string `json:"flag,omitempty"`
+	// Count the number of accesses the entry stands for, used for the reads of a key report
+	Count uint32 `json:"count,omitempty"`
+}
+
+// Report an audit report
+type Report struct {
+	Title     string   `json:"title"`
+	FromBlock uint64   `json:"from_block,omitempty"`
+	ToBlock   uint64   `json:"to_block,omitempty"`
+	Entries   []*Entry `json:"entries"`
+}
+
+// Options options of the report generator
+type Options struct {
+	// FromBlock and ToBlock if not zero, only accesses within the block range, inclusive, are reported. Reads
+	// are filtered by the block of the version read.
+	FromBlock uint64
+	ToBlock   uint64
+	// IncludeValues if set, the values read and written are included in the report, otherwise only their hashes
+	IncludeValues bool
+	// Envelopes returns the envelope of the data tx committed at the block number and tx index of version,
+	// nil if it is not available. A key report finds the txs that wrote the key by their position in the
+	// key's history, and, as the SDK cannot fetch tx envelopes from the server, their tx IDs are reported
+	// only if Envelopes is set, e.g. with envelopes kept by the application after commit.
+	Envelopes func(version *types.Version) (*types.DataTxEnvelope, error)
+}
+
+// Generator generates audit reports
+type Generator struct {
+	provenance bcdb.Provenance
+	ledger     bcdb.Ledger
+	opts       Options
+	receipts   map[string]*types.TxReceipt
+	headers    map[uint64]*types.BlockHeader
+}
+
+// NewGenerator creates a report generator
+func NewGenerator(p bcdb.Provenance, l bcdb.Ledger, opts *Options) *Generator {
+	g := &Generator{
+		provenance: p,
+		ledger:     l,
+		receipts:   make(map[string]*types.TxReceipt),
+		headers:    make(map[uint64]*types.BlockHeader),
+	}
+	if opts != nil {
+		g.opts = *opts
+	}
+	return g
+}
+
+// UserReport reports the txs submitted by a user, and the values the user wrote and read
+func (g *Generator) UserReport(userID string) (*Report, error) {
+	r := g.newReport(fmt.Sprintf("Data accessed by user %s", userID))
+
+	txIDs, err := g.provenance.GetTxIDsSubmittedByUser(userID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get txs submitted by user %s", userID)
+	}
+	positions := make(map[string]string)
+	for _, txID := range txIDs {
+		receipt, err := g.receipt(txID)
+		if err != nil {
+			return nil, err
+		}
+		blockNum := receipt.GetHeader().GetBaseHeader().GetNumber()
+		positions[position(blockNum, receipt.GetTxIndex())] = txID
+		if !g.inBlockRange(blockNum) {
+			continue
+		}
+		r.Entries = append(r.Entries, &Entry{
+			Access:   Submit,
+			UserID:   userID,
+			TxID:     txID,
+			BlockNum: blockNum,
+			TxIndex:  receipt.GetTxIndex(),
+			Flag:     flag(receipt.GetHeader(), receipt.GetTxIndex()),
+		})
+	}
+
+	writes, err := g.provenance.GetDataWrittenByUser(userID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get data written by user %s", userID)
+	}
+	for _, kv := range writes {
+		version := kv.GetMetadata().GetVersion()
+		if !g.inBlockRange(version.GetBlockNum()) {
+			continue
+		}
+		e := g.valueEntry(Write, userID, "", kv.GetKey(), version, kv.GetValue())
+		e.TxID = positions[position(version.GetBlockNum(), version.GetTxNum())]
+		if e.TxID != "" {
+			e.Flag = flag(g.receipts[e.TxID].GetHeader(), version.GetTxNum())
+		}
+		r.Entries = append(r.Entries, e)
+	}
+
+	reads, err := g.provenance.GetDataReadByUser(userID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get data read by user %s", userID)
+	}
+	for _, kv := range reads {
+		version := kv.GetMetadata().GetVersion()
+		if !g.inBlockRange(version.GetBlockNum()) {
+			continue
+		}
+		r.Entries = append(r.Entries, g.valueEntry(Read, userID, "", kv.GetKey(), version, kv.GetValue()))
+	}
+
+	sortEntries(r.Entries)
+	return r, nil
+}
+
+// KeyReport reports the versions of a key with the txs and users that wrote them, and the users who read the key.
+// The txs are identified by the block number and tx index of the versions, and their validation flags are read
+// from the headers of those blocks.
+func (g *Generator) KeyReport(dbName, key string) (*Report, error) {
+	r := g.newReport(fmt.Sprintf("Accesses to key %s in database %s", key, dbName))
+
+	values, err := g.provenance.GetHistoricalData(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get history of key '%s' in database '%s'", key, dbName)
+	}
+	versions := make(map[string]*Entry)
+	for _, v := range values {
+		version := v.GetMetadata().GetVersion()
+		if !g.inBlockRange(version.GetBlockNum()) {
+			continue
+		}
+		e := g.valueEntry(Write, "", dbName, key, version, v.GetValue())
+		header, err := g.header(version.GetBlockNum())
+		if err != nil {
+			return nil, err
+		}
+		e.Flag = flag(header, version.GetTxNum())
+		if e.TxID, err = g.txID(version); err != nil {
+			return nil, err
+		}
+		versions[position(version.GetBlockNum(), version.GetTxNum())] = e
+		r.Entries = append(r.Entries, e)
+	}
+
+	// the writer of each version is found among the data written by the writers of the key, the server
+	// does not return the database of that data, so it is matched by key and version
+	writers, err := g.provenance.GetWriters(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get writers of key '%s' in database '%s'", key, dbName)
+	}
+	sort.Strings(writers)
+	for _, userID := range writers {
+		writes, err := g.provenance.GetDataWrittenByUser(userID)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to get data written by user %s", userID)
+		}
+		for _, kv := range writes {
+			if kv.GetKey() != key {
+				continue
+			}
+			version := kv.GetMetadata().GetVersion()
+			if e, ok := versions[position(version.GetBlockNum(), version.GetTxNum())]; ok && e.UserID == "" {
+				e.UserID = userID
+			}
+		}
+	}
+
+	readers, err := g.provenance.GetReadersWithCounts(dbName, key)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get readers of key '%s' in database '%s'", key, dbName)
+	}
+	for _, reader := range readers {
+		r.Entries = append(r.Entries, &Entry{
+			Access: Read,
+			UserID: reader.UserID,
+			DBName: dbName,
+			Key:    key,
+			Count:  reader.Count,
+		})
+	}
+
+	sortEntries(r.Entries)
+	return r, nil
+}
+
+func (g *Generator) newReport(title string) *Report {
+	return &Report{
+		Title:     title,
+		FromBlock: g.opts.FromBlock,
+		ToBlock:   g.opts.ToBlock,
+	}
+}
+
+func (g *Generator) valueEntry(access Access, userID, dbName, key string, version *types.Version, value []byte) *Entry {
+	hash := sha256.Sum256(value)
+	e := &Entry{
+		Access:    access,
+		UserID:    userID,
+		BlockNum:  version.GetBlockNum(),
+		TxIndex:   version.GetTxNum(),
+		DBName:    dbName,
+		Key:       key,
+		Version:   version,
+		ValueHash: hash[:],
+	}
+	if access == Read {
+		// the version read was written by another tx, in another block
+		e.BlockNum, e.TxIndex = 0, 0
+	}
+	if g.opts.IncludeValues {
+		e.Value = value
+	}
+	return e
+}
+
+func (g *Generator) receipt(txID string) (*types.TxReceipt, error) {
+	if receipt, ok := g.receipts[txID]; ok {
+		return receipt, nil
+	}
+	receipt, err := g.ledger.GetTransactionReceipt(txID)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get receipt of tx %s", txID)
+	}
+	g.receipts[txID] = receipt
+	return receipt, nil
+}
+
+func (g *Generator) header(blockNum uint64) (*types.BlockHeader, error) {
+	if header, ok := g.headers[blockNum]; ok {
+		return header, nil
+	}
+	header, err := g.ledger.GetBlockHeader(blockNum)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get header of block %d", blockNum)
+	}
+	g.headers[blockNum] = header
+	return header, nil
+}
+
+// txID returns the ID of the tx at the position of version, empty if its envelope is not available
+func (g *Generator) txID(version *types.Version) (string, error) {
+	if g.opts.Envelopes == nil {
+		return "", nil
+	}
+	env, err := g.opts.Envelopes(version)
+	if err != nil {
+		return "", errors.WithMessagef(err, "failed to get envelope of tx at block %d, index %d", version.GetBlockNum(), version.GetTxNum())
+	}
+	return env.GetPayload().GetTxId(), nil
+}
+
+func (g *Generator) inBlockRange(blockNum uint64) bool {
+	return blockNum >= g.opts.FromBlock && (g.opts.ToBlock == 0 || blockNum <= g.opts.ToBlock)
+}
+
+func flag(header *types.BlockHeader, txIndex uint64) string {
+	validationInfo := header.GetValidationInfo()
+	if int(txIndex) >= len(validationInfo) {
+		return ""
+	}
+	return validationInfo[txIndex].GetFlag().String()
+}
+
+func position(blockNum, txIndex uint64) string {
+	return fmt.Sprintf("%d:%d", blockNum, txIndex)
+}
+
+var accessOrder = map[Access]int{Submit: 0, Write: 1, Read: 2}
+
+// sortEntries orders the entries by block, tx index, access, key and user
+func sortEntries(entries []*Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		ei, ej := entries[i], entries[j]
+		bi, ti := ei.BlockNum, ei.TxIndex
+		bj, tj := ej.BlockNum, ej.TxIndex
+		if ei.Version != nil && ei.Access == Read {
+			bi, ti = ei.Version.GetBlockNum(), ei.Version.GetTxNum()
+		}
+		if ej.Version != nil && ej.Access == Read {
+			bj, tj = ej.Version.GetBlockNum(), ej.Version.GetTxNum()
+		}
+		switch {
+		case bi != bj:
+			return bi < bj
+		case ti != tj:
+			return ti < tj
+		case ei.Access != ej.Access:
+			return accessOrder[ei.Access] < accessOrder[ej.Access]
+		case ei.Key != ej.Key:
+			return ei.Key < ej.Key
+		}
+		return ei.UserID < ej.UserID
+	})
+}
@@ -0,0 +1,171 @@
+// Copyright IBM Corp. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+package report
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb"
+	"github.com/hyperledger-labs/orion-sdk-go/pkg/bcdb/mocks/bcdbmocks"
+	"github.com/hyperledger-labs/orion-server/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func version(blockNum, txNum uint64) *types.Version {
+	return &types.Version{BlockNum: blockNum, TxNum: txNum}
+}
+
+func kv(key, value string, v *types.Version) *types.KVWithMetadata {
+	return &types.KVWithMetadata{Key: key, Value: []byte(value), Metadata: &types.Metadata{Version: v}}
+}
+
+func header(blockNum uint64, txCount int) *types.BlockHeader {
+	validationInfo := make([]*types.ValidationInfo, txCount)
+	for i := range validationInfo {
+		validationInfo[i] = &types.ValidationInfo{Flag: types.Flag_VALID}
+	}
+	return &types.BlockHeader{BaseHeader: &types.BlockHeaderBase{Number: blockNum}, ValidationInfo: validationInfo}
+}
+
+func receipt(blockNum, txIndex uint64) *types.TxReceipt {
+	return &types.TxReceipt{Header: header(blockNum, int(txIndex)+1), TxIndex: txIndex}
+}
+
+func hash(value string) []byte {
+	h := sha256.Sum256([]byte(value))
+	return h[:]
+}
+
+// alice wrote price in tx1 and rate in tx2 after reading cost; bob wrote price again in tx3
+func testSources() (*bcdbmocks.Provenance, *bcdbmocks.Ledger) {
+	p := &bcdbmocks.Provenance{}
+	p.On("GetTxIDsSubmittedByUser", "alice").Return([]string{"tx2", "tx1"}, nil)
+	p.On("GetDataWrittenByUser", "alice").Return([]*types.KVWithMetadata{
+		kv("rate", "1.1", version(5, 1)), kv("price", "100", version(3, 0)),
+	}, nil)
+	p.On("GetDataWrittenByUser", "bob").Return([]*types.KVWithMetadata{kv("price", "120", version(6, 0))}, nil)
+	p.On("GetDataReadByUser", "alice").Return([]*types.KVWithMetadata{kv("cost", "80", version(2, 0))}, nil)
+	p.On("GetHistoricalData", "bdb", "price").Return([]*types.ValueWithMetadata{
+		{Value: []byte("120"), Metadata: &types.Metadata{Version: version(6, 0)}},
+		{Value: []byte("100"), Metadata: &types.Metadata{Version: version(3, 0)}},
+	}, nil)
+	p.On("GetWriters", "bdb", "price").Return([]string{"bob", "alice"}, nil)
+	p.On("GetReadersWithCounts", "bdb", "price").Return([]*bcdb.UserAccessCount{{UserID: "carol", Count: 2}}, nil)
+
+	l := &bcdbmocks.Ledger{}
+	l.On("GetTransactionReceipt", "tx1").Return(receipt(3, 0), nil)
+	l.On("GetTransactionReceipt", "tx2").Return(receipt(5, 1), nil)
+	l.On("GetTransactionReceipt", "tx3").Return(receipt(6, 0), nil)
+	l.On("GetBlockHeader", uint64(3)).Return(header(3, 1), nil)
+	l.On("GetBlockHeader", uint64(5)).Return(header(5, 2), nil)
+	l.On("GetBlockHeader", uint64(6)).Return(header(6, 1), nil)
+	return p, l
+}
+
+func TestUserReport(t *testing.T) {
+	p, l := testSources()
+	r, err := NewGenerator(p, l, nil).UserReport("alice")
+	require.NoError(t, err)
+	require.Equal(t, "Data accessed by user alice", r.Title)
+	require.Equal(t, []*Entry{
+		{Access: Read, UserID: "alice", Key: "cost", Version: version(2, 0), ValueHash: hash("80")},
+		{Access: Submit, UserID: "alice", TxID: "tx1", BlockNum: 3, Flag: "VALID"},
+		{Access: Write, UserID: "alice", TxID: "tx1", BlockNum: 3, Key: "price", Version: version(3, 0), ValueHash: hash("100"), Flag: "VALID"},
+		{Access: Submit, UserID: "alice", TxID: "tx2", BlockNum: 5, TxIndex: 1, Flag: "VALID"},
+		{Access: Write, UserID: "alice", TxID: "tx2", BlockNum: 5, TxIndex: 1, Key: "rate", Version: version(5, 1), ValueHash: hash("1.1"), Flag: "VALID"},
+	}, r.Entries)
+
+	r, err = NewGenerator(p, l, &Options{FromBlock: 4, IncludeValues: true}).UserReport("alice")
+	require.NoError(t, err)
+	require.Len(t, r.Entries, 2)
+	require.Equal(t, []byte("1.1"), r.Entries[1].Value)
+
+	l = &bcdbmocks.Ledger{}
+	l.On("GetTransactionReceipt", "tx2").Return(nil, errors.New("tx tx2 not found"))
+	_, err = NewGenerator(p, l, nil).UserReport("alice")
+	require.EqualError(t, err, "failed to get receipt of tx tx2: tx tx2 not found")
+}
+
+func TestKeyReport(t *testing.T) {
+	p, l := testSources()
+	envelopes := map[uint64]*types.DataTxEnvelope{
+		3: {Payload: &types.DataTx{TxId: "tx1"}},
+		6: {Payload: &types.DataTx{TxId: "tx3"}},
+	}
+	r, err := NewGenerator(p, l, &Options{
+		IncludeValues: true,
+		Envelopes: func(version *types.Version) (*types.DataTxEnvelope, error) {
+			return envelopes[version.GetBlockNum()], nil
+		},
+	}).KeyReport("bdb", "price")
+	require.NoError(t, err)
+	require.Equal(t, "Accesses to key price in database bdb", r.Title)
+	require.Equal(t, []*Entry{
+		{Access: Read, UserID: "carol", DBName: "bdb", Key: "price", Count: 2},
+		{Access: Write, UserID: "alice", TxID: "tx1", BlockNum: 3, DBName: "bdb", Key: "price", Version: version(3, 0), Value: []byte("100"), ValueHash: hash("100"), Flag: "VALID"},
+		{Access: Write, UserID: "bob", TxID: "tx3", BlockNum: 6, DBName: "bdb", Key: "price", Version: version(6, 0), Value: []byte("120"), ValueHash: hash("120"), Flag: "VALID"},
+	}, r.Entries)
+	// the txs are found by the versions of the key, not among all the txs of the writers
+	p.AssertNotCalled(t, "GetTxIDsSubmittedByUser", mock.Anything)
+	l.AssertNotCalled(t, "GetTransactionReceipt", mock.Anything)
+
+	r, err = NewGenerator(p, l, &Options{FromBlock: 4}).KeyReport("bdb", "price")
+	require.NoError(t, err)
+	require.Equal(t, []*Entry{
+		{Access: Read, UserID: "carol", DBName: "bdb", Key: "price", Count: 2},
+		{Access: Write, UserID: "bob", BlockNum: 6, DBName: "bdb", Key: "price", Version: version(6, 0), ValueHash: hash("120"), Flag: "VALID"},
+	}, r.Entries)
+
+	l = &bcdbmocks.Ledger{}
+	l.On("GetBlockHeader", uint64(6)).Return(nil, errors.New("block 6 not found"))
+	_, err = NewGenerator(p, l, nil).KeyReport("bdb", "price")
+	require.EqualError(t, err, "failed to get header of block 6: block 6 not found")
+}
+
+func TestRender(t *testing.T) {
+	r := &Report{
+		Title:     "Accesses to key price in database bdb",
+		FromBlock: 3,
+		Entries: []*Entry{
+			{Access: Read, UserID: "carol", DBName: "bdb", Key: "price", Count: 2},
+			{Access: Write, UserID: "alice", TxID: "tx1", BlockNum: 3, DBName: "bdb", Key: "price", Version: version(3, 0), Value: []byte("a|b"), ValueHash: []byte{0xab}, Flag: "VALID"},
+			{Access: Write, UserID: "bob", TxID: "tx3", BlockNum: 6, DBName: "bdb", Key: "price", Version: version(6, 0), Value: []byte{0, 1}, ValueHash: []byte{0xcd}, Flag: "VALID"},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, r.WriteCSV(buf))
+	require.Equal(t, `access,user_id,tx_id,block_num,tx_index,db_name,key,version,value,value_hash,flag,count
+read,carol,,,,bdb,price,,,,,2
+write,alice,tx1,3,0,bdb,price,3:0,a|b,ab,VALID,
+write,bob,tx3,6,0,bdb,price,6:0,base64:AAE=,cd,VALID,
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, r.WriteMarkdown(buf))
+	require.Equal(t, `# Accesses to key price in database bdb
+
+Blocks 3 to last
+
+| access | user_id | tx_id | block_num | tx_index | db_name | key | version | value | value_hash | flag | count |
+| --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- | --- |
+| read | carol |  |  |  | bdb | price |  |  |  |  | 2 |
+| write | alice | tx1 | 3 | 0 | bdb | price | 3:0 | a\|b | ab | VALID |  |
+| write | bob | tx3 | 6 | 0 | bdb | price | 6:0 | base64:AAE= | cd | VALID |  |
+`, buf.String())
+
+	b, err := r.JSON()
+	require.NoError(t, err)
+	decoded := &Report{}
+	require.NoError(t, json.Unmarshal(b, decoded))
+	require.Equal(t, r, decoded)
+
+	buf.Reset()
+	require.NoError(t, (&Report{Title: "Data accessed by user eve"}).WriteMarkdown(buf))
+	require.Equal(t, "# Data accessed by user eve\n\nNo accesses.\n", buf.String())
+}